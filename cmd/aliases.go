@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+var aliasesFile string
+
+func init() {
+	flags := cmdRoot.PersistentFlags()
+	flags.StringVar(&aliasesFile,
+		"aliases-file",
+		"aliases.json",
+		"Filename where alternative command names, shared by every remote, are loaded from, as JSON, YAML (.yaml or .yml) or TOML (.toml). Ignored when missing.")
+	_ = cobra.MarkFlagFilename(flags, "aliases-file", "json", "yaml", "yml", "toml")
+}
+
+// mustAliases loads the global command aliases, if any.
+func mustAliases() remotes.Aliases {
+	aliases := remotes.Aliases{}
+	if err := utils.LoadFromFile(&aliases, aliasesFile); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithField("aliases-file", aliasesFile).Fatal("Failed to load aliases from file")
+	}
+	return aliases
+}
@@ -1,9 +1,8 @@
 package cmd
 
 import (
-	"fmt"
 	"github.com/j-vizcaino/ir-remotes/pkg/devices"
-	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
 	"os"
 	"time"
 
@@ -54,10 +53,12 @@ func init() {
 	cmdRoot.AddCommand(captureCmd)
 }
 
-func mustGetDevice() *broadlink.Device {
-	deviceList := devices.DeviceInfoList{}
-	if err := utils.LoadFromFile(&deviceList, devicesFile); err != nil && !os.IsNotExist(err) {
-		log.WithError(err).WithField("devices-file", devicesFile).Fatal("Failed to load devices file")
+func mustGetDevice() *devices.DeviceInfo {
+	store := mustStore()
+	defer store.Close()
+	deviceList, err := store.LoadDevices()
+	if err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Failed to load devices")
 	}
 
 	if len(deviceList) == 0 {
@@ -78,8 +79,8 @@ func mustGetDevice() *broadlink.Device {
 		d, found = deviceList.Find(devices.ByName(deviceName))
 		if !found {
 			log.WithFields(log.Fields{
-				"device-name":  deviceName,
-				"devices-file": devicesFile,
+				"device-name": deviceName,
+				"storage":     storageSpec,
 			}).Fatal("No such device with given name")
 		}
 	}
@@ -91,97 +92,90 @@ func mustGetDevice() *broadlink.Device {
 			"type":    d.TypeName,
 		}).Fatal("Failed to authenticate with Broadlink device")
 	}
-	return d.GetBroadlinkDevice()
+	return d
 
 }
 
 func Capture(cmd *cobra.Command, args []string) {
-	remoteList := remotes.RemoteList{}
-	err := utils.LoadFromFile(&remoteList, remotesFile)
-	if err != nil && !os.IsNotExist(err) {
-		log.WithError(err).WithField("remotes-file", remotesFile).Fatal("Failed to load remotes file")
+	logger := subsystemLog(logCapture)
+	store := mustStore()
+	defer store.Close()
+	remoteList, err := store.LoadRemotes()
+	if err != nil {
+		logger.WithError(err).WithField("storage", storageSpec).Fatal("Failed to load remotes")
 	}
 
 	remote := remoteList.Find(remoteName)
 	if remote == nil {
 		remote = remotes.NewRemote(remoteName)
-		remoteList = append(remoteList, remote)
 	}
 
 	bd := mustGetDevice()
 
+	aliases := mustAliases()
+	captured := make(map[string]remotes.IRCommand)
 	for _, cmdName := range args {
-		_, ok := remote.Commands[cmdName]
-		if ok {
-			log.WithField("command", cmdName).Info("Command name already exists. Skipping capture.")
+		if existing, found := remote.Lookup(cmdName, aliases); found {
+			logger.WithField("command", cmdName).WithField("existing", existing).Info("Command name already exists. Skipping capture.")
 			continue
 		}
 
 		cmd, err := captureIRCode(bd, captureTimeout, cmdName)
 		if err != nil {
-			log.WithError(err).Fatal("Failed to capture IR command")
-		}
-
-		if err := remote.AddCommand(cmdName, cmd); err != nil {
-			log.WithError(err).WithField("command", cmdName).Error("Failed to add command to remote")
-			continue
+			logger.WithError(err).Fatal("Failed to capture IR command")
 		}
+		captured[cmdName] = cmd
 	}
 
-	if err := utils.SaveToFile(&remoteList, remotesFile); err != nil {
-		log.WithError(err).WithField("remotes-file", remotesFile).Error("Failed to save remotes list to file")
+	// Remotes are loaded again, since they may have been modified during capture
+	err = storage.UpdateRemotes(store, lockTimeout, func(remoteList remotes.RemoteList) (remotes.RemoteList, error) {
+		remote := remoteList.Find(remoteName)
+		if remote == nil {
+			remote = remotes.NewRemote(remoteName)
+			remoteList = append(remoteList, remote)
+		}
+		for cmdName, cmd := range captured {
+			if err := remote.AddCommand(cmdName, cmd); err != nil {
+				logger.WithError(err).WithField("command", cmdName).Error("Failed to add command to remote")
+			}
+		}
+		return remoteList, nil
+	})
+	if err != nil {
+		logger.WithError(err).WithField("storage", storageSpec).Error("Failed to save remotes")
 		os.Exit(1)
 	}
 }
 
-func findDevice(timeout time.Duration) *broadlink.Device {
-	log.Info("Looking for Broadlink devices on your network. Please wait...")
+func findDevice(timeout time.Duration) *devices.DeviceInfo {
+	logger := subsystemLog(logDiscovery)
+	logger.Info("Looking for Broadlink devices on your network. Please wait...")
 	devs, err := broadlink.DiscoverDevices(timeout, 0)
 	if err != nil {
-		log.WithError(err).Fatal("Failed to discover Broadlink devices")
+		logger.WithError(err).Fatal("Failed to discover Broadlink devices")
 	}
 	if len(devs) == 0 {
-		log.Fatal("No Broadlink device found")
+		logger.Fatal("No Broadlink device found")
 	}
 
 	if len(devs) > 1 {
-		log.Info("Multiple devices found. Please run discover first, then run capture again, selecting the right Broadlink device to use.")
+		logger.Info("Multiple devices found. Please run discover first, then run capture again, selecting the right Broadlink device to use.")
 		os.Exit(1)
 	}
 
 	dev := devices.NewDeviceInfo("discovered", devs[0])
-	log.WithField("address", dev.UDPAddress).
+	logger.WithField("address", dev.UDPAddress).
 		WithField("mac", dev.MACAddress).
 		Info("Device found!")
 
 	if err := dev.InitializeDevice(time.Second); err != nil {
-		log.WithError(err).Fatal("Failed to authenticate with device")
+		logger.WithError(err).Fatal("Failed to authenticate with device")
 	}
-	return dev.GetBroadlinkDevice()
+	return dev
 }
 
-func captureIRCode(device *broadlink.Device, timeout time.Duration, cmdName string) (remotes.IRCommand, error) {
-	// Enter capturing mode.
-	if err := device.StartCaptureRemoteControlCode(); err != nil {
-		log.WithError(err).Error("Failed to start capture mode")
-		return nil, err
-	}
-	log.Infof("Waiting for IR code. Press %q button...", cmdName)
-
-	start := time.Now()
-	for time.Since(start) < timeout {
-		remotetype, ircode, err := device.ReadCapturedRemoteControlCode()
-		if err != nil {
-			if err == broadlink.ErrNotCaptured {
-				time.Sleep(time.Second)
-				continue
-			}
-			return nil, err
-		}
-		if remotetype != broadlink.REMOTE_IR {
-			return nil, fmt.Errorf("received unexpected command type %x (expected infra-red type %x)", remotetype, broadlink.REMOTE_IR)
-		}
-		return ircode, nil
-	}
-	return nil, fmt.Errorf("timed out waiting for IR control codes")
+func captureIRCode(device *devices.DeviceInfo, timeout time.Duration, cmdName string) (remotes.IRCommand, error) {
+	logger := subsystemLog(logCapture)
+	logger.Infof("Waiting for IR code. Press %q button...", cmdName)
+	return device.CaptureIRCode(timeout, nil, nil)
 }
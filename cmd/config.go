@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
+)
+
+var (
+	cmdConfig = &cobra.Command{
+		Use:   "config COMMAND",
+		Short: "Manage remotes and devices configuration.",
+	}
+	cmdConfigMigrate = &cobra.Command{
+		Use:   "migrate [OPTIONS]",
+		Short: "Upgrade stored remotes and devices to the current schema version.",
+		Long: `Upgrade stored remotes and devices to the current schema version.
+Content written by older versions of ir-remotes is always upgraded in memory when loaded, and in storage when saved: this command upgrades everything at once.`,
+		Args: cobra.NoArgs,
+		Run:  ConfigMigrate,
+	}
+	cmdConfigValidate = &cobra.Command{
+		Use:   "validate",
+		Short: "Check stored remotes and devices, reporting every problem found.",
+		Long: `Check stored remotes and devices, reporting every problem found.
+Problems are located by file and path in the file, like remotes[2].commands.power, along with the remote, command or device concerned.
+The same checks are made every time remotes and devices are loaded. Exits with status 1 when any problem is found.`,
+		Args: cobra.NoArgs,
+		Run:  ConfigValidate,
+	}
+	migrateDryRun bool
+)
+
+func init() {
+	cmdConfigMigrate.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Only list the migrations to apply, without writing anything.")
+
+	cmdConfig.AddCommand(cmdConfigMigrate)
+	cmdConfig.AddCommand(cmdConfigValidate)
+	cmdRoot.AddCommand(cmdConfig)
+}
+
+func ConfigMigrate(_ *cobra.Command, _ []string) {
+	store := mustStore()
+	defer store.Close()
+
+	version, err := store.SchemaVersion()
+	if err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Failed to read schema version")
+	}
+	pending, err := storage.PendingMigrations(version)
+	if err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Cannot migrate storage")
+	}
+	logger := log.WithFields(log.Fields{
+		"storage": storageSpec,
+		"version": version,
+		"current": storage.SchemaVersion,
+	})
+	if len(pending) == 0 {
+		logger.Info("Storage is up to date")
+		return
+	}
+	for _, m := range pending {
+		log.WithField("from", m.Version).WithField("to", m.Version+1).Info(m.Description)
+	}
+	if migrateDryRun {
+		logger.Info("Dry run, storage was not modified")
+		return
+	}
+
+	// Content is upgraded when loaded, saving it writes the current version
+	l, err := store.Lock(lockTimeout)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to lock storage")
+	}
+	defer l.Unlock()
+	remoteList, err := store.LoadRemotes()
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load remotes")
+	}
+	devInfoList, err := store.LoadDevices()
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load devices")
+	}
+	if err := store.SaveRemotes(remoteList); err != nil {
+		logger.WithError(err).Fatal("Failed to save remotes")
+	}
+	if err := store.SaveDevices(devInfoList); err != nil {
+		logger.WithError(err).Fatal("Failed to save devices")
+	}
+	logger.Info("Storage upgraded")
+}
+
+// logProblems logs every problem of err, returns the number of problems.
+func logProblems(what string, err error) int {
+	if err == nil {
+		return 0
+	}
+	problems, ok := err.(storage.ValidationError)
+	if !ok {
+		log.WithError(err).Errorf("Failed to load %s", what)
+		return 1
+	}
+	for _, p := range problems {
+		fields := log.Fields{"file": p.File}
+		if p.Path != "" {
+			fields["path"] = p.Path
+		}
+		if p.Remote != "" {
+			fields["remote"] = p.Remote
+		}
+		if p.Command != "" {
+			fields["command"] = p.Command
+		}
+		if p.Device != "" {
+			fields["device"] = p.Device
+		}
+		log.WithFields(fields).Error(p.Message)
+	}
+	return len(problems)
+}
+
+func ConfigValidate(_ *cobra.Command, _ []string) {
+	store := mustStore()
+	defer store.Close()
+
+	_, err := store.LoadRemotes()
+	count := logProblems("remotes", err)
+	_, err = store.LoadDevices()
+	count += logProblems("devices", err)
+	if count > 0 {
+		log.WithField("storage", storageSpec).WithField("problems", count).Error("Configuration is invalid")
+		os.Exit(1)
+	}
+	log.WithField("storage", storageSpec).Info("Configuration is valid")
+}
@@ -2,14 +2,13 @@ package cmd
 
 import (
 	"net"
-	"os"
 
 	"github.com/mixcode/broadlink"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/j-vizcaino/ir-remotes/pkg/devices"
-	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
 
 	"github.com/manifoldco/promptui"
 )
@@ -46,26 +45,32 @@ func getDeviceName() string {
 }
 
 func Discover(_ *cobra.Command, _ []string) {
-	deviceList := devices.DeviceInfoList{}
-	err := utils.LoadFromFile(&deviceList, devicesFile)
-	if err != nil && !os.IsNotExist(err) {
-		log.WithError(err).WithField("devices-file", devicesFile).Fatal("Failed to load devices from file.")
+	logger := subsystemLog(logDiscovery)
+	store := mustStore()
+	defer store.Close()
+	deviceList, err := store.LoadDevices()
+	if err != nil {
+		logger.WithError(err).WithField("storage", storageSpec).Fatal("Failed to load devices.")
 	}
 
-	log.Info("Looking for Broadlink devices on your network. Please wait...")
+	logger.Info("Looking for Broadlink devices on your network. Please wait...")
 	discovered, err := broadlink.DiscoverDevices(discoveryTimeout, 0)
 	if err != nil {
-		log.WithError(err).Fatal("Failed to discover Broadlink devices")
+		logger.WithError(err).Fatal("Failed to discover Broadlink devices")
 	}
 	if len(discovered) == 0 {
-		log.Fatal("No Broadlink device found")
+		logger.Fatal("No Broadlink device found")
 	}
 
-	modified := false
+	type namedDevice struct {
+		name   string
+		device broadlink.Device
+	}
+	added := []namedDevice{}
 	for _, bd := range discovered {
 		model, _ := bd.DeviceName()
 		macAddr := net.HardwareAddr(bd.MACAddr).String()
-		log.WithField("mac-address", macAddr).
+		logger.WithField("mac-address", macAddr).
 			WithField("udp-address", bd.UDPAddr.String()).
 			WithField("model", model).
 			Info("Found device.")
@@ -74,26 +79,30 @@ func Discover(_ *cobra.Command, _ []string) {
 			return dev.MACAddress == macAddr
 		})
 		if found {
-			log.WithField("mac-address", existing.MACAddress).
+			logger.WithField("mac-address", existing.MACAddress).
 				WithField("name", existing.Name).
 				Info("Device already exist in device list. Skipping.")
 			continue
 		}
 
-		devName := getDeviceName()
-		if err := deviceList.AddDevice(devName, bd); err != nil {
-			log.WithError(err).Error("Failed to store device")
-		} else {
-			modified = true
-		}
+		added = append(added, namedDevice{name: getDeviceName(), device: bd})
 	}
 
-	if modified {
-		if err := utils.SaveToFile(&deviceList, devicesFile); err != nil {
-			log.WithError(err).WithField("devices-file", devicesFile).Fatal("Failed to save devices to file.")
+	if len(added) > 0 {
+		// Devices are loaded again, since they may have been modified while prompting for names
+		err := storage.UpdateDevices(store, lockTimeout, func(deviceList devices.DeviceInfoList) (devices.DeviceInfoList, error) {
+			for _, d := range added {
+				if err := deviceList.AddDevice(d.name, d.device); err != nil {
+					logger.WithError(err).Error("Failed to store device")
+				}
+			}
+			return deviceList, nil
+		})
+		if err != nil {
+			logger.WithError(err).WithField("storage", storageSpec).Fatal("Failed to save devices.")
 		}
-		log.WithField("devices-file", devicesFile).Info("Saved devices information to file")
+		logger.WithField("storage", storageSpec).Info("Saved devices information")
 	} else {
-		log.Info("No new device found.")
+		logger.Info("No new device found.")
 	}
 }
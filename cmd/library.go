@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	bundled "github.com/j-vizcaino/ir-remotes/pkg/assets/library"
+	"github.com/j-vizcaino/ir-remotes/pkg/library"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
+)
+
+var (
+	cmdLibrary = &cobra.Command{
+		Use:   "library COMMAND",
+		Short: "Find and install remote templates.",
+		Long: `Find and install remote templates, from the templates bundled with ir-remotes and the ones of --library-dir.
+Templates of --library-dir replace the bundled templates with the same name.`,
+	}
+	cmdLibrarySearch = &cobra.Command{
+		Use:     "search [TERM...]",
+		Short:   "List the templates matching every term, by name, brand, model, category or protocol.",
+		Example: "  ir-remotes library search samsung tv",
+		Run:     LibrarySearch,
+	}
+	cmdLibraryInstall = &cobra.Command{
+		Use:   "install TEMPLATE",
+		Args:  cobra.ExactArgs(1),
+		Short: "Copy a template into the remotes.",
+		Long: `Copy a template into the remotes, given by name like samsung/tv, or by brand and model like Samsung/BN59-01199F.
+With --extend, the remote extends the template instead, so that it follows the template changes.`,
+		Example: "  ir-remotes library install samsung/tv --as living-room-tv",
+		Run:     LibraryInstall,
+	}
+
+	libraryDir     string
+	installName    string
+	installExtends bool
+)
+
+func init() {
+	flags := cmdRoot.PersistentFlags()
+	flags.StringVar(&libraryDir,
+		"library-dir",
+		"library",
+		"Directory of remote templates, which remotes can extend. Templates are named after their path, without extension, like samsung/tv. Ignored when missing.")
+
+	cmdLibraryInstall.Flags().StringVar(&installName, "as", "", "Name of the installed remote. Defaults to the template name, like samsung-tv.")
+	cmdLibraryInstall.Flags().BoolVar(&installExtends, "extend", false, "Extend the template, instead of copying it.")
+
+	cmdLibrary.AddCommand(cmdLibrarySearch)
+	cmdLibrary.AddCommand(cmdLibraryInstall)
+	cmdRoot.AddCommand(cmdLibrary)
+}
+
+// mustLibrary loads the bundled remote templates, and the ones of the library directory.
+func mustLibrary() *library.Library {
+	lib, err := library.Load(library.Source{Name: "bundled", FS: bundled.Assets}, library.Dir(libraryDir))
+	if err != nil {
+		log.WithError(err).WithField("library-dir", libraryDir).Fatal("Failed to load remote templates")
+	}
+	return lib
+}
+
+func LibrarySearch(_ *cobra.Command, args []string) {
+	found := mustLibrary().Search(args...)
+	if len(found) == 0 {
+		log.WithField("terms", strings.Join(args, " ")).Fatal("No template found")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TEMPLATE\tBRAND\tMODEL\tCATEGORY\tPROTOCOL\tCOMMANDS")
+	for _, r := range found {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", r.Name, r.Brand, r.Model, r.Category, r.Protocol, len(r.Commands))
+	}
+	w.Flush()
+}
+
+func LibraryInstall(_ *cobra.Command, args []string) {
+	template, err := mustLibrary().Lookup(args[0])
+	if err != nil {
+		log.WithError(err).Fatal("Cannot install template")
+	}
+	name := installName
+	if name == "" {
+		name = strings.Replace(template.Name, "/", "-", -1)
+	}
+	if strings.Contains(name, "/") {
+		log.WithField("remote", name).Fatal("Remote names cannot contain /")
+	}
+
+	var r *remotes.Remote
+	if installExtends {
+		r = remotes.NewRemote(name)
+		r.Extends = template.Name
+	} else {
+		r = template.Flattened()
+		r.Name = name
+	}
+
+	store := mustStore()
+	defer store.Close()
+	err = storage.UpdateRemotes(store, lockTimeout, func(rl remotes.RemoteList) (remotes.RemoteList, error) {
+		if rl.Find(name) != nil {
+			return nil, fmt.Errorf("remote %q already exists, choose another name with --as", name)
+		}
+		return append(rl, r), nil
+	})
+	if err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Failed to install template")
+	}
+	log.WithFields(log.Fields{
+		"template": template.Name,
+		"remote":   name,
+		"commands": len(template.Commands),
+	}).Info("Installed template")
+}
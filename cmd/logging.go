@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Subsystems, whose logs are tagged with the subsystem field and may use their own level
+const (
+	logDiscovery = "discovery"
+	logCapture   = "capture"
+	logHTTP      = "http"
+	logDevice    = "device"
+	logMQTT      = "mqtt"
+)
+
+var subsystemLoggers = map[string]*log.Logger{
+	logDiscovery: log.New(),
+	logCapture:   log.New(),
+	logHTTP:      log.New(),
+	logDevice:    log.New(),
+	logMQTT:      log.New(),
+}
+
+var logFormat string
+var logLevel string
+
+func init() {
+	flags := cmdRoot.PersistentFlags()
+	flags.StringVar(&logFormat,
+		"log-format",
+		"text",
+		"Format of logs: text, or json (one object per line, with timestamps).")
+	flags.StringVar(&logLevel,
+		"log-level",
+		"info",
+		fmt.Sprintf("Level of logs: debug, info, warning or error. Subsystems (%s) may use their own level, like info,http=warning,device=debug.", strings.Join(subsystems(), ", ")))
+
+	// Flags are applied before running any command
+	cmdRoot.PersistentPreRun = func(_ *cobra.Command, _ []string) {
+		if err := setupLogging(logFormat, logLevel); err != nil {
+			log.WithError(err).Fatal("Invalid logging options")
+		}
+	}
+	if err := setupLogging("text", "info"); err != nil {
+		panic(err)
+	}
+}
+
+// standardHooks fires the hooks of the standard logger, so that they receive the logs of every subsystem,
+// including hooks added once logging is set up.
+type standardHooks struct{}
+
+func (standardHooks) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (standardHooks) Fire(e *log.Entry) error {
+	return log.StandardLogger().Hooks.Fire(e.Level, e)
+}
+
+func subsystems() []string {
+	out := make([]string, 0, len(subsystemLoggers))
+	for name := range subsystemLoggers {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// setupLogging configures the format and levels of the standard logger and of every subsystem logger.
+func setupLogging(format string, levels string) error {
+	var formatter log.Formatter
+	switch format {
+	case "text":
+		formatter = &log.TextFormatter{DisableTimestamp: true}
+	case "json":
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("unsupported log format %q (expected text or json)", format)
+	}
+
+	level := log.InfoLevel
+	subsystemLevels := make(map[string]log.Level)
+	for _, spec := range strings.Split(levels, ",") {
+		spec = strings.TrimSpace(spec)
+		subsystem := ""
+		if idx := strings.Index(spec, "="); idx >= 0 {
+			subsystem, spec = spec[:idx], spec[idx+1:]
+			if _, found := subsystemLoggers[subsystem]; !found {
+				return fmt.Errorf("unknown log subsystem %q (expected one of %s)", subsystem, strings.Join(subsystems(), ", "))
+			}
+		}
+		l, err := log.ParseLevel(spec)
+		if err != nil {
+			return err
+		}
+		if subsystem == "" {
+			level = l
+		} else {
+			subsystemLevels[subsystem] = l
+		}
+	}
+
+	log.SetFormatter(formatter)
+	log.SetLevel(level)
+	for name, logger := range subsystemLoggers {
+		logger.Formatter = formatter
+		logger.Out = log.StandardLogger().Out
+		logger.Hooks = log.LevelHooks{}
+		logger.Hooks.Add(standardHooks{})
+		logger.Level = level
+		if l, found := subsystemLevels[name]; found {
+			logger.Level = l
+		}
+	}
+	return nil
+}
+
+// subsystemLog returns the logger of the subsystem.
+func subsystemLog(subsystem string) *log.Entry {
+	return subsystemLoggers[subsystem].WithField("subsystem", subsystem)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestSetupLogging(t *testing.T) {
+	g := NewGomegaWithT(t)
+	defer func() {
+		g.Expect(setupLogging("text", "info")).To(Succeed())
+	}()
+
+	tests := []struct {
+		format    string
+		levels    string
+		formatter log.Formatter
+		level     log.Level
+		// subsystemLevels are the levels of the subsystems which differ from the standard logger
+		subsystemLevels map[string]log.Level
+		err             string
+	}{
+		{format: "text", levels: "info", formatter: &log.TextFormatter{}, level: log.InfoLevel},
+		{format: "json", levels: "debug", formatter: &log.JSONFormatter{}, level: log.DebugLevel},
+		{format: "text", levels: "warning, http=error", formatter: &log.TextFormatter{}, level: log.WarnLevel,
+			subsystemLevels: map[string]log.Level{logHTTP: log.ErrorLevel}},
+		{format: "json", levels: "device=debug,error,capture=info", formatter: &log.JSONFormatter{}, level: log.ErrorLevel,
+			subsystemLevels: map[string]log.Level{logDevice: log.DebugLevel, logCapture: log.InfoLevel}},
+		// The standard level defaults to info
+		{format: "text", levels: "discovery=warning", formatter: &log.TextFormatter{}, level: log.InfoLevel,
+			subsystemLevels: map[string]log.Level{logDiscovery: log.WarnLevel}},
+
+		{format: "xml", levels: "info", err: `unsupported log format "xml" (expected text or json)`},
+		{format: "text", levels: "verbose", err: `not a valid logrus Level: "verbose"`},
+		{format: "text", levels: "info,http=loud", err: `not a valid logrus Level: "loud"`},
+		{format: "text", levels: "info,zigbee=debug", err: `unknown log subsystem "zigbee" (expected one of capture, device, discovery, http, mqtt)`},
+	}
+	for _, test := range tests {
+		err := setupLogging(test.format, test.levels)
+		if test.err != "" {
+			g.Expect(err).To(MatchError(test.err), "%s %s", test.format, test.levels)
+			continue
+		}
+		g.Expect(err).ToNot(HaveOccurred(), "%s %s", test.format, test.levels)
+		g.Expect(log.StandardLogger().Formatter).To(BeAssignableToTypeOf(test.formatter), test.levels)
+		g.Expect(log.GetLevel()).To(Equal(test.level), test.levels)
+		for name, logger := range subsystemLoggers {
+			level, found := test.subsystemLevels[name]
+			if !found {
+				level = test.level
+			}
+			g.Expect(logger.Level).To(Equal(level), "%s: %s", test.levels, name)
+			g.Expect(logger.Formatter).To(BeIdenticalTo(log.StandardLogger().Formatter), name)
+		}
+	}
+}
+
+func TestSubsystemLog_Hooks(t *testing.T) {
+	g := NewGomegaWithT(t)
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	g.Expect(setupLogging("text", "info,device=debug")).To(Succeed())
+	defer func() {
+		g.Expect(setupLogging("text", "info")).To(Succeed())
+	}()
+
+	// Hooks added once logging is set up receive the subsystem logs, at the subsystem level
+	hooks := log.StandardLogger().ReplaceHooks(log.LevelHooks{})
+	defer log.StandardLogger().ReplaceHooks(hooks)
+	hook := test.NewGlobal()
+
+	subsystemLog(logDevice).Debug("Device debug")
+	subsystemLog(logHTTP).Debug("HTTP debug")
+	log.Info("Standard info")
+	entries := hook.AllEntries()
+	g.Expect(entries).To(HaveLen(2))
+	g.Expect(entries[0].Message).To(Equal("Device debug"))
+	g.Expect(entries[0].Data).To(HaveKeyWithValue("subsystem", logDevice))
+	g.Expect(entries[1].Message).To(Equal("Standard info"))
+}
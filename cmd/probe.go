@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/probe"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
+)
+
+var cmdProbe = &cobra.Command{
+	Use:   "probe [OPTIONS]",
+	Args:  cobra.NoArgs,
+	Short: "Find the IR codes of a device without its remote.",
+	Long: `Find the IR codes of a device without its remote, by sending candidate codes and asking whether the device responded.
+Power codes of the library templates are sent first, the ones of the brand, then every address of the protocols, until the device responds.
+Once the protocol and address are found, every command of the address is sent, naming the ones the device responds to.
+Commands found are saved as a new remote, when the search is over or stopped.`,
+	Example: "  ir-remotes probe --brand lg --as bedroom-tv\n  ir-remotes probe --protocol nec --address 0x04",
+	Run:     Probe,
+}
+
+var (
+	probeOptions    = probe.Options{}
+	probeRemoteName string
+	probeRepeat     int
+)
+
+func init() {
+	flags := cmdProbe.Flags()
+	flags.StringVar(&deviceName,
+		"device-name",
+		"",
+		"Name of the Broadlink device sending codes. This option is required when device list contains more than one entry.")
+	flags.StringVar(&probeOptions.Brand, "brand", "", "Brand of the device, like lg: the power codes of its templates in the library are sent first.")
+	flags.StringVar(&probeOptions.Protocol, "protocol", "", fmt.Sprintf("Only send codes of the protocol: one of %s.", strings.Join(probe.Protocols(), ", ")))
+	flags.IntVar(&probeOptions.Address, "address", -1, "Address of the device, like 0x04, when known. Requires --protocol.")
+	flags.StringVar(&probeRemoteName, "as", "", "Name of the remote saving the commands found. Asked at the end when empty.")
+	flags.IntVar(&probeRepeat, "repeat", 1, "Number of times every code is sent.")
+
+	cmdRoot.AddCommand(cmdProbe)
+}
+
+const (
+	answerYes    = "y"
+	answerNo     = "n"
+	answerRepeat = "r"
+	answerQuit   = "q"
+)
+
+// askResponded asks whether the device responded to the code sent, showing the progress of the session.
+func askResponded(session *probe.Session, c probe.Candidate) string {
+	tried, total := session.Progress()
+	prompt := promptui.Prompt{
+		Label: fmt.Sprintf("[%d/%d] Sent %s. Did the device respond? [y]es, [n]o, [r]epeat, [q]uit", tried, total, c),
+		Validate: func(input string) error {
+			switch strings.ToLower(input) {
+			case "", answerYes, answerNo, answerRepeat, answerQuit:
+				return nil
+			}
+			return fmt.Errorf("expected y, n, r or q")
+		},
+	}
+	result, err := prompt.Run()
+	if err != nil {
+		// Interrupted
+		return answerQuit
+	}
+	if result == "" {
+		return answerNo
+	}
+	return strings.ToLower(result)
+}
+
+// askString asks for a value, defaultValue being used when the answer is empty.
+func askString(label string, defaultValue string) string {
+	prompt := promptui.Prompt{
+		Label:   label,
+		Default: defaultValue,
+	}
+	result, err := prompt.Run()
+	if err != nil {
+		log.WithError(err).Fatal("Prompt failed")
+	}
+	if result = strings.TrimSpace(result); result == "" {
+		return defaultValue
+	}
+	return result
+}
+
+func Probe(_ *cobra.Command, _ []string) {
+	probeOptions.Known = probe.PowerCodes(mustLibrary().Templates())
+	if probeOptions.Brand != "" {
+		brands := probe.Brands(probeOptions.Known)
+		known := false
+		for _, brand := range brands {
+			known = known || brand == strings.ToLower(probeOptions.Brand)
+		}
+		if !known {
+			log.WithField("brands", strings.Join(brands, ", ")).Warnf("No power code of brand %q in the library, trying every brand", probeOptions.Brand)
+		}
+	}
+	session, err := probe.NewSession(probeOptions)
+	if err != nil {
+		log.WithError(err).Fatal("Cannot probe")
+	}
+	bd := mustGetDevice()
+
+	names := make(map[probe.Candidate]string)
+	stage := session.Stage()
+	for c, ok := session.Next(); ok; c, ok = session.Next() {
+		if session.Stage() != stage {
+			stage = session.Stage()
+			log.Info("Sending every command of the address, answer y for the commands the device responds to")
+		}
+		answer := answerRepeat
+		for answer == answerRepeat {
+			if err := bd.SendIRCode(c.Code(), probeRepeat); err != nil {
+				log.WithError(err).Fatal("Failed to send IR code")
+			}
+			answer = askResponded(session, c)
+		}
+		if answer == answerQuit {
+			break
+		}
+		if answer != answerYes {
+			continue
+		}
+		if session.Stage() == probe.StageAddress {
+			log.WithFields(log.Fields{
+				"protocol": c.Protocol,
+				"address":  fmt.Sprintf("0x%02x", c.Address),
+			}).Info("Found the device protocol and address")
+			names[c] = askString("Command name", "power")
+		} else {
+			names[c] = askString("Command name", fmt.Sprintf("command_%02x", c.Command))
+		}
+		session.Responded()
+	}
+
+	found := session.Found()
+	if len(found) == 0 {
+		log.Fatal("The device did not respond to any code")
+	}
+	name := probeRemoteName
+	for name == "" || strings.Contains(name, "/") {
+		name = askString("Remote name", "")
+	}
+	remote := remotes.NewRemote(name)
+	remote.Protocol = found[0].Protocol
+	remote.Brand = probeOptions.Brand
+	for _, c := range found {
+		if err := remote.AddCommand(names[c], c.Code()); err != nil {
+			log.WithError(err).WithField("command", names[c]).Error("Failed to add command to remote")
+		}
+	}
+
+	store := mustStore()
+	defer store.Close()
+	err = storage.UpdateRemotes(store, lockTimeout, func(rl remotes.RemoteList) (remotes.RemoteList, error) {
+		if rl.Find(name) != nil {
+			return nil, fmt.Errorf("remote %q already exists", name)
+		}
+		return append(rl, remote), nil
+	})
+	if err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Failed to save remotes")
+	}
+	log.WithFields(log.Fields{
+		"remote":   name,
+		"protocol": remote.Protocol,
+		"address":  fmt.Sprintf("0x%02x", found[0].Address),
+		"commands": strings.Join(remote.CommandNames(), ", "),
+	}).Info("Saved remote")
+}
@@ -5,7 +5,7 @@ import (
 	"os"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -17,32 +17,39 @@ var cmdRoot = &cobra.Command{
 var remotesFile string
 var devicesFile string
 var udpTimeout time.Duration
+var lockTimeout time.Duration
 
 func init() {
-	log.SetFormatter(&log.TextFormatter{
-		DisableTimestamp: true,
-	})
-
 	flags := cmdRoot.PersistentFlags()
 	flags.StringVarP(&remotesFile,
 		"remotes-file",
 		"f",
 		"remotes.json",
-		"Filename where remotes IR codes are loaded and saved.")
+		"Filename where remotes IR codes are loaded and saved, as JSON, YAML (.yaml or .yml) or TOML (.toml).")
 
 	flags.StringVarP(&devicesFile,
 		"devices-file",
 		"d",
 		"devices.json",
-		"Filename where Broadlink devices information are loaded and saved.")
+		"Filename where Broadlink devices information are loaded and saved, as JSON, YAML (.yaml or .yml) or TOML (.toml).")
 
 	flags.DurationVar(&udpTimeout,
 		"udp-timeout",
 		1*time.Second,
 		"Amount of time to wait for an answer from Broadlink device.")
 
-	_ = cobra.MarkFlagFilename(flags, "devices-file", "json")
-	_ = cobra.MarkFlagFilename(flags, "remotes-file", "json")
+	flags.IntVar(&utils.Backups,
+		"backups",
+		utils.Backups,
+		"Number of previous versions kept when saving a file, as <file>.1 (most recent) to <file>.N.")
+
+	flags.DurationVar(&lockTimeout,
+		"lock-timeout",
+		10*time.Second,
+		"Amount of time to wait for another ir-remotes process to release a file before updating it.")
+
+	_ = cobra.MarkFlagFilename(flags, "devices-file", "json", "yaml", "yml", "toml")
+	_ = cobra.MarkFlagFilename(flags, "remotes-file", "json", "yaml", "yml", "toml")
 }
 
 func Root() *cobra.Command {
@@ -1,14 +1,25 @@
 package cmd
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github.com/j-vizcaino/ir-remotes/pkg/assets/config"
 	"github.com/j-vizcaino/ir-remotes/pkg/assets/ui"
+	"github.com/j-vizcaino/ir-remotes/pkg/auth"
 	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/events"
+	"github.com/j-vizcaino/ir-remotes/pkg/homekit"
+	"github.com/j-vizcaino/ir-remotes/pkg/mqtt"
 	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
-	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+	"github.com/j-vizcaino/ir-remotes/pkg/rooms"
+	"github.com/j-vizcaino/ir-remotes/pkg/scheduler"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,6 +35,7 @@ var (
 	}
 	listenAddress string
 	assetsUIDir   string
+	schedulesFile string
 )
 
 const (
@@ -34,10 +46,49 @@ func init() {
 	flags := cmdServer.Flags()
 	flags.StringVarP(&listenAddress, "listen-address", "l", ":8080", "Server listen address")
 	flags.StringVar(&assetsUIDir, "assets-ui-dir", "", "Location of web frontend assets directory.")
+	flags.StringVar(&schedulesFile, "schedules-file", "schedules.json", "Filename where scheduled commands are loaded and saved.")
+	_ = cobra.MarkFlagFilename(flags, "schedules-file", "json")
 
 	cmdRoot.AddCommand(cmdServer)
 }
 
+// requestIDHeader carries the request ID, which clients may set to trace their requests
+const requestIDHeader = "X-Request-ID"
+
+// requestIDMiddleWare identifies the request, using the ID sent by the client when valid.
+// The ID is sent back in the response, and logged along with every device send of the request.
+func requestIDMiddleWare(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	c.Set(requestIDKey, id)
+	c.Header(requestIDHeader, id)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// requestID returns the ID of the request, set by requestIDMiddleWare.
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
 func loggerMiddleWare(c *gin.Context) {
 	// Start timer
 	start := time.Now()
@@ -48,6 +99,7 @@ func loggerMiddleWare(c *gin.Context) {
 	c.Next()
 
 	latency := time.Since(start)
+	observeRequest(c, latency.Seconds())
 
 	clientIP := c.ClientIP()
 	method := c.Request.Method
@@ -56,46 +108,97 @@ func loggerMiddleWare(c *gin.Context) {
 	if raw != "" {
 		path = path + "?" + raw
 	}
-	log.WithFields(log.Fields{
-		"method":    method,
-		"url":       path,
-		"code":      statusCode,
-		"client_ip": clientIP,
-		"duration":  latency,
-	}).Infof("%3d - %-5s %s", statusCode, method, path)
+	logger := subsystemLog(logHTTP).WithFields(log.Fields{
+		"method":     method,
+		"url":        path,
+		"code":       statusCode,
+		"client_ip":  clientIP,
+		"duration":   latency,
+		"request_id": requestID(c),
+	})
+	if p := principal(c); p != nil {
+		logger = logger.WithField("principal", p.Name)
+	}
+	if username, found := c.Get(attemptedUserKey); found {
+		logger = logger.WithField("attempted_user", username)
+	}
+	if reason, denied := c.Get(deniedKey); denied {
+		logger.WithField("reason", reason).Warnf("%3d - %-5s %s - access denied", statusCode, method, path)
+		return
+	}
+	logger.Infof("%3d - %-5s %s", statusCode, method, path)
 }
 
 type Handler struct {
+	store *storage.TemplateStore
+	// remoteList and deviceInfoList are replaced, never modified in place, when edited or reloaded
+	configMutex    sync.RWMutex
 	deviceInfoList devices.DeviceInfoList
 	remoteList     remotes.RemoteList
+	revision       configRevision
+	// aliases are the global command aliases, loaded on start
+	aliases remotes.Aliases
+	// reloadMutex serializes configuration reloads and edits
+	reloadMutex   sync.Mutex
+	climateStates *climateStates
+	scheduler     *scheduler.Scheduler
+	mqttBridge    *mqtt.Bridge
+	homekitBridge *homekit.Bridge
+	authenticator *auth.Authenticator
+	events        *events.Bus
+	deviceStates  deviceStates
 }
 
 func mustHandler() *Handler {
-	devInfoList := devices.DeviceInfoList{}
-	if err := utils.LoadFromFilesystem(&devInfoList, config.Assets, devicesFile); err != nil {
-		log.WithError(err).WithField("devices-file", devicesFile).Fatal("Failed to load devices from file.")
+	s := mustOpenStore()
+	if js, ok := s.(*storage.JSONStore); ok {
+		// Default files may be embedded in the binary, used until the files are saved
+		js.Defaults = config.Assets
 	}
-	if len(devInfoList) == 0 {
-		log.WithField("devices-file", devicesFile).Fatal("No device listed in file. Aborting.")
+	store := withLibrary(s)
+
+	devInfoList, err := store.LoadDevices()
+	if err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Failed to load devices.")
 	}
-	if err := devInfoList.InitializeDevices(udpTimeout); err != nil {
-		log.WithError(err).Fatal("Failed to initialize a Broadlink device")
+	if err := initDevices(devInfoList, nil); err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Failed to initialize devices. Aborting.")
 	}
 
-	remoteList := remotes.RemoteList{}
-	if err := utils.LoadFromFilesystem(&remoteList, config.Assets, remotesFile); err != nil {
-		log.WithError(err).WithField("remotes-file", remotesFile).Fatal("Failed to load remotes from file")
+	remoteList, err := store.LoadRemotes()
+	if err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Failed to load remotes")
 	}
-	if len(remoteList) == 0 {
-		log.WithField("remotes-file", remotesFile).Fatal("No remote listed in file. Aborting.")
+	if err := validateRemotes(remoteList); err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Invalid remotes. Aborting.")
 	}
 
+	// Remotes are validated already
+	climateStates, _ := newClimateStates(remoteList)
+
 	return &Handler{
+		store:          store,
+		aliases:        mustAliases(),
 		deviceInfoList: devInfoList,
 		remoteList:     remoteList,
+		revision: configRevision{
+			Revision:    1,
+			RemotesHash: configHash(remoteList),
+			DevicesHash: configHash(devInfoList),
+			LoadedAt:    time.Now(),
+		},
+		climateStates: climateStates,
+		events:        events.NewBus(),
 	}
 }
 
+// currentRemotes returns the remotes, which must not be modified.
+func (h *Handler) currentRemotes() remotes.RemoteList {
+	h.configMutex.RLock()
+	defer h.configMutex.RUnlock()
+	return h.remoteList
+}
+
 func (h *Handler) abortNotFound(c *gin.Context, err string) {
 	h.abort(c, http.StatusNotFound, err)
 }
@@ -112,11 +215,22 @@ func (h *Handler) abort(c *gin.Context, code int, err string) {
 }
 
 func (h *Handler) getDevices(c *gin.Context) {
-	c.IndentedJSON(http.StatusOK, h.deviceInfoList)
+	p := principal(c)
+	if p == nil {
+		c.IndentedJSON(http.StatusOK, h.currentDevices())
+		return
+	}
+	out := devices.DeviceInfoList{}
+	for _, d := range h.currentDevices() {
+		if p.CanAccessDevice(d.Name) {
+			out = append(out, d)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, out)
 }
 
 func (h *Handler) helperGetDevice(c *gin.Context, devName string) *devices.DeviceInfo {
-	devInfo, found := h.deviceInfoList.Find(devices.ByName(devName))
+	devInfo, found := h.currentDevices().Find(devices.ByName(devName))
 	if !found {
 		h.abortNotFound(c, fmt.Sprintf("no such device named %q", devName))
 		return nil
@@ -134,12 +248,23 @@ func (h *Handler) getDevice(c *gin.Context) {
 }
 
 func (h *Handler) getRemotes(c *gin.Context) {
-	c.IndentedJSON(http.StatusOK, h.remoteList.Names())
+	p := principal(c)
+	if p == nil {
+		c.IndentedJSON(http.StatusOK, h.currentRemotes().Names())
+		return
+	}
+	out := []string{}
+	for _, name := range h.currentRemotes().Names() {
+		if p.CanAccessRemote(name) {
+			out = append(out, name)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, out)
 }
 
 func (h *Handler) helperGetRemote(c *gin.Context) *remotes.Remote {
 	name := c.Param("remote")
-	remote := h.remoteList.Find(name)
+	remote := h.currentRemotes().Find(name)
 	if remote == nil {
 		h.abortNotFound(c, fmt.Sprintf("no such remote named %q", name))
 	}
@@ -151,38 +276,219 @@ func (h *Handler) getRemote(c *gin.Context) {
 	if r == nil {
 		return
 	}
+	c.Header("ETag", remoteETag(r))
 	c.IndentedJSON(http.StatusOK, r)
 }
 
-func (h *Handler) postRemoteCommand(c *gin.Context) {
-	remote := h.helperGetRemote(c)
-	if remote == nil {
+// getRemoteLayout returns the layout of the remote, or the default one listing every command.
+func (h *Handler) getRemoteLayout(c *gin.Context) {
+	r := h.helperGetRemote(c)
+	if r == nil {
 		return
 	}
+	c.IndentedJSON(http.StatusOK, r.ButtonLayout())
+}
+
+// notFoundError is returned when a remote, command or device does not exist.
+type notFoundError string
 
-	name := c.Param("command")
-	cmd, ok := remote.Commands[name]
-	if !ok {
-		h.abortNotFound(c, fmt.Sprintf("remote %q has no command %q", remote.Name, name))
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+// findTargetDevice returns the device with the given name, or the first device when name is empty.
+func (h *Handler) findTargetDevice(devName string) (*devices.DeviceInfo, error) {
+	if devName == "" {
+		return h.currentDevices()[0], nil
+	}
+	devInfo, found := h.currentDevices().Find(devices.ByName(devName))
+	if !found {
+		return nil, notFoundError(fmt.Sprintf("no such device named %q", devName))
+	}
+	return devInfo, nil
+}
+
+// sendRequest tells how to send a command.
+type sendRequest struct {
+	// Devices are the names of the devices sending the command, the devices of the remote room when empty.
+	Devices []string
+	// Broadcast sends with every device of the remote room.
+	Broadcast bool
+	// AllowPartial makes the send succeed when any device succeeds, instead of every device.
+	AllowPartial bool
+	// Count is the number of times the command is repeated.
+	Count int
+	// Caller identifies who sent the command, in events.
+	Caller string
+	// RequestID identifies the HTTP request or MQTT message sending the command, in logs and events. Empty for other callers.
+	RequestID string
+}
+
+// findRemoteDevices returns the devices sending the commands of the remote: the devices with the given names,
+// or the devices of the remote room when none is given. With broadcast, every device of the room is returned.
+func (h *Handler) findRemoteDevices(remote *remotes.Remote, devNames []string, broadcast bool) (devices.DeviceInfoList, error) {
+	if len(devNames) == 0 {
+		targets, err := rooms.Targets(remote, h.currentDevices(), h.deviceStates.available, broadcast)
+		if err != nil {
+			return nil, notFoundError(err.Error())
+		}
+		return targets, nil
+	}
+	targets := devices.DeviceInfoList{}
+	for _, name := range devNames {
+		devInfo, err := h.findTargetDevice(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, found := targets.Find(devices.ByName(name)); !found {
+			targets = append(targets, devInfo)
+		}
+	}
+	return targets, nil
+}
+
+// routedDevices returns the names of the devices sending the commands of the remote, when no device is requested.
+func (h *Handler) routedDevices(remoteName string, broadcast bool) []string {
+	remote := h.currentRemotes().Find(remoteName)
+	if remote == nil {
+		return []string{h.currentDevices()[0].Name}
+	}
+	targets, _ := rooms.Targets(remote, h.currentDevices(), h.deviceStates.available, broadcast)
+	names := make([]string, len(targets))
+	for idx, d := range targets {
+		names[idx] = d.Name
+	}
+	return names
+}
+
+// sendToDevices sends the IR code with every device concurrently, then returns the result of every device.
+func (h *Handler) sendToDevices(targets devices.DeviceInfoList, remoteName string, cmdName string, code []byte, req sendRequest) (devices.SendResults, error) {
+	results := targets.FanOut(func(devInfo *devices.DeviceInfo) error {
+		return h.sendIRCode(devInfo, remoteName, cmdName, code, req)
+	})
+	if len(targets) > 1 {
+		for _, r := range results {
+			if !r.Success {
+				subsystemLog(logDevice).WithFields(log.Fields{
+					"device":     r.Device,
+					"remote":     remoteName,
+					"command":    cmdName,
+					"caller":     req.Caller,
+					"error":      r.Error,
+					"request_id": req.RequestID,
+				}).Warn("Failed to send IR code with one of the devices")
+			}
+		}
+	}
+	if err := results.Err(req.AllowPartial); err != nil {
+		return results, fmt.Errorf("IR code send failure: %s", err)
+	}
+	return results, nil
+}
+
+// findCommand returns the remote and the name of the command matching cmdName, which may be an alias.
+func (h *Handler) findCommand(remoteName string, cmdName string) (*remotes.Remote, string, error) {
+	remote := h.currentRemotes().Find(remoteName)
+	if remote == nil {
+		return nil, "", notFoundError(fmt.Sprintf("no such remote named %q", remoteName))
+	}
+	name, found := remote.Lookup(cmdName, h.aliases)
+	if !found {
+		return nil, "", notFoundError(commandNotFound(remote, cmdName))
+	}
+	return remote, name, nil
+}
+
+// commandNotFound returns the error message of a missing command, suggesting close command names.
+func commandNotFound(remote *remotes.Remote, cmdName string) string {
+	message := fmt.Sprintf("remote %q has no command %q", remote.Name, cmdName)
+	suggestions := remote.Suggest(cmdName)
+	if len(suggestions) == 0 {
+		return message
+	}
+	quoted := make([]string, len(suggestions))
+	for idx, s := range suggestions {
+		quoted[idx] = strconv.Quote(s)
+	}
+	return fmt.Sprintf("%s, did you mean %s?", message, strings.Join(quoted, " or "))
+}
+
+// sendCommand sends the IR command of the remote, as requested. The command may be an alias.
+// This is the send path shared by every way of triggering a command.
+// Results are returned once the command was sent, even when sending failed.
+func (h *Handler) sendCommand(remoteName string, cmdName string, req sendRequest) (devices.SendResults, error) {
+	remote, cmdName, err := h.findCommand(remoteName, cmdName)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := h.findRemoteDevices(remote, req.Devices, req.Broadcast)
+	if err != nil {
+		return nil, err
+	}
+	return h.sendToDevices(targets, remoteName, cmdName, remote.Commands[cmdName], req)
+}
+
+// abortError aborts the request, using the HTTP status code matching the error.
+func (h *Handler) abortError(c *gin.Context, err error) {
+	if _, ok := err.(notFoundError); ok {
+		h.abortNotFound(c, err.Error())
 		return
 	}
+	if e, ok := err.(statusError); ok {
+		h.abort(c, e.code, e.message)
+		return
+	}
+	h.abort(c, http.StatusInternalServerError, err.Error())
+}
 
-	// Defaults to first device unless told otherwise
-	dev := h.deviceInfoList[0].GetBroadlinkDevice()
+// abortSend aborts the request after sending failed, with the result of every device, if any.
+func (h *Handler) abortSend(c *gin.Context, results devices.SendResults, err error) {
+	if len(results) == 0 {
+		h.abortError(c, err)
+		return
+	}
+	c.Abort()
+	c.IndentedJSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"error":   err.Error(),
+		"results": results,
+	})
+}
 
-	devName, found := c.GetQuery("device")
-	if found {
-		devInfo := h.helperGetDevice(c, devName)
-		if devInfo == nil {
-			return
+// deviceQuery returns the devices listed in the request with ?device=a,b.
+func deviceQuery(c *gin.Context) []string {
+	out := []string{}
+	for _, name := range strings.Split(c.Query("device"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
 		}
-		dev = devInfo.GetBroadlinkDevice()
 	}
-	if err := dev.SendIRRemoteCode(cmd, 1); err != nil {
-		h.abort(c, http.StatusInternalServerError, fmt.Sprintf("IR code send failure: %s", err))
+	return out
+}
+
+// httpSendRequest returns how the request asks to send commands:
+// with the devices listed by ?device=a,b, with every device of the remote room with ?broadcast=true,
+// and succeeding when any device succeeds with ?partial=true.
+func httpSendRequest(c *gin.Context) sendRequest {
+	broadcast, _ := strconv.ParseBool(c.Query("broadcast"))
+	partial, _ := strconv.ParseBool(c.Query("partial"))
+	return sendRequest{
+		Devices:      deviceQuery(c),
+		Broadcast:    broadcast,
+		AllowPartial: partial,
+		Count:        1,
+		Caller:       httpCaller(c),
+		RequestID:    requestID(c),
+	}
+}
+
+func (h *Handler) postRemoteCommand(c *gin.Context) {
+	results, err := h.sendCommand(c.Param("remote"), c.Param("command"), httpSendRequest(c))
+	if err != nil {
+		h.abortSend(c, results, err)
 		return
 	}
-	c.IndentedJSON(http.StatusOK, gin.H{"success": true})
+	c.IndentedJSON(http.StatusOK, gin.H{"success": true, "results": results})
 }
 
 func Server(_ *cobra.Command, _ []string) {
@@ -195,11 +501,28 @@ func Server(_ *cobra.Command, _ []string) {
 	}
 
 	h := mustHandler()
+	h.authenticator = mustAuthenticator()
+	certReloader := mustCertReloader()
+	h.scheduler = mustScheduler(h)
+	// The server runs until killed, scheduler is never stopped
+	go h.scheduler.Run(nil)
+	h.mqttBridge = mustMQTTBridge(h)
+	h.homekitBridge = mustHomeKitBridge(h)
+	go h.watchConfig()
 
 	gin.SetMode(gin.ReleaseMode)
+	r := h.router(uiAssets)
+
+	if err := listenAndServe(r, certReloader); err != nil {
+		log.WithError(err).WithField("listen-address", listenAddress).Fatal("Failed to start server")
+	}
+}
+
+// router returns the routes of the server, serving the UI from uiAssets.
+func (h *Handler) router(uiAssets http.FileSystem) *gin.Engine {
 	r := gin.New()
 	r.HandleMethodNotAllowed = true
-	r.Use(gin.Recovery(), loggerMiddleWare)
+	r.Use(gin.Recovery(), requestIDMiddleWare, loggerMiddleWare)
 
 	r.GET("/", func(c *gin.Context) {
 		c.Redirect(http.StatusPermanentRedirect, uiLocation)
@@ -208,14 +531,32 @@ func Server(_ *cobra.Command, _ []string) {
 	r.StaticFS(uiLocation, uiAssets)
 
 	api := r.Group("/api")
-	api.GET("/devices/", h.getDevices)
-	api.GET("/devices/:device", h.getDevice)
-	api.GET("/remotes/", h.getRemotes)
-	api.GET("/remotes/:remote", h.getRemote)
-	api.POST("/remotes/:remote/:command", h.postRemoteCommand)
-
-	log.WithField("listen-address", listenAddress).Info("Starting HTTP server")
-	if err := r.Run(listenAddress); err != nil {
-		log.WithError(err).WithField("listen-address", listenAddress).Fatal("Failed to start server")
-	}
+	read := h.authorize(auth.RoleReadOnly)
+	operate := h.authorize(auth.RoleOperator)
+	admin := h.authorize(auth.RoleAdmin)
+	r.GET("/metrics", read, h.getMetrics)
+	api.GET("/devices/", read, h.getDevices)
+	api.GET("/devices/:device", read, h.getDevice)
+	api.POST("/devices/:device/capture", admin, h.postDeviceCapture)
+	api.GET("/remotes/", read, h.getRemotes)
+	api.GET("/remotes/:remote", read, h.getRemote)
+	api.GET("/remotes/:remote/layout", read, h.getRemoteLayout)
+	api.POST("/remotes/:remote/:command", operate, h.postRemoteCommand)
+	api.POST("/remotes/", admin, h.postRemote)
+	api.PUT("/remotes/:remote", admin, h.putRemote)
+	api.DELETE("/remotes/:remote", admin, h.deleteRemote)
+	api.PUT("/remotes/:remote/:command", admin, h.putRemoteCommand)
+	api.DELETE("/remotes/:remote/:command", admin, h.deleteRemoteCommand)
+	api.GET("/rooms/", read, h.getRooms)
+	api.GET("/rooms/:room", read, h.getRoom)
+	api.GET("/climate/:remote", read, h.getClimate)
+	api.PUT("/climate/:remote", operate, h.putClimate)
+	api.GET("/schedules/", read, h.getSchedules)
+	api.POST("/schedules/", admin, h.postSchedule)
+	api.DELETE("/schedules/:schedule", admin, h.deleteSchedule)
+	api.GET("/schedules/executions", read, h.getScheduleExecutions)
+	api.GET("/events", read, h.getEvents)
+	api.GET("/config", read, h.getConfig)
+	api.POST("/config/reload", admin, h.postConfigReload)
+	return r
 }
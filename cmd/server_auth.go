@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/auth"
+)
+
+const (
+	// Context keys, read by loggerMiddleWare
+	principalKey = "principal"
+	deniedKey    = "denied"
+	requestIDKey = "request_id"
+	// attemptedUserKey is the username of failed basic authentications, which is not a principal
+	attemptedUserKey = "attempted_user"
+)
+
+var authFile string
+
+func init() {
+	flags := cmdServer.Flags()
+	flags.StringVar(&authFile, "auth-file", "", "File listing API keys and users allowed to call the API. Authentication is disabled when empty.")
+	_ = cobra.MarkFlagFilename(flags, "auth-file", "json")
+}
+
+// mustAuthenticator loads the authentication file, when configured. Returns nil otherwise.
+func mustAuthenticator() *auth.Authenticator {
+	if authFile == "" {
+		log.Warn("No --auth-file provided, the API is open to anyone on the network")
+		return nil
+	}
+	a, err := auth.LoadAuthenticator(authFile)
+	if err != nil {
+		log.WithError(err).WithField("auth-file", authFile).Fatal("Failed to load authentication file")
+	}
+	return a
+}
+
+// principal returns the principal making the request, nil when authentication is disabled.
+func principal(c *gin.Context) *auth.Principal {
+	if p, found := c.Get(principalKey); found {
+		return p.(*auth.Principal)
+	}
+	return nil
+}
+
+// deny aborts the request, recording the reason for loggerMiddleWare.
+func (h *Handler) deny(c *gin.Context, code int, reason string) {
+	c.Set(deniedKey, reason)
+	if code == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="ir-remotes"`)
+	}
+	h.abort(c, code, reason)
+}
+
+// authorize returns a middleware checking the principal has the required role.
+// Remote and device route parameters, and the device query parameter, must be in the principal scopes.
+// Without device given, routes of a remote check the devices sending its commands.
+func (h *Handler) authorize(required auth.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.authenticator == nil {
+			return
+		}
+		p, err := h.authenticator.Authenticate(c.Request)
+		if err != nil {
+			if username, _, ok := c.Request.BasicAuth(); ok {
+				c.Set(attemptedUserKey, username)
+			}
+			h.deny(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if p == nil {
+			h.deny(c, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		c.Set(principalKey, p)
+
+		if !p.Role.Allows(required) {
+			h.deny(c, http.StatusForbidden, fmt.Sprintf("role %q is not allowed, %q required", p.Role, required))
+			return
+		}
+		if remote := c.Param("remote"); remote != "" && !p.CanAccessRemote(remote) {
+			h.deny(c, http.StatusForbidden, fmt.Sprintf("remote %q is out of scope", remote))
+			return
+		}
+		devNames := deviceQuery(c)
+		if device := c.Param("device"); device != "" {
+			devNames = []string{device}
+		}
+		if remote := c.Param("remote"); remote != "" && len(devNames) == 0 && required != auth.RoleReadOnly {
+			// Commands are sent with the devices of the remote room by default
+			devNames = h.routedDevices(remote, httpSendRequest(c).Broadcast)
+		}
+		for _, name := range devNames {
+			if !p.CanAccessDevice(name) {
+				h.deny(c, http.StatusForbidden, fmt.Sprintf("device %q is out of scope", name))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/auth"
+)
+
+func TestAuthorize(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+	g := s.g
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	g.Expect(err).ToNot(HaveOccurred())
+	s.h.authenticator, err = auth.NewAuthenticator(auth.Config{
+		Principals: []auth.Principal{
+			{Name: "reader", Role: auth.RoleReadOnly, APIKey: "read"},
+			{Name: "tv-operator", Role: auth.RoleOperator, APIKey: "operate", Remotes: []string{"tv"}},
+			{Name: "bedroom-admin", Role: auth.RoleAdmin, APIKey: "admin", Devices: []string{"bedroom"}},
+			{Name: "alice", Role: auth.RoleAdmin, Username: "alice", Password: string(hash)},
+		},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// Requests are run in order, schedules and remotes created are kept
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		headers []string
+		code    int
+	}{
+		{"no credentials", http.MethodGet, "/api/remotes/", "", nil, http.StatusUnauthorized},
+		{"unknown API key", http.MethodGet, "/api/remotes/", "", []string{"X-API-Key", "unknown"}, http.StatusUnauthorized},
+		{"wrong password", http.MethodGet, "/api/remotes/", "", []string{"Authorization", basicAuth("alice", "wrong")}, http.StatusUnauthorized},
+		{"unknown username", http.MethodGet, "/api/remotes/", "", []string{"Authorization", basicAuth("bob", "secret")}, http.StatusUnauthorized},
+		{"password", http.MethodGet, "/api/devices/", "", []string{"Authorization", basicAuth("alice", "secret")}, http.StatusOK},
+		{"bearer token", http.MethodGet, "/api/remotes/", "", []string{"Authorization", "Bearer read"}, http.StatusOK},
+
+		{"read-only reads", http.MethodGet, "/api/remotes/tv", "", []string{"X-API-Key", "read"}, http.StatusOK},
+		{"read-only reads metrics", http.MethodGet, "/metrics", "", []string{"X-API-Key", "read"}, http.StatusOK},
+		{"read-only cannot send", http.MethodPost, "/api/remotes/tv/power", "", []string{"X-API-Key", "read"}, http.StatusForbidden},
+		{"read-only cannot reload", http.MethodPost, "/api/config/reload", "", []string{"X-API-Key", "read"}, http.StatusForbidden},
+
+		{"operator out of remote scope", http.MethodPost, "/api/remotes/radio/power", "", []string{"X-API-Key", "operate"}, http.StatusForbidden},
+		{"operator reads out of scope", http.MethodGet, "/api/remotes/radio", "", []string{"X-API-Key", "operate"}, http.StatusForbidden},
+		{"operator cannot edit", http.MethodPut, "/api/remotes/tv", `{"displayName": "TV"}`, []string{"X-API-Key", "operate"}, http.StatusForbidden},
+
+		{"admin out of routed device scope", http.MethodPost, "/api/remotes/tv/power", "", []string{"X-API-Key", "admin"}, http.StatusForbidden},
+		{"admin out of requested device scope", http.MethodPost, "/api/remotes/radio/power?device=office", "", []string{"X-API-Key", "admin"}, http.StatusForbidden},
+		{"admin out of device scope", http.MethodGet, "/api/devices/office", "", []string{"X-API-Key", "admin"}, http.StatusForbidden},
+		{"admin edits remote in scope", http.MethodPut, "/api/remotes/radio", `{"displayName": "Radio"}`, []string{"X-API-Key", "admin"}, http.StatusOK},
+		// Routes without remote are not checked against the devices of a remote
+		{"admin reloads", http.MethodPost, "/api/config/reload", "", []string{"X-API-Key", "admin"}, http.StatusOK},
+		{"admin creates remote", http.MethodPost, "/api/remotes/", `{"name": "fan", "room": "bedroom"}`, []string{"X-API-Key", "admin"}, http.StatusCreated},
+		{"admin creates schedule", http.MethodPost, "/api/schedules/", `{"name": "wake", "cron": "0 7 * * *", "actions": [{"remote": "radio", "command": "power"}]}`, []string{"X-API-Key", "admin"}, http.StatusCreated},
+		{"admin deletes schedule", http.MethodDelete, "/api/schedules/wake", "", []string{"X-API-Key", "admin"}, http.StatusOK},
+		{"admin schedules out of device scope", http.MethodPost, "/api/schedules/", `{"name": "tv", "cron": "0 7 * * *", "actions": [{"remote": "radio", "command": "power", "device": "office"}]}`, []string{"X-API-Key", "admin"}, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		w := s.do(test.method, test.url, test.body, test.headers...)
+		g.Expect(w.Code).To(Equal(test.code), "%s: %s", test.name, w.Body.String())
+		if test.code == http.StatusUnauthorized {
+			g.Expect(w.Header().Get("WWW-Authenticate")).ToNot(BeEmpty(), test.name)
+		}
+	}
+	g.Expect(s.storedRemotes().Names()).To(ConsistOf("tv", "radio", "fan"))
+
+	// Usernames of failed authentications are not logged as principals
+	hook := test.NewLocal(subsystemLoggers[logHTTP])
+	g.Expect(s.do(http.MethodGet, "/api/remotes/", "", "Authorization", basicAuth("bob", "secret")).Code).To(Equal(http.StatusUnauthorized))
+	entry := hook.LastEntry()
+	g.Expect(entry).ToNot(BeNil())
+	g.Expect(entry.Data).ToNot(HaveKey("principal"))
+	g.Expect(entry.Data).To(HaveKeyWithValue("attempted_user", "bob"))
+}
+
+func basicAuth(username string, password string) string {
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth(username, password)
+	return req.Header.Get("Authorization")
+}
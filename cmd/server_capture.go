@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+const (
+	defaultCaptureTimeout = 30 * time.Second
+	// maxCaptureTimeout bounds the time a device is kept in learning mode
+	maxCaptureTimeout = 5 * time.Minute
+)
+
+// captureRequest tells where to store the captured IR code. The code is only returned when remote and command are empty.
+type captureRequest struct {
+	Remote  string `json:"remote"`
+	Command string `json:"command"`
+	// Timeout is a duration, like 45s. Defaults to 30s.
+	Timeout string `json:"timeout"`
+	// Overwrite replaces the code of an existing command, which is a conflict otherwise.
+	Overwrite bool `json:"overwrite"`
+}
+
+type captureResult struct {
+	Code    remotes.IRCommand `json:"code"`
+	Remote  string            `json:"remote,omitempty"`
+	Command string            `json:"command,omitempty"`
+	ETag    string            `json:"etag,omitempty"`
+}
+
+func (r *captureRequest) validate() (time.Duration, error) {
+	if (r.Remote == "") != (r.Command == "") {
+		return 0, fmt.Errorf("remote and command must be given together")
+	}
+	if strings.Contains(r.Remote, "/") {
+		return 0, fmt.Errorf("invalid remote name %q", r.Remote)
+	}
+	if r.Timeout == "" {
+		return defaultCaptureTimeout, nil
+	}
+	timeout, err := time.ParseDuration(r.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout: %s", err)
+	}
+	if timeout <= 0 || timeout > maxCaptureTimeout {
+		return 0, fmt.Errorf("timeout must be between 0 and %s", maxCaptureTimeout)
+	}
+	return timeout, nil
+}
+
+// commandExists returns the conflict error of a captured code replacing the code of an existing command.
+func commandExists(r *remotes.Remote, command string) error {
+	if _, found := r.Commands[command]; !found {
+		return nil
+	}
+	return statusError{http.StatusConflict, fmt.Sprintf("remote %q already has command %q, set overwrite to replace it", r.Name, command)}
+}
+
+// storeCapturedCode adds the code to the remote, which is created when missing.
+// The code of an existing command is only replaced with overwrite.
+func (h *Handler) storeCapturedCode(remoteName string, command string, code remotes.IRCommand, overwrite bool) (*remotes.Remote, error) {
+	return h.editRemotes("", "", func(rl remotes.RemoteList, _ *remotes.Remote) (remotes.RemoteList, *remotes.Remote, error) {
+		var r *remotes.Remote
+		for idx, existing := range rl {
+			if existing.Name == remoteName {
+				r = cloneRemote(existing)
+				rl[idx] = r
+				break
+			}
+		}
+		if r == nil {
+			r = remotes.NewRemote(remoteName)
+			rl = append(rl, r)
+		}
+		if r.IsClimate() {
+			return nil, nil, statusError{http.StatusBadRequest, fmt.Sprintf("commands of climate remote %q are generated", r.Name)}
+		}
+		if !overwrite {
+			if err := commandExists(r, command); err != nil {
+				return nil, nil, err
+			}
+		}
+		r.Commands[command] = code
+		r.Override("commands." + command)
+		return rl, r, nil
+	})
+}
+
+// postDeviceCapture captures an IR code with the device, optionally storing it in a remote.
+// When the client accepts text/event-stream, progress is streamed as server-sent events:
+// "waiting" while the device waits for a button press, then either "captured" or "error".
+func (h *Handler) postDeviceCapture(c *gin.Context) {
+	req := captureRequest{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			h.abort(c, http.StatusBadRequest, fmt.Sprintf("invalid capture request: %s", err))
+			return
+		}
+	}
+	timeout, err := req.validate()
+	if err != nil {
+		h.abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if p := principal(c); p != nil && req.Remote != "" && !p.CanAccessRemote(req.Remote) {
+		h.deny(c, http.StatusForbidden, fmt.Sprintf("remote %q is out of scope", req.Remote))
+		return
+	}
+	if r := h.currentRemotes().Find(req.Remote); r != nil {
+		if r.IsClimate() {
+			h.abort(c, http.StatusBadRequest, fmt.Sprintf("commands of climate remote %q are generated", r.Name))
+			return
+		}
+		// Checked again when storing the code, the command may be added meanwhile
+		if err := commandExists(r, req.Command); err != nil && !req.Overwrite {
+			h.abortError(c, err)
+			return
+		}
+	}
+	devInfo := h.helperGetDevice(c, c.Param("device"))
+	if devInfo == nil {
+		return
+	}
+
+	stream := strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+	fail := func(code int, err error) {
+		if stream {
+			c.SSEvent("error", gin.H{"error": err.Error()})
+			return
+		}
+		h.abort(c, code, err.Error())
+	}
+
+	logger := subsystemLog(logCapture).WithFields(log.Fields{
+		"device":     devInfo.Name,
+		"remote":     req.Remote,
+		"command":    req.Command,
+		"request_id": requestID(c),
+	})
+	var waiting func(time.Duration)
+	if stream {
+		c.Header("Cache-Control", "no-cache")
+		waiting = func(remaining time.Duration) {
+			c.SSEvent("waiting", gin.H{"remaining": remaining.Seconds()})
+			c.Writer.Flush()
+		}
+	}
+	logger.Info("Waiting for IR code captured over HTTP")
+	code, err := devInfo.CaptureIRCode(timeout, c.Request.Context().Done(), waiting)
+	switch {
+	case err == devices.ErrCaptureCanceled:
+		logger.Info("IR code capture canceled by client")
+		return
+	case err == devices.ErrCaptureTimeout:
+		fail(http.StatusGatewayTimeout, err)
+		return
+	case err != nil:
+		logger.WithError(err).Error("Failed to capture IR code")
+		fail(http.StatusInternalServerError, err)
+		return
+	}
+
+	result := captureResult{Code: code}
+	if req.Remote != "" {
+		r, err := h.storeCapturedCode(req.Remote, req.Command, code, req.Overwrite)
+		if err != nil && stream {
+			fail(http.StatusInternalServerError, err)
+			return
+		}
+		if err != nil {
+			h.abortError(c, err)
+			return
+		}
+		result.Remote = r.Name
+		result.Command = req.Command
+		result.ETag = remoteETag(r)
+	}
+	logger.Info("IR code captured over HTTP")
+
+	if stream {
+		c.SSEvent("captured", result)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, result)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+func TestStoreCapturedCode(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+	g := s.g
+
+	// Existing commands are only replaced on request, before waiting for a button press
+	w := s.do(http.MethodPost, "/api/devices/office/capture", `{"remote": "tv", "command": "power"}`)
+	g.Expect(w.Code).To(Equal(http.StatusConflict), w.Body.String())
+
+	_, err := s.h.storeCapturedCode("tv", "power", remotes.IRCommand{0x26, 0x00, 0x02}, false)
+	g.Expect(err).To(MatchError(`remote "tv" already has command "power", set overwrite to replace it`))
+	g.Expect(s.storedRemotes().Find("tv").Commands["power"]).ToNot(Equal(remotes.IRCommand{0x26, 0x00, 0x02}))
+
+	_, err = s.h.storeCapturedCode("tv", "power", remotes.IRCommand{0x26, 0x00, 0x02}, true)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(s.storedRemotes().Find("tv").Commands["power"]).To(Equal(remotes.IRCommand{0x26, 0x00, 0x02}))
+
+	// New commands and remotes are added
+	_, err = s.h.storeCapturedCode("tv", "input", remotes.IRCommand{0x26, 0x00, 0x03}, false)
+	g.Expect(err).ToNot(HaveOccurred())
+	r, err := s.h.storeCapturedCode("fan", "power", remotes.IRCommand{0x26, 0x00, 0x04}, false)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.Name).To(Equal("fan"))
+	g.Expect(s.storedRemotes().Find("tv").CommandNames()).To(ConsistOf("power", "mute", "input"))
+	g.Expect(s.storedRemotes().Find("fan").Commands["power"]).To(Equal(remotes.IRCommand{0x26, 0x00, 0x04}))
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/climate"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// climateStates keeps track of the last state sent to every climate remote.
+type climateStates struct {
+	sync.Mutex
+	states map[string]climate.State
+}
+
+func newClimateStates(remoteList remotes.RemoteList) (*climateStates, error) {
+	cs := &climateStates{
+		states: make(map[string]climate.State),
+	}
+	for _, r := range remoteList {
+		if !r.IsClimate() {
+			continue
+		}
+		p, found := climate.Find(r.Protocol)
+		if !found {
+			return nil, fmt.Errorf("remote %q uses unsupported climate protocol %q (expected one of %v)", r.Name, r.Protocol, climate.ProtocolNames())
+		}
+		cs.states[r.Name] = p.Capabilities().DefaultState()
+	}
+	return cs, nil
+}
+
+func (cs *climateStates) get(name string) climate.State {
+	cs.Lock()
+	defer cs.Unlock()
+	return cs.states[name]
+}
+
+func (cs *climateStates) set(name string, s climate.State) {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.states[name] = s
+}
+
+// rename keeps the last state of a renamed remote.
+func (cs *climateStates) rename(oldName string, newName string) {
+	cs.Lock()
+	defer cs.Unlock()
+	if s, found := cs.states[oldName]; found {
+		cs.states[newName] = s
+		delete(cs.states, oldName)
+	}
+}
+
+func (cs *climateStates) remove(name string) {
+	cs.Lock()
+	defer cs.Unlock()
+	delete(cs.states, name)
+}
+
+// update tracks the climate remotes of the new list: states of remotes that still exist are kept.
+func (cs *climateStates) update(remoteList remotes.RemoteList) {
+	cs.Lock()
+	defer cs.Unlock()
+	states := make(map[string]climate.State)
+	for _, r := range remoteList {
+		if !r.IsClimate() {
+			continue
+		}
+		p, found := climate.Find(r.Protocol)
+		if !found {
+			continue
+		}
+		if s, found := cs.states[r.Name]; found {
+			states[r.Name] = s
+		} else {
+			states[r.Name] = p.Capabilities().DefaultState()
+		}
+	}
+	cs.states = states
+}
+
+func (h *Handler) helperGetClimateRemote(c *gin.Context) (*remotes.Remote, climate.Protocol) {
+	remote := h.helperGetRemote(c)
+	if remote == nil {
+		return nil, nil
+	}
+	if !remote.IsClimate() {
+		h.abortNotFound(c, fmt.Sprintf("remote %q is not a climate remote", remote.Name))
+		return nil, nil
+	}
+	// Protocol existence is checked when loading remotes
+	p, _ := climate.Find(remote.Protocol)
+	return remote, p
+}
+
+func (h *Handler) getClimate(c *gin.Context) {
+	remote, p := h.helperGetClimateRemote(c)
+	if remote == nil {
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"name":         remote.Name,
+		"protocol":     p.Name(),
+		"capabilities": p.Capabilities(),
+		"state":        h.climateStates.get(remote.Name),
+	})
+}
+
+func (h *Handler) putClimate(c *gin.Context) {
+	remote, p := h.helperGetClimateRemote(c)
+	if remote == nil {
+		return
+	}
+
+	// Fields missing from the request keep their last known value
+	state := h.climateStates.get(remote.Name)
+	if err := c.ShouldBindJSON(&state); err != nil {
+		h.abort(c, http.StatusBadRequest, fmt.Sprintf("invalid climate state: %s", err))
+		return
+	}
+
+	cmd, err := climate.Encode(p, state)
+	if err != nil {
+		h.abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := httpSendRequest(c)
+	targets, err := h.findRemoteDevices(remote, req.Devices, req.Broadcast)
+	if err != nil {
+		h.abortError(c, err)
+		return
+	}
+	results, err := h.sendToDevices(targets, remote.Name, "state", cmd, req)
+	if err != nil {
+		h.abortSend(c, results, err)
+		return
+	}
+	h.climateStates.set(remote.Name, state)
+	c.IndentedJSON(http.StatusOK, gin.H{"success": true, "state": state, "results": results})
+}
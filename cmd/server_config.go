@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/events"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
+)
+
+var configPollInterval time.Duration
+
+func init() {
+	flags := cmdServer.Flags()
+	flags.DurationVar(&configPollInterval, "config-poll-interval", 2*time.Second, "Interval between checks of the remotes and devices storage, which are reloaded when modified. Zero disables the checks, they are still reloaded on SIGHUP.")
+}
+
+// Configuration names, in config events
+const (
+	configRemotes = "remotes"
+	configDevices = "devices"
+)
+
+// configRevision identifies the active remotes and devices configuration.
+type configRevision struct {
+	// Revision is incremented every time the configuration changes.
+	Revision    int       `json:"revision"`
+	RemotesHash string    `json:"remotesHash"`
+	DevicesHash string    `json:"devicesHash"`
+	LoadedAt    time.Time `json:"loadedAt"`
+	// LastError is the reason the last reload failed, cleared on success.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// configHash identifies the content of remotes or devices, using its JSON encoding.
+func configHash(obj interface{}) string {
+	raw, _ := json.Marshal(obj)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:16])
+}
+
+// validateRemotes checks the loaded remotes can be served.
+// Stored content, like remote names, is already validated when loaded.
+func validateRemotes(remoteList remotes.RemoteList) error {
+	if len(remoteList) == 0 {
+		return fmt.Errorf("no remote listed")
+	}
+	_, err := newClimateStates(remoteList)
+	return err
+}
+
+// initDevices checks and initializes the loaded devices.
+// Devices of the current list which did not change are kept as is, since they are already initialized.
+func initDevices(devInfoList devices.DeviceInfoList, current devices.DeviceInfoList) error {
+	if len(devInfoList) == 0 {
+		return fmt.Errorf("no device listed")
+	}
+	names := make(map[string]bool)
+	for idx, d := range devInfoList {
+		if names[d.Name] {
+			return fmt.Errorf("duplicate device %q", d.Name)
+		}
+		names[d.Name] = true
+
+		existing, found := current.Find(devices.ByName(d.Name))
+		if found && existing.MACAddress == d.MACAddress && existing.UDPAddress == d.UDPAddress && existing.Type == d.Type && existing.Room == d.Room {
+			devInfoList[idx] = existing
+		}
+	}
+	return devInfoList.InitializeDevices(udpTimeout)
+}
+
+// currentDevices returns the devices, which must not be modified.
+func (h *Handler) currentDevices() devices.DeviceInfoList {
+	h.configMutex.RLock()
+	defer h.configMutex.RUnlock()
+	return h.deviceInfoList
+}
+
+// reloadConfig loads the remotes and devices again, when modified.
+// The new configuration is fully validated before being used: on failure, the current configuration is kept.
+func (h *Handler) reloadConfig(source string) (bool, error) {
+	h.reloadMutex.Lock()
+	defer h.reloadMutex.Unlock()
+	return h.reloadConfigLocked(source)
+}
+
+// reloadConfigLocked is reloadConfig, called with reloadMutex held.
+func (h *Handler) reloadConfigLocked(source string) (reloaded bool, err error) {
+	defer func() {
+		if reloaded || err != nil {
+			configReloads.Inc(source, resultLabel(err))
+		}
+	}()
+	loadedRemotes, err := h.store.LoadRemotes()
+	if err != nil {
+		return false, h.reloadFailed(fmt.Errorf("failed to load remotes, %s", err))
+	}
+	loadedDevices, err := h.store.LoadDevices()
+	if err != nil {
+		return false, h.reloadFailed(fmt.Errorf("failed to load devices, %s", err))
+	}
+	remotesHash := configHash(loadedRemotes)
+	devicesHash := configHash(loadedDevices)
+
+	h.configMutex.RLock()
+	remotesChanged := remotesHash != h.revision.RemotesHash
+	devicesChanged := devicesHash != h.revision.DevicesHash
+	remoteList := h.remoteList
+	devInfoList := h.deviceInfoList
+	h.configMutex.RUnlock()
+	if !remotesChanged && !devicesChanged {
+		return false, nil
+	}
+
+	if remotesChanged {
+		if err := validateRemotes(loadedRemotes); err != nil {
+			return false, h.reloadFailed(fmt.Errorf("invalid remotes, %s", err))
+		}
+		remoteList = loadedRemotes
+	}
+	if devicesChanged {
+		if err := initDevices(loadedDevices, devInfoList); err != nil {
+			return false, h.reloadFailed(fmt.Errorf("invalid devices, %s", err))
+		}
+		devInfoList = loadedDevices
+	}
+
+	h.configMutex.Lock()
+	h.remoteList = remoteList
+	h.deviceInfoList = devInfoList
+	h.revision.Revision++
+	h.revision.RemotesHash = remotesHash
+	h.revision.DevicesHash = devicesHash
+	h.revision.LoadedAt = time.Now()
+	h.revision.LastError = ""
+	h.configMutex.Unlock()
+
+	if remotesChanged {
+		h.climateStates.update(remoteList)
+		h.events.Publish(events.TypeConfig, events.ConfigData{File: configRemotes, Source: source})
+	}
+	if devicesChanged {
+		h.events.Publish(events.TypeConfig, events.ConfigData{File: configDevices, Source: source})
+	}
+	return true, nil
+}
+
+func (h *Handler) reloadFailed(err error) error {
+	h.configMutex.Lock()
+	defer h.configMutex.Unlock()
+	h.revision.LastError = err.Error()
+	return err
+}
+
+// watchConfig reloads the configuration on SIGHUP and when the storage is modified.
+func (h *Handler) watchConfig() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	var poll <-chan time.Time
+	if configPollInterval > 0 {
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	// Failures are logged once, until the content changes again
+	lastError := ""
+	// Polls only load the storage once modified, unless it does not tell
+	var lastModTime time.Time
+	for {
+		source := "reload"
+		select {
+		case <-signals:
+			source = "signal"
+			lastError = ""
+		case <-poll:
+			if !h.configModified(&lastModTime) {
+				continue
+			}
+		}
+
+		reloaded, err := h.reloadConfig(source)
+		switch {
+		case err != nil && err.Error() != lastError:
+			log.WithError(err).Error("Failed to reload configuration, keeping the current one")
+			lastError = err.Error()
+		case reloaded:
+			log.WithField("revision", h.configRevision().Revision).Info("Configuration reloaded")
+			lastError = ""
+		}
+	}
+}
+
+// configModified tells whether the storage was modified since lastModTime, which is updated.
+// Storages which do not tell, or fail to, are always considered modified.
+func (h *Handler) configModified(lastModTime *time.Time) bool {
+	modTime, known, err := storage.ModTime(h.store)
+	if err != nil || !known {
+		return true
+	}
+	if modTime.Equal(*lastModTime) {
+		return false
+	}
+	*lastModTime = modTime
+	return true
+}
+
+func (h *Handler) configRevision() configRevision {
+	h.configMutex.RLock()
+	defer h.configMutex.RUnlock()
+	return h.revision
+}
+
+func (h *Handler) getConfig(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, h.configRevision())
+}
+
+func (h *Handler) postConfigReload(c *gin.Context) {
+	if _, err := h.reloadConfig("api"); err != nil {
+		h.abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.IndentedJSON(http.StatusOK, h.configRevision())
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/events"
+)
+
+// eventsKeepAlive is the interval of comments sent on idle event streams, so that proxies keep them open
+const eventsKeepAlive = 30 * time.Second
+
+// deviceStates tracks device availability, so that only transitions are published.
+// Devices are all available when the server starts, since they are initialized.
+type deviceStates struct {
+	sync.Mutex
+	unavailable map[string]bool
+}
+
+// update records the result of a device call, returning true when availability changed.
+func (ds *deviceStates) update(name string, err error) bool {
+	ds.Lock()
+	defer ds.Unlock()
+	if ds.unavailable == nil {
+		ds.unavailable = make(map[string]bool)
+	}
+	unavailable := err != nil
+	if ds.unavailable[name] == unavailable {
+		return false
+	}
+	ds.unavailable[name] = unavailable
+	return true
+}
+
+func (ds *deviceStates) available(name string) bool {
+	ds.Lock()
+	defer ds.Unlock()
+	return !ds.unavailable[name]
+}
+
+// httpCaller identifies the HTTP client, for command events.
+func httpCaller(c *gin.Context) string {
+	if p := principal(c); p != nil {
+		return "http:" + p.Name
+	}
+	return "http:" + c.ClientIP()
+}
+
+// sendIRCode sends the code with the device, as requested, publishing the matching command and device events.
+func (h *Handler) sendIRCode(devInfo *devices.DeviceInfo, remoteName string, cmdName string, code []byte, req sendRequest) error {
+	start := time.Now()
+	err := devInfo.SendIRCode(code, req.Count)
+	latency := time.Since(start)
+	commandsSent.Inc(remoteName, cmdName, devInfo.Name, resultLabel(err))
+	sendDuration.Observe(latency.Seconds(), devInfo.Name)
+
+	logger := subsystemLog(logDevice).WithFields(log.Fields{
+		"device":     devInfo.Name,
+		"remote":     remoteName,
+		"command":    cmdName,
+		"caller":     req.Caller,
+		"request_id": req.RequestID,
+		"duration":   latency,
+	})
+	if err != nil {
+		logger.WithError(err).Warn("Failed to send IR code")
+		// The device may have rebooted, losing the authentication: the next command succeeds once authenticated again.
+		// The command is not sent again, since it may have been received already.
+		authErr := devInfo.Reauthenticate(udpTimeout)
+		deviceAuthRetries.Inc(devInfo.Name, resultLabel(authErr))
+		if authErr != nil {
+			logger.WithError(authErr).Warn("Failed to authenticate with device again")
+		} else {
+			logger.Info("Authenticated with device again")
+		}
+	} else {
+		logger.Debug("Sent IR code")
+	}
+
+	data := events.CommandData{
+		Remote:    remoteName,
+		Command:   cmdName,
+		Device:    devInfo.Name,
+		Caller:    req.Caller,
+		RequestID: req.RequestID,
+		Success:   err == nil,
+		Latency:   latency.Seconds() * 1000,
+	}
+	if err != nil {
+		data.Error = err.Error()
+	}
+	h.events.Publish(events.TypeCommand, data)
+
+	if h.deviceStates.update(devInfo.Name, err) {
+		device := events.DeviceData{Device: devInfo.Name, Available: err == nil}
+		if err != nil {
+			device.Error = err.Error()
+		}
+		h.events.Publish(events.TypeDevice, device)
+	}
+	return err
+}
+
+// visible tells whether the principal, if any, may see the event.
+func visible(c *gin.Context, e events.Event) bool {
+	p := principal(c)
+	if p == nil {
+		return true
+	}
+	switch data := e.Data.(type) {
+	case events.CommandData:
+		return p.CanAccessRemote(data.Remote) && p.CanAccessDevice(data.Device)
+	case events.DeviceData:
+		return p.CanAccessDevice(data.Device)
+	}
+	return true
+}
+
+// getEvents streams events as server-sent events. The type query parameter filters events, like ?type=command,device.
+func (h *Handler) getEvents(c *gin.Context) {
+	types := map[string]bool{}
+	if filter := c.Query("type"); filter != "" {
+		for _, t := range strings.Split(filter, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	sub := h.events.Subscribe()
+	defer sub.Unsubscribe()
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Content-Type", "text/event-stream")
+	c.Status(200)
+	c.Writer.Flush()
+
+	done := c.Request.Context().Done()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-done:
+			return false
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case e, ok := <-sub.Events():
+			if !ok {
+				return false
+			}
+			if (len(types) == 0 || types[e.Type]) && visible(c, e) {
+				c.SSEvent(e.Type, e)
+			}
+			return true
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/events"
+	"github.com/j-vizcaino/ir-remotes/pkg/homekit"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+var (
+	homekitConfig homekit.Config
+	homekitExpose []string
+)
+
+func init() {
+	flags := cmdServer.Flags()
+	flags.StringVar(&homekitConfig.PIN, "homekit-pin", "", "HomeKit setup code, formatted like 123-45-987. HomeKit is disabled when empty.")
+	flags.StringVar(&homekitConfig.Name, "homekit-name", "IR Remotes", "HomeKit bridge name.")
+	flags.StringVar(&homekitConfig.Address, "homekit-address", ":51826", "HomeKit accessory server listen address.")
+	flags.StringVar(&homekitConfig.StateFile, "homekit-state-file", "homekit.json", "Filename where HomeKit identity and pairings are persisted.")
+	_ = cobra.MarkFlagFilename(flags, "homekit-state-file", "json")
+	flags.StringSliceVar(&homekitExpose, "homekit-expose", nil, "Commands exposed as HomeKit switches, either remote/command or remote for every command of a remote. Defaults to every command.")
+}
+
+// homekitSwitches returns the switches for the exposed commands.
+func homekitSwitches(remoteList remotes.RemoteList, expose []string) ([]homekit.Switch, error) {
+	switches := []homekit.Switch{}
+	add := func(r *remotes.Remote, command string) {
+		switches = append(switches, homekit.Switch{
+			Name:    r.Title() + " " + command,
+			Remote:  r.Name,
+			Command: command,
+		})
+	}
+	addRemote := func(r *remotes.Remote) {
+		for _, command := range r.CommandNames() {
+			add(r, command)
+		}
+	}
+
+	if len(expose) == 0 {
+		for _, r := range remoteList {
+			if !r.IsClimate() {
+				addRemote(r)
+			}
+		}
+		return switches, nil
+	}
+
+	for _, entry := range expose {
+		parts := strings.SplitN(entry, "/", 2)
+		r := remoteList.Find(parts[0])
+		if r == nil {
+			return nil, fmt.Errorf("no such remote named %q", parts[0])
+		}
+		if len(parts) == 1 {
+			addRemote(r)
+			continue
+		}
+		if _, found := r.Commands[parts[1]]; !found {
+			return nil, fmt.Errorf("no such command named %q for remote %q", parts[1], r.Name)
+		}
+		add(r, parts[1])
+	}
+	return switches, nil
+}
+
+// mustHomeKitBridge starts the HomeKit bridge, when configured. Returns nil otherwise.
+func mustHomeKitBridge(h *Handler) *homekit.Bridge {
+	if homekitConfig.PIN == "" {
+		return nil
+	}
+	logger := log.WithField("homekit-address", homekitConfig.Address)
+
+	switches, err := homekitSwitches(h.currentRemotes(), homekitExpose)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid HomeKit exposed commands")
+	}
+	homekitConfig.Switches = switches
+	homekitConfig.Version = "1.0"
+
+	send := func(remote string, command string) error {
+		// Devices of the room may not all be in line of sight
+		_, err := h.sendCommand(remote, command, sendRequest{AllowPartial: true, Count: 1, Caller: "homekit"})
+		return err
+	}
+	bridge, err := homekit.NewBridge(homekitConfig, send)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize HomeKit bridge")
+	}
+	if err := bridge.Start(); err != nil {
+		logger.WithError(err).Fatal("Failed to start HomeKit bridge")
+	}
+
+	// Switches follow the remotes, when reloaded or edited
+	sub := h.events.Subscribe()
+	go func() {
+		for e := range sub.Events() {
+			data, ok := e.Data.(events.ConfigData)
+			if !ok || data.File != configRemotes {
+				continue
+			}
+			switches, err := homekitSwitches(h.currentRemotes(), homekitExpose)
+			if err != nil {
+				logger.WithError(err).Error("Invalid HomeKit exposed commands, keeping the current switches")
+				continue
+			}
+			if err := bridge.SetSwitches(switches); err != nil {
+				logger.WithError(err).Error("Failed to update HomeKit switches")
+			}
+		}
+	}()
+	return bridge
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/metrics"
+)
+
+// Metrics exposed on /metrics
+var (
+	metricsRegistry = metrics.NewRegistry()
+
+	commandsSent = metricsRegistry.Counter("ir_remotes_commands_sent_total",
+		"IR commands sent, per remote, command, device and result (success or failure).",
+		"remote", "command", "device", "result")
+	sendDuration = metricsRegistry.Histogram("ir_remotes_send_duration_seconds",
+		"Time taken by devices to send IR commands.",
+		metrics.DefaultBuckets, "device")
+	httpRequestDuration = metricsRegistry.Histogram("ir_remotes_http_request_duration_seconds",
+		"Duration of HTTP requests, per handler, method and status code.",
+		metrics.DefaultBuckets, "handler", "method", "code")
+	deviceOnline = metricsRegistry.Gauge("ir_remotes_device_online",
+		"Whether the device is available (1) or the last call failed (0).",
+		"device")
+	deviceAuthRetries = metricsRegistry.Counter("ir_remotes_device_auth_retries_total",
+		"Authentications with devices after sending failed, per device and result (success or failure).",
+		"device", "result")
+	configReloads = metricsRegistry.Counter("ir_remotes_config_reloads_total",
+		"Reloads of remotes and devices, per source (signal, reload or api) and result (success or failure). Checks finding no change are not counted.",
+		"source", "result")
+)
+
+// resultLabel returns the result label of a call.
+func resultLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// handlerLabel returns the name of the route handler, like getRemote, so that requests are not labelled by URL.
+func handlerLabel(c *gin.Context) string {
+	if c.Writer.Status() == http.StatusNotFound && strings.HasSuffix(c.HandlerName(), "loggerMiddleWare") {
+		// No route matched
+		return "none"
+	}
+	// Like github.com/j-vizcaino/ir-remotes/cmd.(*Handler).getRemote-fm, or gin.(*RouterGroup).createStaticHandler.func1
+	parts := strings.Split(strings.TrimSuffix(c.HandlerName(), "-fm"), ".")
+	for len(parts) > 1 && strings.HasPrefix(parts[len(parts)-1], "func") {
+		parts = parts[:len(parts)-1]
+	}
+	return parts[len(parts)-1]
+}
+
+// observeRequest records the duration of the HTTP request, in seconds.
+func observeRequest(c *gin.Context, seconds float64) {
+	httpRequestDuration.Observe(seconds, handlerLabel(c), c.Request.Method, strconv.Itoa(c.Writer.Status()))
+}
+
+// updateDeviceGauges sets the availability of the current devices, before metrics are written.
+func (h *Handler) updateDeviceGauges() {
+	deviceOnline.Reset()
+	for _, d := range h.currentDevices() {
+		online := 0.0
+		if h.deviceStates.available(d.Name) {
+			online = 1
+		}
+		deviceOnline.Set(online, d.Name)
+	}
+}
+
+func (h *Handler) getMetrics(c *gin.Context) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", metrics.ContentType)
+	// Gauges follow the devices of the handler serving the request, the registry being shared
+	h.updateDeviceGauges()
+	if err := metricsRegistry.Write(c.Writer); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestGetMetrics(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+	g := s.g
+
+	w := s.do(http.MethodGet, "/metrics", "")
+	g.Expect(w.Code).To(Equal(http.StatusOK))
+	g.Expect(w.Body.String()).To(ContainSubstring(`ir_remotes_device_online{device="office"}`))
+	g.Expect(w.Body.String()).To(ContainSubstring(`ir_remotes_device_online{device="bedroom"}`))
+
+	// Gauges follow the devices of the handler serving the request
+	other := newTestServer(t)
+	defer other.close()
+	other.h.deviceInfoList = other.h.deviceInfoList[:1]
+	w = other.do(http.MethodGet, "/metrics", "")
+	g.Expect(w.Code).To(Equal(http.StatusOK))
+	g.Expect(w.Body.String()).To(ContainSubstring(`ir_remotes_device_online{device="office"}`))
+	g.Expect(w.Body.String()).NotTo(ContainSubstring(`ir_remotes_device_online{device="bedroom"}`))
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/events"
+	"github.com/j-vizcaino/ir-remotes/pkg/mqtt"
+)
+
+// mqttPasswordEnv is the environment variable holding the MQTT password, so that it does not show in the process list.
+const mqttPasswordEnv = "IR_REMOTES_MQTT_PASSWORD"
+
+var (
+	mqttConfig             mqtt.Config
+	mqttPasswordFile       string
+	mqttQoS                int
+	mqttCAFile             string
+	mqttCertFile           string
+	mqttKeyFile            string
+	mqttInsecureSkipVerify bool
+)
+
+func init() {
+	flags := cmdServer.Flags()
+	flags.StringVar(&mqttConfig.Broker, "mqtt-broker", "", "MQTT broker URL, like tcp://localhost:1883 or ssl://localhost:8883. MQTT is disabled when empty.")
+	flags.StringVar(&mqttConfig.ClientID, "mqtt-client-id", "ir-remotes", "MQTT client identifier.")
+	flags.StringVar(&mqttConfig.Username, "mqtt-username", "", "MQTT username.")
+	flags.StringVar(&mqttConfig.Password, "mqtt-password", "", "MQTT password. Prefer --mqtt-password-file or the "+mqttPasswordEnv+" environment variable, as options show in the process list.")
+	flags.StringVar(&mqttPasswordFile, "mqtt-password-file", "", "File holding the MQTT password.")
+	flags.StringVar(&mqttConfig.TopicPrefix, "mqtt-topic-prefix", mqtt.DefaultTopicPrefix, "Prefix of every MQTT topic.")
+	flags.IntVar(&mqttQoS, "mqtt-qos", 0, "MQTT quality of service (0, 1 or 2) used for subscribing and publishing.")
+	flags.StringVar(&mqttCAFile, "mqtt-ca-file", "", "CA certificate used to verify the MQTT broker certificate. Defaults to system CAs.")
+	flags.StringVar(&mqttCertFile, "mqtt-cert-file", "", "Client certificate used to authenticate with the MQTT broker.")
+	flags.StringVar(&mqttKeyFile, "mqtt-key-file", "", "Client private key used to authenticate with the MQTT broker.")
+	flags.BoolVar(&mqttInsecureSkipVerify, "mqtt-insecure-skip-verify", false, "Do not verify the MQTT broker certificate.")
+	flags.StringVar(&mqttConfig.DiscoveryPrefix, "mqtt-discovery-prefix", mqtt.DefaultDiscoveryPrefix, "Home Assistant MQTT discovery prefix. Discovery is disabled when empty.")
+}
+
+// mqttPassword returns the MQTT password, given as option, in a file or in the environment, in that order.
+func mqttPassword() (string, error) {
+	if mqttConfig.Password != "" && mqttPasswordFile != "" {
+		return "", fmt.Errorf("--mqtt-password and --mqtt-password-file are mutually exclusive")
+	}
+	if mqttConfig.Password != "" {
+		return mqttConfig.Password, nil
+	}
+	if mqttPasswordFile != "" {
+		content, err := ioutil.ReadFile(mqttPasswordFile)
+		if err != nil {
+			return "", err
+		}
+		// Files usually end with a new line, which is not part of the password
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return os.Getenv(mqttPasswordEnv), nil
+}
+
+func mqttTLSConfig() (*tls.Config, error) {
+	if mqttCAFile == "" && mqttCertFile == "" && !mqttInsecureSkipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: mqttInsecureSkipVerify,
+	}
+	if mqttCAFile != "" {
+		pem, err := ioutil.ReadFile(mqttCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", mqttCAFile)
+		}
+	}
+	if mqttCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(mqttCertFile, mqttKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// mustMQTTBridge connects to the MQTT broker, when configured. Returns nil otherwise.
+func mustMQTTBridge(h *Handler) *mqtt.Bridge {
+	if mqttConfig.Broker == "" {
+		return nil
+	}
+	logger := subsystemLog(logMQTT).WithField("mqtt-broker", mqttConfig.Broker)
+
+	if mqttQoS < 0 || mqttQoS > 2 {
+		logger.WithField("mqtt-qos", mqttQoS).Fatal("Invalid MQTT quality of service")
+	}
+	mqttConfig.QoS = byte(mqttQoS)
+
+	password, err := mqttPassword()
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load MQTT password")
+	}
+	mqttConfig.Password = password
+
+	tlsConfig, err := mqttTLSConfig()
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load MQTT TLS configuration")
+	}
+	mqttConfig.TLS = tlsConfig
+	mqttConfig.Logger = subsystemLog(logMQTT)
+
+	send := func(remote string, command string, opts mqtt.SendOptions) error {
+		_, err := h.sendCommand(remote, command, sendRequest{AllowPartial: opts.Partial, Count: opts.Count, Caller: "mqtt", RequestID: opts.RequestID})
+		return err
+	}
+	bridge := mqtt.NewBridge(mqttConfig, send)
+	if err := bridge.Connect(); err != nil {
+		logger.WithError(err).Fatal("Failed to connect to MQTT broker")
+	}
+
+	publishAvailability := func() {
+		for _, d := range h.currentDevices() {
+			if err := bridge.PublishDeviceAvailability(d.Name, h.deviceStates.available(d.Name)); err != nil {
+				logger.WithError(err).WithField("device", d.Name).Error("Failed to publish device availability")
+			}
+		}
+	}
+	publishDiscovery := func() {
+		if err := bridge.PublishDiscovery(h.currentRemotes(), h.currentDevices()); err != nil {
+			logger.WithError(err).Error("Failed to publish Home Assistant discovery configuration")
+		}
+	}
+
+	publishAvailability()
+	// Availability follows device state transitions, discovery follows configuration changes
+	sub := h.events.Subscribe()
+	go func() {
+		for e := range sub.Events() {
+			switch data := e.Data.(type) {
+			case events.DeviceData:
+				if err := bridge.PublishDeviceAvailability(data.Device, data.Available); err != nil {
+					logger.WithError(err).WithField("device", data.Device).Error("Failed to publish device availability")
+				}
+			case events.ConfigData:
+				if data.File == configDevices {
+					publishAvailability()
+				}
+				publishDiscovery()
+			}
+		}
+	}()
+	publishDiscovery()
+	return bridge
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMQTTPassword(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "cmd")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	defer func() {
+		mqttConfig.Password = ""
+		mqttPasswordFile = ""
+		os.Unsetenv(mqttPasswordEnv)
+	}()
+
+	password, err := mqttPassword()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(password).To(BeEmpty())
+
+	os.Setenv(mqttPasswordEnv, "from-env")
+	password, err = mqttPassword()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(password).To(Equal("from-env"))
+
+	// Files take precedence over the environment, without their trailing new line
+	mqttPasswordFile = filepath.Join(dir, "password")
+	g.Expect(ioutil.WriteFile(mqttPasswordFile, []byte("from-file\n"), 0600)).To(Succeed())
+	password, err = mqttPassword()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(password).To(Equal("from-file"))
+
+	mqttConfig.Password = "from-option"
+	_, err = mqttPassword()
+	g.Expect(err).To(MatchError(ContainSubstring("mutually exclusive")))
+	mqttPasswordFile = ""
+	password, err = mqttPassword()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(password).To(Equal("from-option"))
+
+	mqttPasswordFile = filepath.Join(dir, "missing")
+	mqttConfig.Password = ""
+	_, err = mqttPassword()
+	g.Expect(err).To(HaveOccurred())
+}
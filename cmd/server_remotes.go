@@ -0,0 +1,404 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/events"
+	"github.com/j-vizcaino/ir-remotes/pkg/irproto"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
+)
+
+// statusError is an error reported with a specific HTTP status code.
+type statusError struct {
+	code    int
+	message string
+}
+
+func (e statusError) Error() string {
+	return e.message
+}
+
+// remoteETag identifies the content of a remote, so that concurrent edits are detected.
+func remoteETag(r *remotes.Remote) string {
+	raw, _ := json.Marshal(r)
+	sum := sha256.Sum256(raw)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches implements If-Match: an empty header always matches.
+func etagMatches(ifMatch string, etag string) bool {
+	if ifMatch == "" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneRemote(r *remotes.Remote) *remotes.Remote {
+	out := *r
+	out.Commands = make(map[string]remotes.IRCommand, len(r.Commands))
+	for name, cmd := range r.Commands {
+		out.Commands[name] = cmd
+	}
+	if r.Aliases != nil {
+		out.Aliases = make(map[string]string, len(r.Aliases))
+		for alias, cmdName := range r.Aliases {
+			out.Aliases[alias] = cmdName
+		}
+	}
+	if r.Layout != nil {
+		layout := *r.Layout
+		layout.Groups = append([]remotes.Group(nil), r.Layout.Groups...)
+		layout.Buttons = append([]remotes.Button(nil), r.Layout.Buttons...)
+		out.Layout = &layout
+	}
+	return &out
+}
+
+// remoteUpdate edits a copy of the remote list, and of the edited remote when any.
+// It returns the new list and the remote sent as response, nil when deleted.
+type remoteUpdate func(rl remotes.RemoteList, r *remotes.Remote) (remotes.RemoteList, *remotes.Remote, error)
+
+// editRemotes applies the update, then persists and serves the new remotes.
+// When remoteName is not empty, the remote must exist and its ETag must match ifMatch, a list of ETags like the If-Match header.
+// Returns the remote produced by the update.
+func (h *Handler) editRemotes(remoteName string, ifMatch string, update remoteUpdate) (*remotes.Remote, error) {
+	// Edits and reloads are serialized, so that a reload never reverts an edit
+	h.reloadMutex.Lock()
+	defer h.reloadMutex.Unlock()
+	lock, err := h.store.Lock(lockTimeout)
+	if err != nil {
+		return nil, statusError{http.StatusServiceUnavailable, err.Error()}
+	}
+	defer lock.Unlock()
+	// Edits apply to the stored remotes, which other processes may have modified
+	if _, err := h.reloadConfigLocked("reload"); err != nil {
+		log.WithError(err).Warn("Failed to reload configuration before editing remotes, keeping the current one")
+	}
+
+	h.configMutex.Lock()
+	defer h.configMutex.Unlock()
+
+	rl := make(remotes.RemoteList, len(h.remoteList))
+	copy(rl, h.remoteList)
+
+	var edited *remotes.Remote
+	if remoteName != "" {
+		for idx, r := range rl {
+			if r.Name != remoteName {
+				continue
+			}
+			if !etagMatches(ifMatch, remoteETag(r)) {
+				return nil, statusError{http.StatusPreconditionFailed, fmt.Sprintf("remote %q was modified, ETag is now %s", r.Name, remoteETag(r))}
+			}
+			edited = cloneRemote(r)
+			rl[idx] = edited
+			break
+		}
+		if edited == nil {
+			return nil, notFoundError(fmt.Sprintf("no such remote named %q", remoteName))
+		}
+	}
+
+	rl, result, err := update(rl, edited)
+	if err != nil {
+		return nil, err
+	}
+	// Remotes extending others are resolved again, their parent may have changed
+	if rl, err = h.store.Resolve(rl); err != nil {
+		return nil, statusError{http.StatusBadRequest, err.Error()}
+	}
+	if result != nil {
+		result = rl.Find(result.Name)
+	}
+	locate := func(index int) (string, string) {
+		return "", fmt.Sprintf("remotes[%d]", index)
+	}
+	if problems := storage.ValidateRemotes(rl, locate); len(problems) > 0 {
+		return nil, statusError{http.StatusBadRequest, problems.Error()}
+	}
+
+	if err := h.store.SaveRemotes(rl); err != nil {
+		log.WithError(err).Error("Failed to save remotes")
+		return nil, fmt.Errorf("failed to save remotes: %s", err)
+	}
+	h.remoteList = rl
+	h.revision.Revision++
+	// Saved remotes are not reloaded when watched
+	h.revision.RemotesHash = configHash(rl)
+	h.revision.LoadedAt = time.Now()
+	h.revision.LastError = ""
+	h.events.Publish(events.TypeConfig, events.ConfigData{File: configRemotes, Source: "api"})
+	return result, nil
+}
+
+// updateRemotes edits the remotes, using the request If-Match header, then sends the result.
+// Returns false when the request was aborted.
+func (h *Handler) updateRemotes(c *gin.Context, remoteName string, status int, update remoteUpdate) bool {
+	result, err := h.editRemotes(remoteName, c.GetHeader("If-Match"), update)
+	if err != nil {
+		h.abortError(c, err)
+		return false
+	}
+	if result == nil {
+		c.IndentedJSON(status, gin.H{"success": true})
+		return true
+	}
+	c.Header("ETag", remoteETag(result))
+	c.IndentedJSON(status, result)
+	return true
+}
+
+// checkNotExtended fails when other remotes extend the remote, which cannot be renamed or deleted then.
+func checkNotExtended(rl remotes.RemoteList, name string) error {
+	if children := rl.ExtendedBy(name); len(children) > 0 {
+		return statusError{http.StatusConflict, fmt.Sprintf("remote %q is extended by %s", name, strings.Join(children, ", "))}
+	}
+	return nil
+}
+
+// inheritedError reports that an inherited command cannot be renamed or deleted, as it comes from the parent.
+func inheritedError(r *remotes.Remote, cmdName string) error {
+	return statusError{http.StatusBadRequest, fmt.Sprintf("command %q of remote %q is inherited from %q", cmdName, r.Name, r.Extends)}
+}
+
+// remoteBody creates or edits a remote, along with its metadata and aliases.
+// The remote it extends can only be given when creating it.
+type remoteBody struct {
+	Name    string `json:"name"`
+	Extends string `json:"extends"`
+	remotes.Metadata
+	Aliases map[string]string `json:"aliases"`
+}
+
+func (h *Handler) checkNewRemoteName(c *gin.Context, rl remotes.RemoteList, name string) error {
+	if name == "" {
+		return statusError{http.StatusBadRequest, "remote name is required"}
+	}
+	if strings.Contains(name, "/") {
+		return statusError{http.StatusBadRequest, fmt.Sprintf("invalid remote name %q", name)}
+	}
+	if rl.Find(name) != nil {
+		return statusError{http.StatusConflict, fmt.Sprintf("remote %q already exists", name)}
+	}
+	if p := principal(c); p != nil && !p.CanAccessRemote(name) {
+		c.Set(deniedKey, fmt.Sprintf("remote %q is out of scope", name))
+		return statusError{http.StatusForbidden, fmt.Sprintf("remote %q is out of scope", name)}
+	}
+	return nil
+}
+
+// overrides returns the inherited fields and the aliases given in the raw body, which the remote overrides.
+func (b remoteBody) overrides(raw []byte) []string {
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return nil
+	}
+	out := []string{}
+	for _, name := range remotes.InheritedFields() {
+		if _, found := keys[name]; found {
+			out = append(out, name)
+		}
+	}
+	for alias := range b.Aliases {
+		out = append(out, "aliases."+alias)
+	}
+	return out
+}
+
+func (h *Handler) postRemote(c *gin.Context) {
+	raw, err := c.GetRawData()
+	if err != nil {
+		h.abort(c, http.StatusBadRequest, fmt.Sprintf("invalid remote: %s", err))
+		return
+	}
+	body := remoteBody{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		h.abort(c, http.StatusBadRequest, fmt.Sprintf("invalid remote: %s", err))
+		return
+	}
+	h.updateRemotes(c, "", http.StatusCreated, func(rl remotes.RemoteList, _ *remotes.Remote) (remotes.RemoteList, *remotes.Remote, error) {
+		if err := h.checkNewRemoteName(c, rl, body.Name); err != nil {
+			return nil, nil, err
+		}
+		r := remotes.NewRemote(body.Name)
+		r.Extends = body.Extends
+		r.Metadata = body.Metadata
+		r.Aliases = body.Aliases
+		r.Override(body.overrides(raw)...)
+		return append(rl, r), r, nil
+	})
+}
+
+// putRemote renames the remote and edits its metadata.
+// Fields missing from the request keep their current value.
+func (h *Handler) putRemote(c *gin.Context) {
+	// The body is read before locking the remotes, so that slow clients do not block other edits
+	raw, err := c.GetRawData()
+	if err != nil {
+		h.abort(c, http.StatusBadRequest, fmt.Sprintf("invalid remote: %s", err))
+		return
+	}
+	if !json.Valid(raw) {
+		h.abort(c, http.StatusBadRequest, "invalid remote: malformed JSON")
+		return
+	}
+	oldName := c.Param("remote")
+	newName := oldName
+	renamed := h.updateRemotes(c, oldName, http.StatusOK, func(rl remotes.RemoteList, r *remotes.Remote) (remotes.RemoteList, *remotes.Remote, error) {
+		// r is a copy, which can be edited in place
+		// Fields missing from the body keep their current value, aliases are replaced, not merged, when given
+		body := remoteBody{Name: r.Name, Extends: r.Extends, Metadata: r.Metadata}
+		if err := json.Unmarshal(raw, &body); err != nil {
+			return nil, nil, statusError{http.StatusBadRequest, fmt.Sprintf("invalid remote: %s", err)}
+		}
+		if body.Extends != r.Extends {
+			return nil, nil, statusError{http.StatusBadRequest, fmt.Sprintf("remote %q cannot extend another remote once created", r.Name)}
+		}
+		r.Metadata = body.Metadata
+		if body.Aliases != nil {
+			r.Aliases = body.Aliases
+		}
+		// Fields given explicitly are kept, even when they have the inherited value
+		r.Override(body.overrides(raw)...)
+		if body.Name == r.Name {
+			return rl, r, nil
+		}
+		if err := h.checkNewRemoteName(c, rl, body.Name); err != nil {
+			return nil, nil, err
+		}
+		if err := checkNotExtended(rl, r.Name); err != nil {
+			return nil, nil, err
+		}
+		r.Name = body.Name
+		newName = body.Name
+		return rl, r, nil
+	})
+	if renamed && newName != oldName {
+		h.climateStates.rename(oldName, newName)
+	}
+}
+
+func (h *Handler) deleteRemote(c *gin.Context) {
+	name := c.Param("remote")
+	deleted := h.updateRemotes(c, name, http.StatusOK, func(rl remotes.RemoteList, r *remotes.Remote) (remotes.RemoteList, *remotes.Remote, error) {
+		if err := checkNotExtended(rl, r.Name); err != nil {
+			return nil, nil, err
+		}
+		out := make(remotes.RemoteList, 0, len(rl)-1)
+		for _, other := range rl {
+			if other != r {
+				out = append(out, other)
+			}
+		}
+		return out, nil, nil
+	})
+	if deleted {
+		h.climateStates.remove(name)
+	}
+}
+
+// commandBody sets the code of a command, given either as Broadlink hex code or as Pronto hex code, and renames it.
+type commandBody struct {
+	Name   string            `json:"name"`
+	Code   remotes.IRCommand `json:"code"`
+	Pronto string            `json:"pronto"`
+}
+
+func (b commandBody) irCode() (remotes.IRCommand, error) {
+	if len(b.Code) > 0 && b.Pronto != "" {
+		return nil, fmt.Errorf("code and pronto are mutually exclusive")
+	}
+	if b.Pronto == "" {
+		return b.Code, nil
+	}
+	p, err := irproto.ParsePronto(b.Pronto)
+	if err != nil {
+		return nil, err
+	}
+	return p.Broadlink(), nil
+}
+
+func (h *Handler) putRemoteCommand(c *gin.Context) {
+	body := commandBody{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		h.abort(c, http.StatusBadRequest, fmt.Sprintf("invalid command: %s", err))
+		return
+	}
+	code, err := body.irCode()
+	if err != nil {
+		h.abort(c, http.StatusBadRequest, fmt.Sprintf("invalid command: %s", err))
+		return
+	}
+
+	name := c.Param("command")
+	h.updateRemotes(c, c.Param("remote"), http.StatusOK, func(rl remotes.RemoteList, r *remotes.Remote) (remotes.RemoteList, *remotes.Remote, error) {
+		if r.IsClimate() {
+			return nil, nil, statusError{http.StatusBadRequest, fmt.Sprintf("commands of climate remote %q are generated", r.Name)}
+		}
+		if len(code) > 0 {
+			r.Commands[name] = code
+			r.Override("commands." + name)
+		}
+		if _, found := r.Commands[name]; !found {
+			return nil, nil, notFoundError(fmt.Sprintf("remote %q has no command %q", r.Name, name))
+		}
+		if body.Name != "" && body.Name != name {
+			if r.Inherited(name) {
+				return nil, nil, inheritedError(r, name)
+			}
+			if _, found := r.Commands[body.Name]; found {
+				return nil, nil, statusError{http.StatusConflict, fmt.Sprintf("remote %q already has a command %q", r.Name, body.Name)}
+			}
+			r.Commands[body.Name] = r.Commands[name]
+			delete(r.Commands, name)
+			r.Override("commands." + body.Name)
+			if r.Layout != nil {
+				r.Layout.RenameCommand(name, body.Name)
+			}
+			for alias, cmdName := range r.Aliases {
+				if cmdName == name {
+					r.Aliases[alias] = body.Name
+				}
+			}
+		}
+		return rl, r, nil
+	})
+}
+
+func (h *Handler) deleteRemoteCommand(c *gin.Context) {
+	name := c.Param("command")
+	h.updateRemotes(c, c.Param("remote"), http.StatusOK, func(rl remotes.RemoteList, r *remotes.Remote) (remotes.RemoteList, *remotes.Remote, error) {
+		if _, found := r.Commands[name]; !found {
+			return nil, nil, notFoundError(fmt.Sprintf("remote %q has no command %q", r.Name, name))
+		}
+		if r.Inherited(name) {
+			return nil, nil, inheritedError(r, name)
+		}
+		delete(r.Commands, name)
+		if r.Layout != nil {
+			r.Layout.RemoveCommand(name)
+		}
+		for alias, cmdName := range r.Aliases {
+			if cmdName == name {
+				delete(r.Aliases, alias)
+			}
+		}
+		return rl, r, nil
+	})
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+func TestPostRemote(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+	g := s.g
+
+	w := s.do(http.MethodPost, "/api/remotes/", `{"name": "fan", "room": "bedroom", "brand": "dyson"}`)
+	g.Expect(w.Code).To(Equal(http.StatusCreated), w.Body.String())
+	g.Expect(w.Header().Get("ETag")).ToNot(BeEmpty())
+	fan := s.storedRemotes().Find("fan")
+	g.Expect(fan).ToNot(BeNil())
+	g.Expect(fan.Room).To(Equal("bedroom"))
+	g.Expect(fan.Brand).To(Equal("dyson"))
+
+	g.Expect(s.do(http.MethodPost, "/api/remotes/", `{"name": "tv"}`).Code).To(Equal(http.StatusConflict))
+	g.Expect(s.do(http.MethodPost, "/api/remotes/", `{"room": "bedroom"}`).Code).To(Equal(http.StatusBadRequest))
+	g.Expect(s.do(http.MethodPost, "/api/remotes/", `{"name": "a/b"}`).Code).To(Equal(http.StatusBadRequest))
+	g.Expect(s.do(http.MethodPost, "/api/remotes/", `{"name": "lamp", "extends": "missing"}`).Code).To(Equal(http.StatusBadRequest))
+	g.Expect(s.do(http.MethodPost, "/api/remotes/", `{"name": "lamp", "aliases": {"on": "power"}}`).Code).To(Equal(http.StatusBadRequest))
+	g.Expect(s.do(http.MethodPost, "/api/remotes/", `{"name":`).Code).To(Equal(http.StatusBadRequest))
+	g.Expect(s.storedRemotes().Names()).To(ConsistOf("tv", "radio", "fan"))
+}
+
+func TestPutRemote(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+	g := s.g
+
+	etag := s.do(http.MethodGet, "/api/remotes/tv", "").Header().Get("ETag")
+	g.Expect(etag).ToNot(BeEmpty())
+
+	// Renaming keeps the commands, fields missing from the body keep their value
+	w := s.do(http.MethodPut, "/api/remotes/tv", `{"name": "television", "displayName": "TV"}`, "If-Match", etag)
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+	g.Expect(w.Header().Get("ETag")).ToNot(Equal(etag))
+	tv := s.storedRemotes().Find("television")
+	g.Expect(tv).ToNot(BeNil())
+	g.Expect(tv.DisplayName).To(Equal("TV"))
+	g.Expect(tv.CommandNames()).To(ConsistOf("power", "mute"))
+	g.Expect(s.storedRemotes().Find("tv")).To(BeNil())
+	w = s.do(http.MethodPut, "/api/remotes/television", `{"brand": "lg"}`)
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+	tv = s.storedRemotes().Find("television")
+	g.Expect(tv.DisplayName).To(Equal("TV"))
+	g.Expect(tv.Brand).To(Equal("lg"))
+
+	// The remote was modified since the ETag was read
+	g.Expect(s.do(http.MethodPut, "/api/remotes/television", `{"displayName": "Old"}`, "If-Match", etag).Code).To(Equal(http.StatusPreconditionFailed))
+	g.Expect(s.do(http.MethodPut, "/api/remotes/television", `{"name": "radio"}`).Code).To(Equal(http.StatusConflict))
+	g.Expect(s.do(http.MethodPut, "/api/remotes/television", `{"extends": "radio"}`).Code).To(Equal(http.StatusBadRequest))
+	// The body is read before waiting for other edits
+	s.h.reloadMutex.Lock()
+	g.Expect(s.do(http.MethodPut, "/api/remotes/television", `{"displayName":`).Code).To(Equal(http.StatusBadRequest))
+	s.h.reloadMutex.Unlock()
+	g.Expect(s.do(http.MethodPut, "/api/remotes/missing", `{"displayName": "Missing"}`).Code).To(Equal(http.StatusNotFound))
+	g.Expect(s.storedRemotes().Find("television").DisplayName).To(Equal("TV"))
+}
+
+func TestDeleteRemote(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+	g := s.g
+
+	// Remotes extended by others cannot be deleted
+	g.Expect(s.do(http.MethodPost, "/api/remotes/", `{"name": "tv2", "extends": "tv"}`).Code).To(Equal(http.StatusCreated))
+	g.Expect(s.do(http.MethodDelete, "/api/remotes/tv", "").Code).To(Equal(http.StatusConflict))
+
+	w := s.do(http.MethodDelete, "/api/remotes/tv2", "")
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+	w = s.do(http.MethodDelete, "/api/remotes/tv", "")
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+	g.Expect(s.storedRemotes().Names()).To(ConsistOf("radio"))
+	g.Expect(s.do(http.MethodDelete, "/api/remotes/tv", "").Code).To(Equal(http.StatusNotFound))
+	g.Expect(s.do(http.MethodGet, "/api/remotes/tv", "").Code).To(Equal(http.StatusNotFound))
+}
+
+func TestRemoteCommandEdits(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+	g := s.g
+
+	w := s.do(http.MethodPut, "/api/remotes/tv/volume_up", `{"code": "260004"}`)
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+	g.Expect(s.storedRemotes().Find("tv").Commands["volume_up"]).To(Equal(remotes.IRCommand{0x26, 0x00, 0x04}))
+
+	w = s.do(http.MethodPut, "/api/remotes/tv/volume_up", `{"name": "vol_up"}`)
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+	g.Expect(s.storedRemotes().Find("tv").CommandNames()).To(ConsistOf("power", "mute", "vol_up"))
+	g.Expect(s.do(http.MethodPut, "/api/remotes/tv/vol_up", `{"name": "power"}`).Code).To(Equal(http.StatusConflict))
+	g.Expect(s.do(http.MethodPut, "/api/remotes/tv/missing", `{"name": "other"}`).Code).To(Equal(http.StatusNotFound))
+
+	w = s.do(http.MethodDelete, "/api/remotes/tv/mute", "")
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+	g.Expect(s.storedRemotes().Find("tv").CommandNames()).To(ConsistOf("power", "vol_up"))
+	g.Expect(s.do(http.MethodDelete, "/api/remotes/tv/mute", "").Code).To(Equal(http.StatusNotFound))
+}
+
+func TestRemoteOverrides(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+	g := s.g
+
+	// Fields and commands given explicitly are kept when the parent changes, even when equal to the inherited ones
+	g.Expect(s.do(http.MethodPost, "/api/remotes/", `{"name": "radio2", "extends": "radio", "room": "bedroom"}`).Code).To(Equal(http.StatusCreated))
+	w := s.do(http.MethodPut, "/api/remotes/radio2/power", `{"code": "260003"}`)
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+	w = s.do(http.MethodPut, "/api/remotes/radio", `{"room": "kitchen"}`)
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+	w = s.do(http.MethodPut, "/api/remotes/radio/power", `{"code": "260009"}`)
+	g.Expect(w.Code).To(Equal(http.StatusOK), w.Body.String())
+
+	radio2 := s.storedRemotes().Find("radio2")
+	g.Expect(radio2.Room).To(Equal("bedroom"))
+	g.Expect(radio2.Commands["power"]).To(Equal(remotes.IRCommand{0x26, 0x00, 0x03}))
+	g.Expect(radio2.Inherited("power")).To(BeFalse())
+}
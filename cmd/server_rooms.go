@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/rooms"
+)
+
+// scopedRoom removes the remotes and devices out of the principal scope, if any.
+func scopedRoom(c *gin.Context, room rooms.Room) rooms.Room {
+	p := principal(c)
+	if p == nil {
+		return room
+	}
+	out := rooms.Room{Name: room.Name, Remotes: []string{}, Devices: []string{}}
+	for _, name := range room.Remotes {
+		if p.CanAccessRemote(name) {
+			out.Remotes = append(out.Remotes, name)
+		}
+	}
+	for _, name := range room.Devices {
+		if p.CanAccessDevice(name) {
+			out.Devices = append(out.Devices, name)
+		}
+	}
+	return out
+}
+
+func (h *Handler) getRooms(c *gin.Context) {
+	out := []rooms.Room{}
+	for _, room := range rooms.List(h.currentRemotes(), h.currentDevices()) {
+		out = append(out, scopedRoom(c, room))
+	}
+	c.IndentedJSON(http.StatusOK, out)
+}
+
+func (h *Handler) getRoom(c *gin.Context) {
+	name := c.Param("room")
+	room, found := rooms.Find(h.currentRemotes(), h.currentDevices(), name)
+	if !found {
+		h.abortNotFound(c, fmt.Sprintf("no such room named %q", name))
+		return
+	}
+	c.IndentedJSON(http.StatusOK, scopedRoom(c, room))
+}
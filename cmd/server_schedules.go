@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/scheduler"
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+func mustScheduler(h *Handler) *scheduler.Scheduler {
+	scheduleList := scheduler.ScheduleList{}
+	if err := utils.LoadFromFile(&scheduleList, schedulesFile); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithField("schedules-file", schedulesFile).Fatal("Failed to load schedules from file")
+	}
+
+	send := func(a scheduler.Action) error {
+		req := sendRequest{AllowPartial: !a.Strict, Count: a.Repeat, Caller: "scheduler"}
+		if a.Device != "" {
+			req.Devices = []string{a.Device}
+		}
+		_, err := h.sendCommand(a.Remote, a.Command, req)
+		return err
+	}
+	persist := func(sl scheduler.ScheduleList) error {
+		return utils.SaveToFile(&sl, schedulesFile)
+	}
+	s, err := scheduler.New(scheduleList, send, persist)
+	if err != nil {
+		log.WithError(err).WithField("schedules-file", schedulesFile).Fatal("Invalid schedule")
+	}
+	return s
+}
+
+func (h *Handler) getSchedules(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, h.scheduler.Schedules())
+}
+
+func (h *Handler) getScheduleExecutions(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, h.scheduler.Executions())
+}
+
+func (h *Handler) postSchedule(c *gin.Context) {
+	sch := &scheduler.Schedule{}
+	if err := c.ShouldBindJSON(sch); err != nil {
+		h.abort(c, http.StatusBadRequest, fmt.Sprintf("invalid schedule: %s", err))
+		return
+	}
+	p := principal(c)
+	for _, a := range sch.Actions {
+		if p != nil && (!p.CanAccessRemote(a.Remote) || (a.Device != "" && !p.CanAccessDevice(a.Device))) {
+			h.deny(c, http.StatusForbidden, fmt.Sprintf("action on remote %q is out of scope", a.Remote))
+			return
+		}
+		remote, _, err := h.findCommand(a.Remote, a.Command)
+		if err != nil {
+			h.abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		devNames := []string{}
+		if a.Device != "" {
+			devNames = append(devNames, a.Device)
+		}
+		if _, err := h.findRemoteDevices(remote, devNames, false); err != nil {
+			h.abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := h.scheduler.Add(sch); err != nil {
+		h.abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, sch)
+}
+
+func (h *Handler) deleteSchedule(c *gin.Context) {
+	name := c.Param("schedule")
+	found, err := h.scheduler.Remove(name)
+	if !found {
+		h.abortNotFound(c, fmt.Sprintf("no such schedule named %q", name))
+		return
+	}
+	if err != nil {
+		h.abort(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"success": true})
+}
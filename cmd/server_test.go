@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/gomega"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/events"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/scheduler"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
+)
+
+// testServer is a server using remotes and devices saved in a temporary directory.
+// Devices are not initialized, so that commands cannot be sent.
+type testServer struct {
+	g      *GomegaWithT
+	dir    string
+	h      *Handler
+	router *gin.Engine
+}
+
+// newTestServer saves the tv remote, sent by the office device, and the radio remote, sent by the bedroom device.
+func newTestServer(t *testing.T) *testServer {
+	g := NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "cmd")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	store := storage.WithTemplates(storage.NewJSONStore(filepath.Join(dir, "remotes.json"), filepath.Join(dir, "devices.json")), nil)
+	tv := remotes.NewRemote("tv")
+	tv.Commands["power"] = remotes.IRCommand{0x26, 0x00, 0x01}
+	tv.Commands["mute"] = remotes.IRCommand{0x26, 0x00, 0x02}
+	radio := remotes.NewRemote("radio")
+	radio.Room = "bedroom"
+	radio.Commands["power"] = remotes.IRCommand{0x26, 0x00, 0x03}
+	g.Expect(store.SaveRemotes(remotes.RemoteList{tv, radio})).To(Succeed())
+	g.Expect(store.SaveDevices(devices.DeviceInfoList{
+		{Name: "office", UDPAddress: "192.168.1.10:80", MACAddress: "34:ea:34:00:00:01", Type: 0x2712},
+		{Name: "bedroom", UDPAddress: "192.168.1.11:80", MACAddress: "34:ea:34:00:00:02", Type: 0x2712, Room: "bedroom"},
+	})).To(Succeed())
+
+	remoteList, err := store.LoadRemotes()
+	g.Expect(err).ToNot(HaveOccurred())
+	devInfoList, err := store.LoadDevices()
+	g.Expect(err).ToNot(HaveOccurred())
+	climateStates, err := newClimateStates(remoteList)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	h := &Handler{
+		store:          store,
+		deviceInfoList: devInfoList,
+		remoteList:     remoteList,
+		revision: configRevision{
+			Revision:    1,
+			RemotesHash: configHash(remoteList),
+			DevicesHash: configHash(devInfoList),
+			LoadedAt:    time.Now(),
+		},
+		climateStates: climateStates,
+		events:        events.NewBus(),
+	}
+	h.scheduler, err = scheduler.New(nil, func(scheduler.Action) error { return nil }, func(scheduler.ScheduleList) error { return nil })
+	g.Expect(err).ToNot(HaveOccurred())
+
+	gin.SetMode(gin.TestMode)
+	return &testServer{g: g, dir: dir, h: h, router: h.router(http.Dir(dir))}
+}
+
+func (s *testServer) close() {
+	os.RemoveAll(s.dir)
+}
+
+// do sends the request, with the given headers as name and value pairs, and returns the response.
+func (s *testServer) do(method string, url string, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for idx := 0; idx+1 < len(headers); idx += 2 {
+		req.Header.Set(headers[idx], headers[idx+1])
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+// storedRemotes returns the remotes saved by the server.
+func (s *testServer) storedRemotes() remotes.RemoteList {
+	rl, err := s.h.store.LoadRemotes()
+	s.g.Expect(err).ToNot(HaveOccurred())
+	return rl
+}
+
+func TestConfigModified(t *testing.T) {
+	s := newTestServer(t)
+	defer s.close()
+	g := s.g
+
+	// Polls load the storage once, then only when modified
+	lastModTime := time.Time{}
+	g.Expect(s.h.configModified(&lastModTime)).To(BeTrue())
+	g.Expect(s.h.configModified(&lastModTime)).To(BeFalse())
+
+	past := lastModTime.Add(-time.Hour)
+	g.Expect(os.Chtimes(filepath.Join(s.dir, "remotes.json"), past, past)).To(Succeed())
+	g.Expect(os.Chtimes(filepath.Join(s.dir, "devices.json"), past, past)).To(Succeed())
+	g.Expect(s.h.configModified(&lastModTime)).To(BeTrue())
+	g.Expect(s.h.configModified(&lastModTime)).To(BeFalse())
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/certs"
+)
+
+// selfSignedValidity is the validity of the generated self-signed certificates
+const selfSignedValidity = 5 * 365 * 24 * time.Hour
+
+var (
+	tlsConfig     certs.Config
+	tlsSelfSigned bool
+	tlsHosts      []string
+)
+
+func init() {
+	flags := cmdServer.Flags()
+	flags.StringVar(&tlsConfig.CertFile, "tls-cert", "", "Server certificate file. HTTPS is enabled when set.")
+	flags.StringVar(&tlsConfig.KeyFile, "tls-key", "", "Server private key file.")
+	flags.StringVar(&tlsConfig.ClientCAFile, "tls-client-ca", "", "CA certificates used to verify client certificates. Clients must present a certificate when set.")
+	flags.BoolVar(&tlsSelfSigned, "tls-self-signed", false, "Generate a self-signed certificate when --tls-cert and --tls-key files do not exist.")
+	flags.StringSliceVar(&tlsHosts, "tls-self-signed-hosts", []string{"localhost", "127.0.0.1"}, "Host names and IP addresses of the generated self-signed certificate.")
+	_ = cobra.MarkFlagFilename(flags, "tls-cert", "pem", "crt")
+	_ = cobra.MarkFlagFilename(flags, "tls-key", "pem", "key")
+	_ = cobra.MarkFlagFilename(flags, "tls-client-ca", "pem", "crt")
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// mustCertReloader loads the server certificates, when configured. Returns nil otherwise.
+// Certificates are reloaded when the process receives SIGHUP.
+func mustCertReloader() *certs.Reloader {
+	if tlsConfig.CertFile == "" && tlsConfig.KeyFile == "" {
+		if tlsConfig.ClientCAFile != "" || tlsSelfSigned {
+			log.Fatal("--tls-client-ca and --tls-self-signed require --tls-cert and --tls-key")
+		}
+		return nil
+	}
+	logger := log.WithFields(log.Fields{
+		"tls-cert": tlsConfig.CertFile,
+		"tls-key":  tlsConfig.KeyFile,
+	})
+	if tlsConfig.CertFile == "" || tlsConfig.KeyFile == "" {
+		logger.Fatal("Both --tls-cert and --tls-key are required")
+	}
+
+	if tlsSelfSigned && !fileExists(tlsConfig.CertFile) && !fileExists(tlsConfig.KeyFile) {
+		if err := certs.GenerateSelfSigned(tlsConfig.CertFile, tlsConfig.KeyFile, tlsHosts, selfSignedValidity); err != nil {
+			logger.WithError(err).Fatal("Failed to generate self-signed certificate")
+		}
+		logger.WithField("hosts", tlsHosts).Info("Generated self-signed certificate")
+	}
+
+	reloader, err := certs.NewReloader(tlsConfig)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load TLS configuration")
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := reloader.Reload(); err != nil {
+				logger.WithError(err).Error("Failed to reload certificates, keeping the previous ones")
+				continue
+			}
+			logger.Info("Certificates reloaded")
+		}
+	}()
+	return reloader
+}
+
+// listenAndServe runs the HTTP server, over TLS when the certificate reloader is not nil.
+func listenAndServe(handler http.Handler, reloader *certs.Reloader) error {
+	server := &http.Server{
+		Addr:    listenAddress,
+		Handler: handler,
+	}
+	if reloader == nil {
+		log.WithField("listen-address", listenAddress).Info("Starting HTTP server")
+		return server.ListenAndServe()
+	}
+	server.TLSConfig = reloader.TLSConfig()
+	log.WithFields(log.Fields{
+		"listen-address": listenAddress,
+		"mutual-tls":     tlsConfig.ClientCAFile != "",
+	}).Info("Starting HTTPS server")
+	return server.ListenAndServeTLS("", "")
+}
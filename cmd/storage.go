@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
+)
+
+var cmdMigrateStorage = &cobra.Command{
+	Use:   "migrate-storage FROM TO",
+	Args:  cobra.ExactArgs(2),
+	Short: "Copy remotes and devices from one storage to another.",
+	Long: `Copy remotes and devices from one storage to another, replacing the content of the destination.
+Storages are given like the --storage option: json, dir:<directory> or sqlite:<file>.`,
+	Example: "  ir-remotes migrate-storage json dir:config",
+	Run:     MigrateStorage,
+}
+
+var storageSpec string
+
+func init() {
+	flags := cmdRoot.PersistentFlags()
+	flags.StringVar(&storageSpec,
+		"storage",
+		"json",
+		"Storage of remotes and devices: json (using --remotes-file and --devices-file), dir:<directory> (one file per remote) or sqlite:<file>.")
+
+	cmdRoot.AddCommand(cmdMigrateStorage)
+}
+
+// openStore opens the storage given by spec, like json, dir:<directory> or sqlite:<file>.
+func openStore(spec string) (storage.Store, error) {
+	kind := spec
+	location := ""
+	if idx := strings.Index(spec, ":"); idx >= 0 {
+		kind = spec[:idx]
+		location = spec[idx+1:]
+	}
+	switch kind {
+	case "json":
+		if location != "" {
+			return nil, fmt.Errorf("json storage uses --remotes-file and --devices-file, not a location")
+		}
+		return storage.NewJSONStore(remotesFile, devicesFile), nil
+	case "dir", "sqlite":
+		if location == "" {
+			return nil, fmt.Errorf("%s storage needs a location, like %s:<path>", kind, kind)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported storage %q (expected json, dir or sqlite)", kind)
+	}
+	if kind == "dir" {
+		return storage.NewDirStore(location), nil
+	}
+	return storage.OpenSQLite(location)
+}
+
+// mustOpenStore opens the storage given by --storage, as stored.
+func mustOpenStore() storage.Store {
+	s, err := openStore(storageSpec)
+	if err != nil {
+		log.WithError(err).WithField("storage", storageSpec).Fatal("Failed to open storage")
+	}
+	return s
+}
+
+// mustStore opens the storage given by --storage, resolving remotes extending other remotes or library templates.
+func mustStore() storage.Store {
+	return withLibrary(mustOpenStore())
+}
+
+func withLibrary(s storage.Store) *storage.TemplateStore {
+	return storage.WithTemplates(s, mustLibrary().Finder())
+}
+
+func MigrateStorage(_ *cobra.Command, args []string) {
+	from, err := openStore(args[0])
+	if err != nil {
+		log.WithError(err).WithField("storage", args[0]).Fatal("Failed to open storage")
+	}
+	defer from.Close()
+	to, err := openStore(args[1])
+	if err != nil {
+		log.WithError(err).WithField("storage", args[1]).Fatal("Failed to open storage")
+	}
+	defer to.Close()
+
+	if err := storage.Migrate(from, to, lockTimeout); err != nil {
+		log.WithError(err).Fatal("Failed to migrate storage")
+	}
+	log.WithFields(log.Fields{
+		"from": args[0],
+		"to":   args[1],
+	}).Info("Migrated remotes and devices")
+}
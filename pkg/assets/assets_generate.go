@@ -10,7 +10,7 @@ import (
 )
 
 func main() {
-	for _, dir:= range []string{"ui", "config"}{
+	for _, dir:= range []string{"ui", "config", "library"}{
 		assetsDir := fmt.Sprintf("../../assets/%s", dir)
 		err := vfsgen.Generate(http.Dir(assetsDir), vfsgen.Options{
 			Filename: fmt.Sprintf("%s/assets_vfsdata.go", dir),
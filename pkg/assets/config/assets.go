@@ -4,4 +4,5 @@ package config
 
 import "net/http"
 
-var Assets http.FileSystem = http.Dir(".")
+// Assets are the default remotes and devices files, only set when embedded in the binary.
+var Assets http.FileSystem
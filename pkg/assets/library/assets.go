@@ -0,0 +1,8 @@
+// +build !embedded
+
+package library
+
+import "net/http"
+
+// Assets are the bundled remote templates, read from the source tree when not embedded in the binary.
+var Assets http.FileSystem = http.Dir("assets/library")
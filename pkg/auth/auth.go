@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+// Role defines what a principal is allowed to do.
+type Role string
+
+const (
+	// RoleReadOnly can list devices, remotes, climate states and schedules.
+	RoleReadOnly Role = "read-only"
+	// RoleOperator can also send commands.
+	RoleOperator Role = "operator"
+	// RoleAdmin can also manage schedules.
+	RoleAdmin Role = "admin"
+)
+
+var roleLevels = map[Role]int{
+	RoleReadOnly: 1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// Allows reports whether the role grants the permissions of the required role.
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] > 0 && roleLevels[r] >= roleLevels[required]
+}
+
+// Principal is a user or an application calling the API.
+type Principal struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+	// APIKey is sent in the X-API-Key header, or as bearer token.
+	APIKey string `json:"apiKey,omitempty"`
+	// Username and Password are used for HTTP basic authentication. Password is a bcrypt hash.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Remotes and Devices restrict the principal to the listed remotes and devices. Empty means all.
+	Remotes []string `json:"remotes,omitempty"`
+	Devices []string `json:"devices,omitempty"`
+}
+
+func inScope(scope []string, name string) bool {
+	if len(scope) == 0 {
+		return true
+	}
+	for _, s := range scope {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessRemote reports whether the remote is in the principal scope.
+func (p *Principal) CanAccessRemote(name string) bool {
+	return inScope(p.Remotes, name)
+}
+
+// CanAccessDevice reports whether the device is in the principal scope.
+func (p *Principal) CanAccessDevice(name string) bool {
+	return inScope(p.Devices, name)
+}
+
+// Config is the content of the authentication file.
+type Config struct {
+	Principals []Principal `json:"principals"`
+	// Anonymous is the role of requests without credentials. Empty means those are rejected.
+	Anonymous Role `json:"anonymous,omitempty"`
+}
+
+// Validate checks roles are known and credentials are unique.
+func (c *Config) Validate() error {
+	if c.Anonymous != "" && roleLevels[c.Anonymous] == 0 {
+		return fmt.Errorf("unknown anonymous role %q", c.Anonymous)
+	}
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	usernames := make(map[string]bool)
+	for _, p := range c.Principals {
+		if p.Name == "" {
+			return fmt.Errorf("principal has no name")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate principal %q", p.Name)
+		}
+		names[p.Name] = true
+
+		if roleLevels[p.Role] == 0 {
+			return fmt.Errorf("principal %q has unknown role %q", p.Name, p.Role)
+		}
+		if p.APIKey == "" && p.Username == "" {
+			return fmt.Errorf("principal %q has neither API key nor username", p.Name)
+		}
+		if p.APIKey != "" {
+			if keys[p.APIKey] {
+				return fmt.Errorf("principal %q uses an API key already assigned", p.Name)
+			}
+			keys[p.APIKey] = true
+		}
+		if p.Username != "" {
+			if usernames[p.Username] {
+				return fmt.Errorf("principal %q uses username %q already assigned", p.Name, p.Username)
+			}
+			usernames[p.Username] = true
+			if _, err := bcrypt.Cost([]byte(p.Password)); err != nil {
+				return fmt.Errorf("principal %q password is not a bcrypt hash", p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Authenticator identifies the principal making a request.
+type Authenticator struct {
+	config Config
+	// dummyHash is compared with the password of unknown usernames, so that response times do not tell
+	// which usernames exist. It uses the highest cost of the principal passwords.
+	dummyHash []byte
+}
+
+// NewAuthenticator validates the configuration and returns the matching authenticator.
+func NewAuthenticator(config Config) (*Authenticator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	cost := 0
+	for _, p := range config.Principals {
+		if c, err := bcrypt.Cost([]byte(p.Password)); err == nil && c > cost {
+			cost = c
+		}
+	}
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("ir-remotes"), cost)
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{config: config, dummyHash: dummyHash}, nil
+}
+
+// LoadAuthenticator loads the configuration from a JSON file.
+func LoadAuthenticator(filename string) (*Authenticator, error) {
+	config := Config{}
+	if err := utils.LoadFromFile(&config, filename); err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(config)
+}
+
+// Anonymous is the principal used for requests without credentials, nil when those are rejected.
+func (a *Authenticator) Anonymous() *Principal {
+	if a.config.Anonymous == "" {
+		return nil
+	}
+	return &Principal{Name: "anonymous", Role: a.config.Anonymous}
+}
+
+// ErrInvalidCredentials is returned when the request credentials match no principal.
+var ErrInvalidCredentials = fmt.Errorf("invalid credentials")
+
+// Authenticate returns the principal matching the request credentials.
+// Requests without credentials get the anonymous principal, which is nil when anonymous access is disabled.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if authz := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(authz, "Bearer ") {
+		key = strings.TrimPrefix(authz, "Bearer ")
+	}
+	if key != "" {
+		for idx := range a.config.Principals {
+			p := &a.config.Principals[idx]
+			if p.APIKey != "" && subtle.ConstantTimeCompare([]byte(p.APIKey), []byte(key)) == 1 {
+				return p, nil
+			}
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	if username, password, ok := r.BasicAuth(); ok {
+		for idx := range a.config.Principals {
+			p := &a.config.Principals[idx]
+			if p.Username != username {
+				continue
+			}
+			if bcrypt.CompareHashAndPassword([]byte(p.Password), []byte(password)) != nil {
+				return nil, ErrInvalidCredentials
+			}
+			return p, nil
+		}
+		// Unknown usernames take as long as wrong passwords
+		_ = bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	return a.Anonymous(), nil
+}
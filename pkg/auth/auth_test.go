@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testConfig(g *GomegaWithT) Config {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	g.Expect(err).ToNot(HaveOccurred())
+	return Config{
+		Principals: []Principal{
+			{Name: "home-assistant", Role: RoleOperator, APIKey: "key1", Remotes: []string{"tv"}},
+			{Name: "alice", Role: RoleAdmin, Username: "alice", Password: string(hash)},
+		},
+	}
+}
+
+func TestRole(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(RoleAdmin.Allows(RoleOperator)).To(BeTrue())
+	g.Expect(RoleOperator.Allows(RoleOperator)).To(BeTrue())
+	g.Expect(RoleReadOnly.Allows(RoleOperator)).To(BeFalse())
+	g.Expect(Role("guest").Allows(RoleReadOnly)).To(BeFalse())
+}
+
+func TestScopes(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := Principal{Remotes: []string{"tv"}}
+	g.Expect(p.CanAccessRemote("tv")).To(BeTrue())
+	g.Expect(p.CanAccessRemote("ac")).To(BeFalse())
+	g.Expect(p.CanAccessDevice("office")).To(BeTrue())
+}
+
+func TestValidate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	c := testConfig(g)
+	g.Expect(c.Validate()).To(Succeed())
+
+	c.Anonymous = "guest"
+	g.Expect(c.Validate()).To(HaveOccurred())
+
+	c = testConfig(g)
+	c.Principals[1].APIKey = "key1"
+	g.Expect(c.Validate()).To(MatchError(`principal "alice" uses an API key already assigned`))
+
+	c = testConfig(g)
+	c.Principals[1].Password = "secret"
+	g.Expect(c.Validate()).To(MatchError(`principal "alice" password is not a bcrypt hash`))
+
+	c = testConfig(g)
+	c.Principals = append(c.Principals, Principal{Name: "bob", Role: RoleReadOnly})
+	g.Expect(c.Validate()).To(MatchError(`principal "bob" has neither API key nor username`))
+}
+
+func TestAuthenticate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	a, err := NewAuthenticator(testConfig(g))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/remotes/", nil)
+	p, err := a.Authenticate(req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p).To(BeNil())
+
+	req.Header.Set("X-API-Key", "key1")
+	p, err = a.Authenticate(req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.Name).To(Equal("home-assistant"))
+
+	req.Header.Del("X-API-Key")
+	req.Header.Set("Authorization", "Bearer key2")
+	_, err = a.Authenticate(req)
+	g.Expect(err).To(Equal(ErrInvalidCredentials))
+
+	req.Header.Del("Authorization")
+	req.SetBasicAuth("alice", "secret")
+	p, err = a.Authenticate(req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.Name).To(Equal("alice"))
+
+	req.SetBasicAuth("alice", "wrong")
+	_, err = a.Authenticate(req)
+	g.Expect(err).To(Equal(ErrInvalidCredentials))
+
+	// Unknown usernames are compared with a hash of the same cost, taking as long as wrong passwords
+	req.SetBasicAuth("bob", "secret")
+	_, err = a.Authenticate(req)
+	g.Expect(err).To(Equal(ErrInvalidCredentials))
+	g.Expect(bcrypt.Cost(a.dummyHash)).To(Equal(bcrypt.MinCost))
+
+	config := testConfig(g)
+	config.Anonymous = RoleReadOnly
+	a, err = NewAuthenticator(config)
+	g.Expect(err).ToNot(HaveOccurred())
+	req, _ = http.NewRequest(http.MethodGet, "/api/remotes/", nil)
+	p, err = a.Authenticate(req)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p.Role).To(Equal(RoleReadOnly))
+}
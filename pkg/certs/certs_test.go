@@ -0,0 +1,77 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestReloader(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "certs")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	config := Config{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	_, err = NewReloader(config)
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(GenerateSelfSigned(config.CertFile, config.KeyFile, []string{"localhost", "127.0.0.1"}, time.Hour)).To(Succeed())
+	info, err := os.Stat(config.KeyFile)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+	r, err := NewReloader(config)
+	g.Expect(err).ToNot(HaveOccurred())
+	serverConfig, err := r.TLSConfig().GetConfigForClient(nil)
+	g.Expect(err).ToNot(HaveOccurred())
+	leaf, err := x509.ParseCertificate(serverConfig.Certificates[0].Certificate[0])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(leaf.DNSNames).To(Equal([]string{"localhost"}))
+	g.Expect(leaf.IPAddresses[0].String()).To(Equal("127.0.0.1"))
+	g.Expect(serverConfig.ClientAuth).To(Equal(tls.NoClientCert))
+
+	// Reloading picks the new certificate
+	g.Expect(GenerateSelfSigned(config.CertFile, config.KeyFile, []string{"ir-remotes.local"}, time.Hour)).To(Succeed())
+	g.Expect(r.Reload()).To(Succeed())
+	serverConfig, _ = r.TLSConfig().GetConfigForClient(nil)
+	leaf, err = x509.ParseCertificate(serverConfig.Certificates[0].Certificate[0])
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(leaf.DNSNames).To(Equal([]string{"ir-remotes.local"}))
+
+	// Failed reloads keep the previous certificate
+	g.Expect(ioutil.WriteFile(config.CertFile, []byte("garbage"), 0644)).To(Succeed())
+	g.Expect(r.Reload()).To(HaveOccurred())
+	serverConfig, _ = r.TLSConfig().GetConfigForClient(nil)
+	g.Expect(serverConfig.Certificates[0].Certificate[0]).To(Equal(leaf.Raw))
+}
+
+func TestReloaderClientCA(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "certs")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	config := Config{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	g.Expect(GenerateSelfSigned(config.CertFile, config.KeyFile, []string{"localhost"}, time.Hour)).To(Succeed())
+	g.Expect(GenerateSelfSigned(config.ClientCAFile, filepath.Join(dir, "ca-key.pem"), nil, time.Hour)).To(Succeed())
+
+	r, err := NewReloader(config)
+	g.Expect(err).ToNot(HaveOccurred())
+	serverConfig, _ := r.TLSConfig().GetConfigForClient(nil)
+	g.Expect(serverConfig.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+	g.Expect(serverConfig.ClientCAs.Subjects()).To(HaveLen(1))
+}
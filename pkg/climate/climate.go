@@ -0,0 +1,127 @@
+package climate
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// Mode is the operating mode of an air-conditioner.
+type Mode string
+
+const (
+	ModeAuto Mode = "auto"
+	ModeCool Mode = "cool"
+	ModeHeat Mode = "heat"
+	ModeDry  Mode = "dry"
+	ModeFan  Mode = "fan"
+)
+
+// FanAuto lets the air-conditioner pick the fan speed.
+const FanAuto = 0
+
+// State is the full state sent by an air-conditioner remote on every button press.
+type State struct {
+	Power       bool `json:"power"`
+	Mode        Mode `json:"mode"`
+	Temperature int  `json:"temperature"`
+	// Fan is the fan speed, from 1 to Capabilities.FanSpeeds, or FanAuto.
+	Fan   int  `json:"fan"`
+	Swing bool `json:"swing"`
+}
+
+// Capabilities describes the range of states supported by a protocol.
+type Capabilities struct {
+	Modes          []Mode `json:"modes"`
+	MinTemperature int    `json:"minTemperature"`
+	MaxTemperature int    `json:"maxTemperature"`
+	FanSpeeds      int    `json:"fanSpeeds"`
+	Swing          bool   `json:"swing"`
+}
+
+// Protocol generates IR codes for a family of air-conditioners.
+type Protocol interface {
+	Name() string
+	Capabilities() Capabilities
+	// Encode builds the IR code for the given state. State is expected to be valid.
+	Encode(s State) remotes.IRCommand
+}
+
+var protocols = map[string]Protocol{}
+
+func register(p Protocol) {
+	protocols[p.Name()] = p
+}
+
+// Find returns the protocol with the given name.
+func Find(name string) (Protocol, bool) {
+	p, found := protocols[name]
+	return p, found
+}
+
+// ProtocolNames returns the sorted list of supported protocol names.
+func ProtocolNames() []string {
+	out := make([]string, 0, len(protocols))
+	for name := range protocols {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// DefaultState returns a sensible initial state for the given capabilities.
+func (c Capabilities) DefaultState() State {
+	temp := 22
+	if temp < c.MinTemperature {
+		temp = c.MinTemperature
+	}
+	if temp > c.MaxTemperature {
+		temp = c.MaxTemperature
+	}
+	return State{
+		Mode:        c.Modes[0],
+		Temperature: temp,
+		Fan:         FanAuto,
+	}
+}
+
+// Validate checks that the state is within the supported ranges.
+func (c Capabilities) Validate(s State) error {
+	supported := false
+	for _, m := range c.Modes {
+		if m == s.Mode {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("unsupported mode %q (expected one of %v)", s.Mode, c.Modes)
+	}
+	if s.Temperature < c.MinTemperature || s.Temperature > c.MaxTemperature {
+		return fmt.Errorf("temperature %d out of range [%d, %d]", s.Temperature, c.MinTemperature, c.MaxTemperature)
+	}
+	if s.Fan < FanAuto || s.Fan > c.FanSpeeds {
+		return fmt.Errorf("fan speed %d out of range [%d, %d]", s.Fan, FanAuto, c.FanSpeeds)
+	}
+	if s.Swing && !c.Swing {
+		return fmt.Errorf("swing is not supported")
+	}
+	return nil
+}
+
+// Encode validates the state and builds the matching IR code using the given protocol.
+func Encode(p Protocol, s State) (remotes.IRCommand, error) {
+	if err := p.Capabilities().Validate(s); err != nil {
+		return nil, fmt.Errorf("invalid %s state, %s", p.Name(), err)
+	}
+	return p.Encode(s), nil
+}
+
+func sum(data []byte) byte {
+	var out byte
+	for _, b := range data {
+		out += b
+	}
+	return out
+}
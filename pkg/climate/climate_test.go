@@ -0,0 +1,113 @@
+package climate
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/irproto"
+)
+
+func TestProtocols(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(ProtocolNames()).To(Equal([]string{"daikin", "gree", "mitsubishi"}))
+
+	for _, name := range ProtocolNames() {
+		p, found := Find(name)
+		g.Expect(found).To(BeTrue())
+
+		s := p.Capabilities().DefaultState()
+		s.Power = true
+		code, err := Encode(p, s)
+		g.Expect(err).NotTo(HaveOccurred(), name)
+		g.Expect(code).NotTo(BeEmpty(), name)
+	}
+
+	_, found := Find("missing")
+	g.Expect(found).To(BeFalse())
+}
+
+func TestCapabilities_Validate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p, _ := Find("mitsubishi")
+	caps := p.Capabilities()
+	valid := State{Power: true, Mode: ModeCool, Temperature: 20, Fan: 2}
+	g.Expect(caps.Validate(valid)).To(Succeed())
+
+	s := valid
+	s.Mode = ModeFan
+	g.Expect(caps.Validate(s)).To(HaveOccurred())
+
+	s = valid
+	s.Temperature = 32
+	g.Expect(caps.Validate(s)).To(HaveOccurred())
+
+	s = valid
+	s.Fan = 5
+	g.Expect(caps.Validate(s)).To(HaveOccurred())
+
+	_, err := Encode(p, s)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestGreeChecksum(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// Cool, power on, fan auto, 24°C
+	data := []byte{0x09, 0x08, 0x20, 0x50, 0x00, 0x20, 0x00, 0x00}
+	g.Expect(greeChecksum(data)).To(Equal(byte(0xd)))
+}
+
+func TestDaikinSections(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// Cool, power on, 22°C, fan 3, swing
+	s := State{Power: true, Mode: ModeCool, Temperature: 22, Fan: 3, Swing: true}
+	expected := [][]byte{
+		{0x11, 0xda, 0x27, 0x00, 0xc5, 0x00, 0x00, 0xd7},
+		{0x11, 0xda, 0x27, 0x00, 0x42, 0x00, 0x00, 0x54},
+		{0x11, 0xda, 0x27, 0x00, 0x00, 0x39, 0x2c, 0x00, 0x5f, 0x00, 0x00, 0x06, 0x60, 0x00, 0x00, 0xc0, 0x00, 0x00, 0xfc},
+	}
+	sections := daikin{}.sections(s)
+	g.Expect(sections).To(Equal(expected))
+
+	// 5 zero bits, then every section
+	p := irproto.Pulses{}
+	p.Bits(0, 5, daikinTiming)
+	p.Footer(daikinTiming)
+	for _, section := range expected {
+		p.Header(daikinTiming)
+		p.Bytes(section, daikinTiming)
+		p.Footer(daikinTiming)
+	}
+	g.Expect(daikin{}.Encode(s)).To(Equal(p.Broadlink()))
+
+	// Fan, power off, fan auto: the temperature is fixed
+	sections = daikin{}.sections(State{Mode: ModeFan, Temperature: 18, Fan: FanAuto})
+	g.Expect(sections[2]).To(Equal([]byte{0x11, 0xda, 0x27, 0x00, 0x00, 0x68, 0x32, 0x00, 0xa0, 0x00, 0x00, 0x06, 0x60, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x72}))
+}
+
+func TestMitsubishiFrame(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// Cool, power on, 22°C, fan 2, vane auto
+	s := State{Power: true, Mode: ModeCool, Temperature: 22, Fan: 2}
+	expected := []byte{0x23, 0xcb, 0x26, 0x01, 0x00, 0x20, 0x18, 0x06, 0x36, 0x42, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xcb}
+	g.Expect(mitsubishi{}.frame(s)).To(Equal(expected))
+
+	// The frame is sent twice
+	p := irproto.Pulses{}
+	for i := 0; i < 2; i++ {
+		p.Header(mitsubishiTiming)
+		p.Bytes(expected, mitsubishiTiming)
+		p.Footer(mitsubishiTiming)
+	}
+	g.Expect(mitsubishi{}.Encode(s)).To(Equal(p.Broadlink()))
+
+	// Heat, power off, 31°C, fan auto, swing
+	g.Expect(mitsubishi{}.frame(State{Mode: ModeHeat, Temperature: 31, Fan: FanAuto, Swing: true})).To(Equal([]byte{
+		0x23, 0xcb, 0x26, 0x01, 0x00, 0x00, 0x08, 0x0f, 0x30, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x54,
+	}))
+}
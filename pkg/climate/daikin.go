@@ -0,0 +1,103 @@
+package climate
+
+import (
+	"github.com/j-vizcaino/ir-remotes/pkg/irproto"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// daikin implements the 280 bits protocol used by Daikin ARC4xx remotes.
+// The frame is made of three sections, the last one holding the actual state.
+type daikin struct{}
+
+var daikinTiming = irproto.Timing{
+	HeaderMark:  3650,
+	HeaderSpace: 1623,
+	BitMark:     428,
+	OneSpace:    1280,
+	ZeroSpace:   428,
+	Gap:         29000,
+}
+
+var daikinModes = map[Mode]byte{
+	ModeAuto: 0x0,
+	ModeDry:  0x2,
+	ModeCool: 0x3,
+	ModeHeat: 0x4,
+	ModeFan:  0x6,
+}
+
+const (
+	daikinFanAuto = 0xa
+	// Fan speeds 1 to 5 are encoded from 3 to 7
+	daikinFanOffset = 2
+	// Fan mode ignores temperature but the remote still sends a fixed value
+	daikinFanModeTemp = 25
+)
+
+func init() {
+	register(daikin{})
+}
+
+func (daikin) Name() string {
+	return "daikin"
+}
+
+func (daikin) Capabilities() Capabilities {
+	return Capabilities{
+		Modes:          []Mode{ModeAuto, ModeCool, ModeHeat, ModeDry, ModeFan},
+		MinTemperature: 10,
+		MaxTemperature: 32,
+		FanSpeeds:      5,
+		Swing:          true,
+	}
+}
+
+// sections returns the bytes of the three sections of the frame.
+func (daikin) sections(s State) [][]byte {
+	header := []byte{0x11, 0xda, 0x27, 0x00}
+
+	first := append(append([]byte{}, header...), 0xc5, 0x00, 0x00, 0x00)
+	first[7] = sum(first[:7])
+
+	second := append(append([]byte{}, header...), 0x42, 0x00, 0x00, 0x00)
+	second[7] = sum(second[:7])
+
+	third := make([]byte, 19)
+	copy(third, header)
+	third[5] = daikinModes[s.Mode]<<4 | 0x08
+	if s.Power {
+		third[5] |= 0x01
+	}
+	temp := s.Temperature
+	if s.Mode == ModeFan {
+		temp = daikinFanModeTemp
+	}
+	third[6] = byte(temp * 2)
+	fan := byte(daikinFanAuto)
+	if s.Fan != FanAuto {
+		fan = byte(s.Fan + daikinFanOffset)
+	}
+	third[8] = fan << 4
+	if s.Swing {
+		third[8] |= 0x0f
+	}
+	// Timers disabled
+	third[11] = 0x06
+	third[12] = 0x60
+	third[15] = 0xc0
+	third[18] = sum(third[:18])
+	return [][]byte{first, second, third}
+}
+
+func (d daikin) Encode(s State) remotes.IRCommand {
+	p := irproto.Pulses{}
+	// Leading 5 zero bits wake the receiver up
+	p.Bits(0, 5, daikinTiming)
+	p.Footer(daikinTiming)
+	for _, section := range d.sections(s) {
+		p.Header(daikinTiming)
+		p.Bytes(section, daikinTiming)
+		p.Footer(daikinTiming)
+	}
+	return p.Broadlink()
+}
@@ -0,0 +1,92 @@
+package climate
+
+import (
+	"github.com/j-vizcaino/ir-remotes/pkg/irproto"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// gree implements the 64 bits protocol used by Gree remotes (YAW1F and alike), also found on many OEM units.
+// The frame is split in two blocks of 4 bytes, separated by a 3 bits footer.
+type gree struct{}
+
+var greeTiming = irproto.Timing{
+	HeaderMark:  9000,
+	HeaderSpace: 4500,
+	BitMark:     620,
+	OneSpace:    1600,
+	ZeroSpace:   540,
+	Gap:         19980,
+}
+
+var greeModes = map[Mode]byte{
+	ModeAuto: 0,
+	ModeCool: 1,
+	ModeDry:  2,
+	ModeFan:  3,
+	ModeHeat: 4,
+}
+
+const (
+	greePower     = 0x08
+	greeSwingAuto = 0x40
+	greeLight     = 0x20
+	greeFixed     = 0x50
+	// greeSwingVAuto sets vertical vanes in auto swing position
+	greeSwingVAuto = 0x01
+	// greeBlockFooter is sent between the two blocks
+	greeBlockFooter = 0x2
+)
+
+func init() {
+	register(gree{})
+}
+
+func (gree) Name() string {
+	return "gree"
+}
+
+func (gree) Capabilities() Capabilities {
+	return Capabilities{
+		Modes:          []Mode{ModeAuto, ModeCool, ModeHeat, ModeDry, ModeFan},
+		MinTemperature: 16,
+		MaxTemperature: 30,
+		FanSpeeds:      3,
+		Swing:          true,
+	}
+}
+
+func greeChecksum(data []byte) byte {
+	var s byte = 10
+	for _, b := range data[:4] {
+		s += b & 0x0f
+	}
+	for _, b := range data[4:7] {
+		s += b >> 4
+	}
+	return s & 0x0f
+}
+
+func (gree) Encode(s State) remotes.IRCommand {
+	data := make([]byte, 8)
+	data[0] = greeModes[s.Mode] | byte(s.Fan)<<4
+	if s.Power {
+		data[0] |= greePower
+	}
+	if s.Swing {
+		data[0] |= greeSwingAuto
+		data[4] = greeSwingVAuto
+	}
+	data[1] = byte(s.Temperature - 16)
+	data[2] = greeLight
+	data[3] = greeFixed
+	data[7] = greeChecksum(data) << 4
+
+	p := irproto.Pulses{}
+	p.Header(greeTiming)
+	p.Bytes(data[:4], greeTiming)
+	p.Bits(greeBlockFooter, 3, greeTiming)
+	p.Footer(greeTiming)
+	p.Bytes(data[4:], greeTiming)
+	p.Footer(greeTiming)
+	return p.Broadlink()
+}
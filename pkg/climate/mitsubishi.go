@@ -0,0 +1,95 @@
+package climate
+
+import (
+	"github.com/j-vizcaino/ir-remotes/pkg/irproto"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// mitsubishi implements the 144 bits protocol used by Mitsubishi Electric heat pumps.
+// The frame is sent twice.
+type mitsubishi struct{}
+
+var mitsubishiTiming = irproto.Timing{
+	HeaderMark:  3400,
+	HeaderSpace: 1750,
+	BitMark:     450,
+	OneSpace:    1300,
+	ZeroSpace:   420,
+	Gap:         17100,
+}
+
+var mitsubishiModes = map[Mode]byte{
+	ModeHeat: 0x08,
+	ModeDry:  0x10,
+	ModeCool: 0x18,
+	ModeAuto: 0x20,
+}
+
+// mitsubishiModeExtra holds the mode dependent value of byte 8
+var mitsubishiModeExtra = map[Mode]byte{
+	ModeHeat: 0x30,
+	ModeDry:  0x32,
+	ModeCool: 0x36,
+	ModeAuto: 0x30,
+}
+
+const (
+	mitsubishiPowerOn  = 0x20
+	mitsubishiVaneAuto = 0x40
+	mitsubishiSwing    = 0x78
+	mitsubishiFanAuto  = 0x80
+)
+
+func init() {
+	register(mitsubishi{})
+}
+
+func (mitsubishi) Name() string {
+	return "mitsubishi"
+}
+
+func (mitsubishi) Capabilities() Capabilities {
+	return Capabilities{
+		Modes:          []Mode{ModeAuto, ModeCool, ModeHeat, ModeDry},
+		MinTemperature: 16,
+		MaxTemperature: 31,
+		FanSpeeds:      4,
+		Swing:          true,
+	}
+}
+
+// frame returns the bytes of the frame.
+func (mitsubishi) frame(s State) []byte {
+	data := make([]byte, 18)
+	copy(data, []byte{0x23, 0xcb, 0x26, 0x01, 0x00})
+	if s.Power {
+		data[5] = mitsubishiPowerOn
+	}
+	data[6] = mitsubishiModes[s.Mode]
+	data[7] = byte(s.Temperature - 16)
+	data[8] = mitsubishiModeExtra[s.Mode]
+
+	if s.Fan == FanAuto {
+		data[9] = mitsubishiFanAuto
+	} else {
+		data[9] = byte(s.Fan)
+	}
+	if s.Swing {
+		data[9] |= mitsubishiSwing
+	} else {
+		data[9] |= mitsubishiVaneAuto
+	}
+	data[17] = sum(data[:17])
+	return data
+}
+
+func (m mitsubishi) Encode(s State) remotes.IRCommand {
+	data := m.frame(s)
+	p := irproto.Pulses{}
+	for i := 0; i < 2; i++ {
+		p.Header(mitsubishiTiming)
+		p.Bytes(data, mitsubishiTiming)
+		p.Footer(mitsubishiTiming)
+	}
+	return p.Broadlink()
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/mixcode/broadlink"
@@ -11,12 +12,26 @@ import (
 
 // DeviceInfo holds the information to access a Broadlink device on the network.
 type DeviceInfo struct {
-	Name       string `json:"name"`
-	UDPAddress string `json:"udpAddress"`
-	MACAddress string `json:"macAddress"`
-	Type       uint16 `json:"type"`
-	TypeName   string `json:"typeName,omitempty"`
-	device     *broadlink.Device
+	Name       string `json:"name" yaml:"name"`
+	UDPAddress string `json:"udpAddress" yaml:"udpAddress"`
+	MACAddress string `json:"macAddress" yaml:"macAddress"`
+	Type       uint16 `json:"type" yaml:"type"`
+	TypeName   string `json:"typeName,omitempty" yaml:"typeName,omitempty"`
+	// Room is where the device is, it sends the commands of the remotes of the same room.
+	Room   string `json:"room,omitempty" yaml:"room,omitempty"`
+	device *broadlink.Device
+	// mutex serializes calls to the device, which is not safe for concurrent use.
+	mutex sync.Mutex
+	// captureMutex allows a single capture at a time. It is held for the whole capture, unlike mutex.
+	captureMutex sync.Mutex
+	// capturing is set while the device is in learning mode, with mutex held.
+	capturing bool
+}
+
+// SupportsIR tells whether the Broadlink device type is an IR blaster, from the RM family.
+func SupportsIR(deviceType uint16) bool {
+	_, class := (&broadlink.Device{Type: deviceType}).DeviceName()
+	return class == "RM"
 }
 
 // DeviceInfoList represents a list of Broadlink device info.
@@ -85,6 +100,94 @@ func (d *DeviceInfo) InitializeDevice(timeout time.Duration) error {
 	return nil
 }
 
+// Reauthenticate authenticates with the device again, like when it rebooted and sending fails.
+func (d *DeviceInfo) Reauthenticate(timeout time.Duration) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.device != nil {
+		d.device.ID = 0
+	}
+	return d.InitializeDevice(timeout)
+}
+
+// MaxRepeat is the highest repeat count of an IR code, which the device receives in one byte.
+const MaxRepeat = 256
+
+// SendIRCode sends the IR code, repeated count times, from 1 to MaxRepeat.
+// The device must be initialized.
+func (d *DeviceInfo) SendIRCode(code []byte, count int) error {
+	if count < 1 || count > MaxRepeat {
+		return fmt.Errorf("invalid repeat count %d, expected 1 to %d", count, MaxRepeat)
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err := d.device.SendIRRemoteCode(code, count); err != nil {
+		return err
+	}
+	if d.capturing {
+		// Sending leaves learning mode, resume the capture
+		_ = d.device.StartCaptureRemoteControlCode()
+	}
+	return nil
+}
+
+// ErrCaptureTimeout is returned when no IR code was received before the capture timeout.
+var ErrCaptureTimeout = fmt.Errorf("timed out waiting for IR control codes")
+
+// ErrCaptureCanceled is returned when the capture was stopped before receiving an IR code.
+var ErrCaptureCanceled = fmt.Errorf("IR control code capture canceled")
+
+// captureInterval is the delay between two reads of the captured IR code
+const captureInterval = time.Second
+
+// CaptureIRCode puts the device in learning mode, then waits for an IR code until timeout or until stop is closed.
+// waiting, when not nil, is called with the remaining time every time the device is polled.
+// The device must be initialized. IR codes can still be sent during the capture, a single capture runs at a time.
+func (d *DeviceInfo) CaptureIRCode(timeout time.Duration, stop <-chan struct{}, waiting func(remaining time.Duration)) ([]byte, error) {
+	d.captureMutex.Lock()
+	defer d.captureMutex.Unlock()
+
+	d.mutex.Lock()
+	err := d.device.StartCaptureRemoteControlCode()
+	d.capturing = err == nil
+	d.mutex.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start capture mode, %s", err)
+	}
+	defer func() {
+		d.mutex.Lock()
+		d.capturing = false
+		d.mutex.Unlock()
+	}()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if waiting != nil {
+			waiting(time.Until(deadline))
+		}
+		// The device is only locked while polled, so that sending is not blocked by the capture
+		d.mutex.Lock()
+		remoteType, code, err := d.device.ReadCapturedRemoteControlCode()
+		d.mutex.Unlock()
+		if err == nil {
+			if remoteType != broadlink.REMOTE_IR {
+				return nil, fmt.Errorf("received unexpected command type %x (expected infra-red type %x)", remoteType, broadlink.REMOTE_IR)
+			}
+			return code, nil
+		}
+		if err != broadlink.ErrNotCaptured {
+			return nil, err
+		}
+
+		select {
+		case <-stop:
+			return nil, ErrCaptureCanceled
+		case <-time.After(captureInterval):
+		}
+	}
+	return nil, ErrCaptureTimeout
+}
+
 func (dl *DeviceInfoList) AddDevice(name string, device broadlink.Device) error {
 	dev := NewDeviceInfo(name, device)
 
@@ -67,3 +67,12 @@ func TestDeviceList_Find(t *testing.T) {
 	g.Expect(found).To(BeFalse())
 	g.Expect(res).To(BeNil())
 }
+
+func TestDeviceInfo_SendIRCodeCount(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// Counts the device cannot receive are rejected before reaching it
+	d := &DeviceInfo{Name: "office"}
+	g.Expect(d.SendIRCode([]byte{0x26, 0x00}, 0)).To(MatchError("invalid repeat count 0, expected 1 to 256"))
+	g.Expect(d.SendIRCode([]byte{0x26, 0x00}, 300)).To(MatchError("invalid repeat count 300, expected 1 to 256"))
+}
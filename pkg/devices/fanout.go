@@ -0,0 +1,75 @@
+package devices
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SendResult is the outcome of sending with a device.
+type SendResult struct {
+	Device  string `json:"device"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Latency is the send duration, in milliseconds.
+	Latency float64 `json:"latency"`
+	err     error
+}
+
+// SendResults lists the outcome of sending with every device of a fan-out.
+type SendResults []SendResult
+
+// Succeeded returns the number of devices which succeeded.
+func (sr SendResults) Succeeded() int {
+	count := 0
+	for _, r := range sr {
+		if r.Success {
+			count++
+		}
+	}
+	return count
+}
+
+// Err returns nil when every device succeeded, or with allowPartial, when any device succeeded.
+func (sr SendResults) Err(allowPartial bool) error {
+	succeeded := sr.Succeeded()
+	if succeeded == len(sr) || (allowPartial && succeeded > 0) {
+		return nil
+	}
+	if len(sr) == 1 {
+		return sr[0].err
+	}
+	failures := []string{}
+	for _, r := range sr {
+		if !r.Success {
+			failures = append(failures, fmt.Sprintf("device %q, %s", r.Device, r.Error))
+		}
+	}
+	return fmt.Errorf("%d of %d devices failed: %s", len(sr)-succeeded, len(sr), strings.Join(failures, "; "))
+}
+
+// FanOut calls send with every device concurrently, then returns the results in list order.
+func (dl DeviceInfoList) FanOut(send func(d *DeviceInfo) error) SendResults {
+	results := make(SendResults, len(dl))
+	wg := sync.WaitGroup{}
+	for idx, d := range dl {
+		wg.Add(1)
+		go func(idx int, d *DeviceInfo) {
+			defer wg.Done()
+			start := time.Now()
+			err := send(d)
+			results[idx] = SendResult{
+				Device:  d.Name,
+				Success: err == nil,
+				Latency: time.Since(start).Seconds() * 1000,
+				err:     err,
+			}
+			if err != nil {
+				results[idx].Error = err.Error()
+			}
+		}(idx, d)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,46 @@
+package devices
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDeviceInfoList_FanOut(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dl := DeviceInfoList{{Name: "shelf"}, {Name: "ceiling"}, {Name: "office"}}
+
+	// Devices are called concurrently: every call waits for the others
+	started := sync.WaitGroup{}
+	started.Add(len(dl))
+	results := dl.FanOut(func(d *DeviceInfo) error {
+		started.Done()
+		started.Wait()
+		if d.Name == "ceiling" {
+			return fmt.Errorf("timeout")
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	g.Expect(results).To(HaveLen(3))
+	g.Expect(results[0].Device).To(Equal("shelf"))
+	g.Expect(results[0].Success).To(BeTrue())
+	g.Expect(results[0].Latency).To(BeNumerically(">=", 1))
+	g.Expect(results[1].Device).To(Equal("ceiling"))
+	g.Expect(results[1].Success).To(BeFalse())
+	g.Expect(results[1].Error).To(Equal("timeout"))
+	g.Expect(results.Succeeded()).To(Equal(2))
+
+	g.Expect(results.Err(true)).To(Succeed())
+	g.Expect(results.Err(false)).To(MatchError(`1 of 3 devices failed: device "ceiling", timeout`))
+
+	results = DeviceInfoList{{Name: "shelf"}}.FanOut(func(*DeviceInfo) error {
+		return fmt.Errorf("timeout")
+	})
+	g.Expect(results.Err(true)).To(MatchError("timeout"))
+	g.Expect(DeviceInfoList{{Name: "shelf"}}.FanOut(func(*DeviceInfo) error { return nil }).Err(false)).To(Succeed())
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	// TypeCommand is published every time a command is sent, with CommandData.
+	TypeCommand = "command"
+	// TypeDevice is published when a device becomes available or unavailable, with DeviceData.
+	TypeDevice = "device"
+	// TypeConfig is published when remotes or other configuration files change, with ConfigData.
+	TypeConfig = "config"
+)
+
+// subscriberBuffer is the number of events kept for a subscriber that is not keeping up.
+const subscriberBuffer = 64
+
+// Event is published on the bus.
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// CommandData describes a command send.
+type CommandData struct {
+	Remote  string `json:"remote"`
+	Command string `json:"command"`
+	Device  string `json:"device"`
+	// Caller tells who sent the command, like http:alice, mqtt, homekit or scheduler.
+	Caller string `json:"caller"`
+	// RequestID identifies the HTTP request which sent the command, if any.
+	RequestID string `json:"requestId,omitempty"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+	// Latency is the send duration, in milliseconds.
+	Latency float64 `json:"latency"`
+}
+
+// DeviceData describes a device state transition.
+type DeviceData struct {
+	Device    string `json:"device"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ConfigData describes a configuration change.
+type ConfigData struct {
+	// File is the configuration that changed, like remotes or devices.
+	File string `json:"file"`
+	// Source tells what triggered the change, like api or reload.
+	Source string `json:"source"`
+}
+
+// Subscription receives events published on the bus.
+type Subscription struct {
+	bus    *Bus
+	events chan Event
+	// dropped counts the events not delivered because the buffer was full
+	dropped int
+}
+
+// Events returns the channel of events, closed when unsubscribing.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Unsubscribe stops receiving events.
+func (s *Subscription) Unsubscribe() {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+	if _, found := s.bus.subscriptions[s]; found {
+		delete(s.bus.subscriptions, s)
+		close(s.events)
+	}
+}
+
+// Dropped returns the number of events dropped because the subscriber did not keep up.
+func (s *Subscription) Dropped() int {
+	s.bus.mutex.Lock()
+	defer s.bus.mutex.Unlock()
+	return s.dropped
+}
+
+// Bus is an in-process event bus. Publishing never blocks: events are dropped for subscribers that do not keep up.
+type Bus struct {
+	mutex         sync.Mutex
+	subscriptions map[*Subscription]bool
+}
+
+// NewBus creates an event bus.
+func NewBus() *Bus {
+	return &Bus{
+		subscriptions: make(map[*Subscription]bool),
+	}
+}
+
+// Subscribe returns a subscription to every event published from now on.
+func (b *Bus) Subscribe() *Subscription {
+	s := &Subscription{
+		bus:    b,
+		events: make(chan Event, subscriberBuffer),
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscriptions[s] = true
+	return s
+}
+
+// Publish sends an event to every subscriber.
+func (b *Bus) Publish(eventType string, data interface{}) {
+	e := Event{
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for s := range b.subscriptions {
+		select {
+		case s.events <- e:
+		default:
+			s.dropped++
+		}
+	}
+}
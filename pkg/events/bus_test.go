@@ -0,0 +1,39 @@
+package events
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestBus(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	b := NewBus()
+	// Publishing without subscribers is fine
+	b.Publish(TypeConfig, ConfigData{File: "remotes.json", Source: "api"})
+
+	s1 := b.Subscribe()
+	s2 := b.Subscribe()
+	b.Publish(TypeCommand, CommandData{Remote: "tv", Command: "power", Success: true})
+
+	for _, s := range []*Subscription{s1, s2} {
+		var e Event
+		g.Expect(s.Events()).To(Receive(&e))
+		g.Expect(e.Type).To(Equal(TypeCommand))
+		g.Expect(e.Time.IsZero()).To(BeFalse())
+		g.Expect(e.Data).To(Equal(CommandData{Remote: "tv", Command: "power", Success: true}))
+	}
+
+	s2.Unsubscribe()
+	g.Expect(s2.Events()).To(BeClosed())
+	// Unsubscribing twice is fine
+	s2.Unsubscribe()
+
+	// Slow subscribers lose events, without blocking publishers
+	for i := 0; i < subscriberBuffer+10; i++ {
+		b.Publish(TypeDevice, DeviceData{Device: "office", Available: true})
+	}
+	g.Expect(s1.Events()).To(HaveLen(subscriberBuffer))
+	g.Expect(s1.Dropped()).To(Equal(10))
+}
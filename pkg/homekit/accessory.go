@@ -0,0 +1,156 @@
+package homekit
+
+import (
+	"fmt"
+)
+
+// HAP service and characteristic types, in their short form.
+const (
+	serviceAccessoryInformation = "3E"
+	serviceProtocolInformation  = "A2"
+	serviceSwitch               = "49"
+
+	charIdentify         = "14"
+	charManufacturer     = "20"
+	charModel            = "21"
+	charName             = "23"
+	charOn               = "25"
+	charSerialNumber     = "30"
+	charVersion          = "37"
+	charFirmwareRevision = "52"
+)
+
+// HAP status codes, reported per characteristic.
+const (
+	statusSuccess                = 0
+	statusCommunicationError     = -70402
+	statusReadOnly               = -70404
+	statusWriteOnly              = -70405
+	statusNotificationDenied     = -70406
+	statusResourceNotFound       = -70409
+	statusInvalidValue           = -70410
+	statusInsufficientPrivileges = -70401
+)
+
+const (
+	manufacturer    = "ir-remotes"
+	protocolVersion = "1.1.0"
+	bridgeAID       = 1
+)
+
+type characteristic struct {
+	IID    int         `json:"iid"`
+	Type   string      `json:"type"`
+	Perms  []string    `json:"perms"`
+	Format string      `json:"format"`
+	Value  interface{} `json:"value,omitempty"`
+}
+
+func (c *characteristic) hasPerm(perm string) bool {
+	for _, p := range c.Perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+type service struct {
+	IID             int               `json:"iid"`
+	Type            string            `json:"type"`
+	Primary         bool              `json:"primary,omitempty"`
+	Characteristics []*characteristic `json:"characteristics"`
+}
+
+type accessory struct {
+	AID      int        `json:"aid"`
+	Services []*service `json:"services"`
+	// sw is the switch exposed by the accessory. Nil for the bridge.
+	sw *Switch
+}
+
+// accessoryDB holds every accessory exposed by the bridge.
+type accessoryDB struct {
+	Accessories []*accessory `json:"accessories"`
+}
+
+func stringChar(iid int, typ string, value string) *characteristic {
+	return &characteristic{IID: iid, Type: typ, Perms: []string{"pr"}, Format: "string", Value: value}
+}
+
+func informationService(name string, model string, serial string, version string) *service {
+	return &service{
+		IID:  1,
+		Type: serviceAccessoryInformation,
+		Characteristics: []*characteristic{
+			{IID: 2, Type: charIdentify, Perms: []string{"pw"}, Format: "bool"},
+			stringChar(3, charManufacturer, manufacturer),
+			stringChar(4, charModel, model),
+			stringChar(5, charName, name),
+			stringChar(6, charSerialNumber, serial),
+			stringChar(7, charFirmwareRevision, version),
+		},
+	}
+}
+
+// newAccessoryDB builds the accessories for the given switches, using the persisted accessory identifiers.
+func newAccessoryDB(name string, version string, deviceID string, switches []Switch, aids map[string]int) *accessoryDB {
+	db := &accessoryDB{}
+	bridge := &accessory{
+		AID: bridgeAID,
+		Services: []*service{
+			informationService(name, "Bridge", deviceID, version),
+			{
+				IID:  8,
+				Type: serviceProtocolInformation,
+				Characteristics: []*characteristic{
+					stringChar(9, charVersion, protocolVersion),
+				},
+			},
+		},
+	}
+	db.Accessories = append(db.Accessories, bridge)
+
+	for idx := range switches {
+		sw := &switches[idx]
+		acc := &accessory{
+			AID: aids[sw.key()],
+			Services: []*service{
+				informationService(sw.Name, "Switch", sw.key(), version),
+				{
+					IID:     8,
+					Type:    serviceSwitch,
+					Primary: true,
+					Characteristics: []*characteristic{
+						{IID: 9, Type: charOn, Perms: []string{"pr", "pw", "ev"}, Format: "bool", Value: false},
+						stringChar(10, charName, sw.Name),
+					},
+				},
+			},
+			sw: sw,
+		}
+		db.Accessories = append(db.Accessories, acc)
+	}
+	return db
+}
+
+func (db *accessoryDB) find(aid int, iid int) (*accessory, *characteristic) {
+	for _, a := range db.Accessories {
+		if a.AID != aid {
+			continue
+		}
+		for _, s := range a.Services {
+			for _, c := range s.Characteristics {
+				if c.IID == iid {
+					return a, c
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// charID identifies a characteristic, formatted like the id query parameter of the characteristics endpoint.
+func charID(aid int, iid int) string {
+	return fmt.Sprintf("%d.%d", aid, iid)
+}
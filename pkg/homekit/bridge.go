@@ -0,0 +1,272 @@
+package homekit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+// maxSwitches is the number of accessories a bridge can expose, besides itself.
+const maxSwitches = 149
+
+var pinFormat = regexp.MustCompile(`^\d{3}-\d{2}-\d{3}$`)
+
+// Trivial setup codes are rejected by iOS
+var invalidPINs = map[string]bool{
+	"000-00-000": true, "111-11-111": true, "222-22-222": true, "333-33-333": true,
+	"444-44-444": true, "555-55-555": true, "666-66-666": true, "777-77-777": true,
+	"888-88-888": true, "999-99-999": true, "123-45-678": true, "876-54-321": true,
+}
+
+// Switch is a command exposed as a stateless HomeKit switch: turning it on sends the command, then the switch turns itself off.
+type Switch struct {
+	Name    string
+	Remote  string
+	Command string
+}
+
+func (s Switch) key() string {
+	return s.Remote + "/" + s.Command
+}
+
+// Sender sends the IR command of a remote.
+type Sender func(remote string, command string) error
+
+// Config holds the bridge settings.
+type Config struct {
+	// Name is the bridge name, shown when pairing.
+	Name string
+	// PIN is the setup code entered when pairing, formatted like 123-45-987.
+	PIN string
+	// Address is the TCP listen address of the HAP server.
+	Address string
+	// StateFile is where the bridge identity and pairings are persisted.
+	StateFile string
+	// Version is reported as firmware revision.
+	Version  string
+	Switches []Switch
+}
+
+// Bridge is a HomeKit bridge, exposing switches to iOS devices on the local network.
+type Bridge struct {
+	config Config
+	send   Sender
+
+	mutex    sync.Mutex
+	state    *state
+	db       *accessoryDB
+	sessions map[*session]bool
+	// pairSetup is the session performing pair setup, only one is allowed at a time
+	pairSetup *session
+	// idleTimeout is the time after which unverified connections are closed when idle
+	idleTimeout time.Duration
+
+	listener net.Listener
+	mdns     *mdnsResponder
+}
+
+// checkSwitches fails when the switches cannot be exposed together.
+func checkSwitches(switches []Switch) error {
+	if len(switches) > maxSwitches {
+		return fmt.Errorf("too many switches (%d), a bridge supports at most %d", len(switches), maxSwitches)
+	}
+	keys := make(map[string]bool)
+	for _, sw := range switches {
+		if keys[sw.key()] {
+			return fmt.Errorf("duplicate switch for command %s", sw.key())
+		}
+		keys[sw.key()] = true
+	}
+	return nil
+}
+
+// NewBridge creates a bridge exposing the switches. Identity and pairings are loaded from the state file.
+func NewBridge(config Config, send Sender) (*Bridge, error) {
+	if !pinFormat.MatchString(config.PIN) || invalidPINs[config.PIN] {
+		return nil, fmt.Errorf("invalid setup code %q, expected a non trivial code formatted like 123-45-987", config.PIN)
+	}
+	if err := checkSwitches(config.Switches); err != nil {
+		return nil, err
+	}
+
+	st, err := loadState(config.StateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load HomeKit state, %s", err)
+	}
+	b := &Bridge{
+		config:      config,
+		send:        send,
+		state:       st,
+		sessions:    make(map[*session]bool),
+		idleTimeout: unverifiedIdleTimeout,
+	}
+	b.buildAccessories()
+	if err := b.saveState(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// buildAccessories builds the accessories of the configured switches, returning whether they changed.
+// The configuration number is incremented when they changed, so that controllers refresh them.
+// Must be called with the mutex held, or before the bridge is started.
+func (b *Bridge) buildAccessories() bool {
+	b.state.assignAIDs(b.config.Switches)
+	b.db = newAccessoryDB(b.config.Name, b.config.Version, b.state.DeviceID, b.config.Switches, b.state.AIDs)
+
+	raw, _ := json.Marshal(b.db)
+	hash := sha256.Sum256(raw)
+	configHash := hex.EncodeToString(hash[:])
+	if configHash == b.state.ConfigHash {
+		return false
+	}
+	if b.state.ConfigHash != "" {
+		b.state.ConfigNumber++
+	}
+	b.state.ConfigHash = configHash
+	return true
+}
+
+// SetSwitches replaces the exposed switches, like when remotes were edited.
+// Switches keep their accessory identifier, controllers are notified when accessories changed.
+func (b *Bridge) SetSwitches(switches []Switch) error {
+	if err := checkSwitches(switches); err != nil {
+		return err
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.config.Switches = append([]Switch(nil), switches...)
+	if !b.buildAccessories() {
+		return nil
+	}
+	if err := b.saveState(); err != nil {
+		return err
+	}
+	if b.mdns != nil {
+		go b.mdns.announce()
+	}
+	return nil
+}
+
+// saveState saves the state, holding the bridge private key, only readable by its owner.
+func (b *Bridge) saveState() error {
+	if err := utils.SaveToFilePrivate(b.state, b.config.StateFile); err != nil {
+		return fmt.Errorf("failed to save HomeKit state, %s", err)
+	}
+	// Previous versions kept backups, holding old keys and pairings
+	for n := 1; n <= utils.Backups; n++ {
+		os.Remove(fmt.Sprintf("%s.%d", b.config.StateFile, n))
+	}
+	return nil
+}
+
+// Start listens for controller connections and advertises the bridge on the local network.
+func (b *Bridge) Start() error {
+	l, err := net.Listen("tcp", b.config.Address)
+	if err != nil {
+		return err
+	}
+	b.listener = l
+
+	port := l.Addr().(*net.TCPAddr).Port
+	b.mdns, err = newMDNSResponder(b.config.Name, port, b.txtRecords)
+	if err != nil {
+		l.Close()
+		return fmt.Errorf("failed to start mDNS responder, %s", err)
+	}
+	go b.mdns.run()
+	go b.accept()
+
+	log.WithFields(log.Fields{
+		"address":   l.Addr().String(),
+		"device-id": b.state.DeviceID,
+		"paired":    b.state.paired(),
+	}).Info("HomeKit bridge started")
+	return nil
+}
+
+// Close stops listening and closes every controller connection.
+func (b *Bridge) Close() {
+	if b.mdns != nil {
+		b.mdns.close()
+	}
+	if b.listener != nil {
+		b.listener.Close()
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+// txtRecords returns the HAP service TXT records, which change with pairing status.
+func (b *Bridge) txtRecords() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	statusFlag := "1"
+	if b.state.paired() {
+		statusFlag = "0"
+	}
+	return []string{
+		"c#=" + strconv.Itoa(b.state.ConfigNumber),
+		"ff=0",
+		"id=" + b.state.DeviceID,
+		"md=" + b.config.Name,
+		"pv=1.1",
+		"s#=1",
+		"sf=" + statusFlag,
+		// Accessory category: bridge
+		"ci=2",
+	}
+}
+
+func (b *Bridge) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.serveConn(conn)
+	}
+}
+
+// serveConn serves the controller connection until it is closed.
+func (b *Bridge) serveConn(conn net.Conn) {
+	s := newSession(b, conn)
+	b.mutex.Lock()
+	b.sessions[s] = true
+	b.mutex.Unlock()
+
+	s.serve()
+	b.mutex.Lock()
+	delete(b.sessions, s)
+	if b.pairSetup == s {
+		b.pairSetup = nil
+	}
+	b.mutex.Unlock()
+}
+
+// pairingsChanged persists the pairings and advertises the new pairing status.
+// Must be called with the mutex held.
+func (b *Bridge) pairingsChanged() error {
+	if err := b.saveState(); err != nil {
+		return err
+	}
+	if b.mdns != nil {
+		go b.mdns.announce()
+	}
+	return nil
+}
@@ -0,0 +1,404 @@
+package homekit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+const testPIN = "031-45-154"
+
+// testController implements the controller side of the HAP protocol.
+type testController struct {
+	g       *GomegaWithT
+	id      string
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+	conn    *secureConn
+	reader  *bufio.Reader
+}
+
+func newTestController(g *GomegaWithT, b *Bridge) *testController {
+	client, server := net.Pipe()
+	go b.serveConn(server)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).ToNot(HaveOccurred())
+	conn := newSecureConn(client)
+	return &testController{
+		g:       g,
+		id:      "11111111-2222-3333-4444-555555555555",
+		public:  public,
+		private: private,
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+	}
+}
+
+func (c *testController) do(method string, path string, contentType string, body []byte) (int, []byte) {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %s HTTP/1.1\r\nHost: bridge\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n", method, path, contentType, len(body))
+	buf.Write(body)
+	_, err := c.conn.Write(buf.Bytes())
+	c.g.Expect(err).ToNot(HaveOccurred())
+
+	res, err := http.ReadResponse(c.reader, nil)
+	c.g.Expect(err).ToNot(HaveOccurred())
+	defer res.Body.Close()
+	out, err := ioutil.ReadAll(res.Body)
+	c.g.Expect(err).ToNot(HaveOccurred())
+	return res.StatusCode, out
+}
+
+func (c *testController) tlv(path string, req tlv8) tlv8 {
+	status, body := c.do(http.MethodPost, path, contentTypeTLV8, req.encode())
+	c.g.Expect(status).To(Equal(http.StatusOK))
+	res, err := decodeTLV8(body)
+	c.g.Expect(err).ToNot(HaveOccurred())
+	return res
+}
+
+// pairSetup runs the pair setup procedure, returning the TLV8 error code of the first failing step.
+func (c *testController) pairSetup(pin string) byte {
+	req := tlv8{}
+	req.addByte(tlvState, 1)
+	req.addByte(tlvMethod, methodPairSetup)
+	res := c.tlv("/pair-setup", req)
+	if code, found := res.getByte(tlvError); found {
+		return code
+	}
+	salt, _ := res.get(tlvSalt)
+	serverPublicKey, _ := res.get(tlvPublicKey)
+
+	// SRP client
+	grp := srpHomeKit
+	a, err := rand.Int(rand.Reader, grp.N)
+	c.g.Expect(err).ToNot(HaveOccurred())
+	A := new(big.Int).Exp(grp.g, a, grp.N)
+	B := new(big.Int).SetBytes(serverPublicKey)
+	x := grp.x(salt, pin)
+	u := grp.u(A, B)
+	base := new(big.Int).Sub(B, new(big.Int).Mul(grp.k(), new(big.Int).Exp(grp.g, x, grp.N)))
+	base.Mod(base, grp.N)
+	S := new(big.Int).Exp(base, new(big.Int).Add(a, new(big.Int).Mul(u, x)), grp.N)
+	K := grp.H(S.Bytes())
+	M1 := grp.clientProof(salt, A, B, K)
+
+	req = tlv8{}
+	req.addByte(tlvState, 3)
+	req.add(tlvPublicKey, A.Bytes())
+	req.add(tlvProof, M1)
+	res = c.tlv("/pair-setup", req)
+	if code, found := res.getByte(tlvError); found {
+		return code
+	}
+	M2, _ := res.get(tlvProof)
+	c.g.Expect(M2).To(Equal(grp.H(A.Bytes(), M1, K)))
+
+	sessionKey, err := deriveKey(K, "Pair-Setup-Encrypt-Salt", "Pair-Setup-Encrypt-Info")
+	c.g.Expect(err).ToNot(HaveOccurred())
+	controllerX, err := deriveKey(K, "Pair-Setup-Controller-Sign-Salt", "Pair-Setup-Controller-Sign-Info")
+	c.g.Expect(err).ToNot(HaveOccurred())
+	info := append(append(controllerX, c.id...), c.public...)
+	sub := tlv8{}
+	sub.add(tlvIdentifier, []byte(c.id))
+	sub.add(tlvPublicKey, c.public)
+	sub.add(tlvSignature, ed25519.Sign(c.private, info))
+	encrypted, err := seal(sessionKey, namedNonce("PS-Msg05"), sub.encode(), nil)
+	c.g.Expect(err).ToNot(HaveOccurred())
+
+	req = tlv8{}
+	req.addByte(tlvState, 5)
+	req.add(tlvEncryptedData, encrypted)
+	res = c.tlv("/pair-setup", req)
+	if code, found := res.getByte(tlvError); found {
+		return code
+	}
+	encrypted, _ = res.get(tlvEncryptedData)
+	decrypted, err := open(sessionKey, namedNonce("PS-Msg06"), encrypted, nil)
+	c.g.Expect(err).ToNot(HaveOccurred())
+	sub, err = decodeTLV8(decrypted)
+	c.g.Expect(err).ToNot(HaveOccurred())
+	accessoryID, _ := sub.get(tlvIdentifier)
+	accessoryLTPK, _ := sub.get(tlvPublicKey)
+	signature, _ := sub.get(tlvSignature)
+	accessoryX, err := deriveKey(K, "Pair-Setup-Accessory-Sign-Salt", "Pair-Setup-Accessory-Sign-Info")
+	c.g.Expect(err).ToNot(HaveOccurred())
+	info = append(append(accessoryX, accessoryID...), accessoryLTPK...)
+	c.g.Expect(ed25519.Verify(accessoryLTPK, info, signature)).To(BeTrue())
+	return 0
+}
+
+// pairVerify runs the pair verify procedure, then encrypts the connection.
+func (c *testController) pairVerify() byte {
+	var secretKey, publicKey, serverPublicKey, shared [32]byte
+	_, err := rand.Read(secretKey[:])
+	c.g.Expect(err).ToNot(HaveOccurred())
+	curve25519.ScalarBaseMult(&publicKey, &secretKey)
+
+	req := tlv8{}
+	req.addByte(tlvState, 1)
+	req.add(tlvPublicKey, publicKey[:])
+	res := c.tlv("/pair-verify", req)
+	if code, found := res.getByte(tlvError); found {
+		return code
+	}
+	value, _ := res.get(tlvPublicKey)
+	copy(serverPublicKey[:], value)
+	curve25519.ScalarMult(&shared, &secretKey, &serverPublicKey)
+	sessionKey, err := deriveKey(shared[:], "Pair-Verify-Encrypt-Salt", "Pair-Verify-Encrypt-Info")
+	c.g.Expect(err).ToNot(HaveOccurred())
+	encrypted, _ := res.get(tlvEncryptedData)
+	_, err = open(sessionKey, namedNonce("PV-Msg02"), encrypted, nil)
+	c.g.Expect(err).ToNot(HaveOccurred())
+
+	info := append(append(publicKey[:], c.id...), serverPublicKey[:]...)
+	sub := tlv8{}
+	sub.add(tlvIdentifier, []byte(c.id))
+	sub.add(tlvSignature, ed25519.Sign(c.private, info))
+	encrypted, err = seal(sessionKey, namedNonce("PV-Msg03"), sub.encode(), nil)
+	c.g.Expect(err).ToNot(HaveOccurred())
+
+	req = tlv8{}
+	req.addByte(tlvState, 3)
+	req.add(tlvEncryptedData, encrypted)
+	res = c.tlv("/pair-verify", req)
+	if code, found := res.getByte(tlvError); found {
+		return code
+	}
+
+	// The controller keys are the accessory ones, swapped
+	c.g.Expect(c.conn.enableEncryption(shared[:])).To(Succeed())
+	c.conn.readKey, c.conn.writeKey = c.conn.writeKey, c.conn.readKey
+	return 0
+}
+
+func newTestBridge(g *GomegaWithT, dir string, sent *[]string) *Bridge {
+	b, err := NewBridge(Config{
+		Name:      "IR Bridge",
+		PIN:       testPIN,
+		StateFile: filepath.Join(dir, "homekit.json"),
+		Version:   "1.0",
+		Switches: []Switch{
+			{Name: "TV Power", Remote: "tv", Command: "power"},
+			{Name: "TV Mute", Remote: "tv", Command: "mute"},
+		},
+	}, func(remote string, command string) error {
+		*sent = append(*sent, remote+"/"+command)
+		return nil
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	return b
+}
+
+func TestNewBridge(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "homekit")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	send := func(string, string) error { return nil }
+	_, err = NewBridge(Config{PIN: "123-45-678", StateFile: filepath.Join(dir, "state.json")}, send)
+	g.Expect(err).To(HaveOccurred())
+	_, err = NewBridge(Config{PIN: "12345678", StateFile: filepath.Join(dir, "state.json")}, send)
+	g.Expect(err).To(HaveOccurred())
+	_, err = NewBridge(Config{
+		PIN:       testPIN,
+		StateFile: filepath.Join(dir, "state.json"),
+		Switches:  []Switch{{Remote: "tv", Command: "power"}, {Remote: "tv", Command: "power"}},
+	}, send)
+	g.Expect(err).To(HaveOccurred())
+
+	sent := []string{}
+	b := newTestBridge(g, dir, &sent)
+	g.Expect(b.state.ConfigNumber).To(Equal(1))
+	g.Expect(b.state.AIDs).To(Equal(map[string]int{"tv/power": 2, "tv/mute": 3}))
+
+	// Restarting keeps the identity, removing a switch bumps the configuration number
+	b2, err := NewBridge(Config{
+		Name:      "IR Bridge",
+		PIN:       testPIN,
+		StateFile: filepath.Join(dir, "homekit.json"),
+		Version:   "1.0",
+		Switches:  []Switch{{Name: "TV Mute", Remote: "tv", Command: "mute"}},
+	}, send)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(b2.state.DeviceID).To(Equal(b.state.DeviceID))
+	g.Expect(b2.state.ConfigNumber).To(Equal(2))
+	g.Expect(b2.db.Accessories[1].AID).To(Equal(3))
+
+	// The state holds the private key: only its owner reads it, and no backup is kept
+	info, err := os.Stat(filepath.Join(dir, "homekit.json"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	g.Expect(filepath.Join(dir, "homekit.json.1")).ToNot(BeAnExistingFile())
+}
+
+func TestBridge_SetSwitches(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "homekit")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	sent := []string{}
+	b := newTestBridge(g, dir, &sent)
+	g.Expect(b.SetSwitches([]Switch{{Remote: "tv", Command: "power"}, {Remote: "tv", Command: "power"}})).ToNot(Succeed())
+	g.Expect(b.db.Accessories).To(HaveLen(3))
+
+	// Unchanged switches keep the configuration number
+	g.Expect(b.SetSwitches(b.config.Switches)).To(Succeed())
+	g.Expect(b.state.ConfigNumber).To(Equal(1))
+
+	// Switches keep their identifier, new ones get the next
+	g.Expect(b.SetSwitches([]Switch{
+		{Name: "TV Mute", Remote: "tv", Command: "mute"},
+		{Name: "Radio Power", Remote: "radio", Command: "power"},
+	})).To(Succeed())
+	g.Expect(b.state.ConfigNumber).To(Equal(2))
+	g.Expect(b.db.Accessories).To(HaveLen(3))
+	g.Expect(b.db.Accessories[1].AID).To(Equal(3))
+	g.Expect(b.db.Accessories[2].AID).To(Equal(4))
+	_, c := b.db.find(2, 9)
+	g.Expect(c).To(BeNil())
+	// Resetting a removed switch is ignored
+	b.setValue(2, 9, false, nil)
+
+	st, err := loadState(filepath.Join(dir, "homekit.json"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(st.ConfigNumber).To(Equal(2))
+	g.Expect(st.AIDs).To(HaveKeyWithValue("radio/power", 4))
+}
+
+func TestPairing(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "homekit")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	sent := []string{}
+	b := newTestBridge(g, dir, &sent)
+	g.Expect(b.txtRecords()).To(ContainElement("sf=1"))
+
+	// Wrong setup code
+	c := newTestController(g, b)
+	g.Expect(c.pairSetup("111-22-333")).To(Equal(byte(tlvErrorAuthentication)))
+	g.Expect(b.isPaired()).To(BeFalse())
+
+	// Unverified connections are rejected
+	status, _ := c.do(http.MethodGet, "/accessories", contentTypeJSON, nil)
+	g.Expect(status).To(Equal(statusConnectionAuthorizationRequired))
+
+	g.Expect(c.pairSetup(testPIN)).To(BeZero())
+	g.Expect(b.isPaired()).To(BeTrue())
+	g.Expect(b.txtRecords()).To(ContainElement("sf=0"))
+	c.conn.Close()
+
+	// Pair setup is not allowed anymore
+	other := newTestController(g, b)
+	g.Expect(other.pairSetup(testPIN)).To(Equal(byte(tlvErrorUnavailable)))
+	// Unknown controllers are rejected
+	g.Expect(other.pairVerify()).To(Equal(byte(tlvErrorAuthentication)))
+	other.conn.Close()
+
+	// Pairing survives a restart
+	b = newTestBridge(g, dir, &sent)
+	c2 := newTestController(g, b)
+	c2.id, c2.public, c2.private = c.id, c.public, c.private
+	g.Expect(c2.pairVerify()).To(BeZero())
+
+	status, body := c2.do(http.MethodGet, "/accessories", contentTypeJSON, nil)
+	g.Expect(status).To(Equal(http.StatusOK))
+	db := accessoryDB{}
+	g.Expect(json.Unmarshal(body, &db)).To(Succeed())
+	g.Expect(db.Accessories).To(HaveLen(3))
+
+	status, body = c2.do(http.MethodGet, "/characteristics?id=2.9,3.9", contentTypeJSON, nil)
+	g.Expect(status).To(Equal(http.StatusOK))
+	g.Expect(string(body)).To(Equal(`{"characteristics":[{"aid":2,"iid":9,"value":false},{"aid":3,"iid":9,"value":false}]}`))
+
+	status, _ = c2.do(http.MethodPut, "/characteristics", contentTypeJSON, []byte(`{"characteristics":[{"aid":3,"iid":9,"value":true}]}`))
+	g.Expect(status).To(Equal(http.StatusNoContent))
+	g.Expect(sent).To(Equal([]string{"tv/mute"}))
+
+	status, body = c2.do(http.MethodPut, "/characteristics", contentTypeJSON, []byte(`{"characteristics":[{"aid":3,"iid":5,"value":"x"},{"aid":9,"iid":9,"value":true}]}`))
+	g.Expect(status).To(Equal(http.StatusMultiStatus))
+	g.Expect(string(body)).To(Equal(`{"characteristics":[{"aid":3,"iid":5,"status":-70404},{"aid":9,"iid":9,"status":-70409}]}`))
+
+	// Removing the only admin pairing unpairs the bridge
+	req := tlv8{}
+	req.addByte(tlvState, 1)
+	req.addByte(tlvMethod, methodListPairings)
+	res := c2.tlv("/pairings", req)
+	id, _ := res.get(tlvIdentifier)
+	g.Expect(string(id)).To(Equal(c.id))
+
+	req = tlv8{}
+	req.addByte(tlvState, 1)
+	req.addByte(tlvMethod, methodRemovePairing)
+	req.add(tlvIdentifier, []byte(c.id))
+	res = c2.tlv("/pairings", req)
+	_, failed := res.get(tlvError)
+	g.Expect(failed).To(BeFalse())
+	g.Expect(b.isPaired()).To(BeFalse())
+}
+
+func TestPairSetup_Limits(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "homekit")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	sent := []string{}
+	b := newTestBridge(g, dir, &sent)
+	b.idleTimeout = 100 * time.Millisecond
+
+	// A controller stopping after M1 holds pair setup until its connection is idle for too long
+	idle := newTestController(g, b)
+	req := tlv8{}
+	req.addByte(tlvState, 1)
+	req.addByte(tlvMethod, methodPairSetup)
+	res := idle.tlv("/pair-setup", req)
+	_, failed := res.get(tlvError)
+	g.Expect(failed).To(BeFalse())
+	c := newTestController(g, b)
+	g.Expect(c.pairSetup(testPIN)).To(Equal(byte(tlvErrorBusy)))
+	c.conn.Close()
+	g.Eventually(func() bool {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		return b.pairSetup == nil
+	}).Should(BeTrue())
+
+	// A wrong setup code releases pair setup and counts as a failed try, across restarts
+	c = newTestController(g, b)
+	g.Expect(c.pairSetup("111-22-333")).To(Equal(byte(tlvErrorAuthentication)))
+	c.conn.Close()
+	c = newTestController(g, b)
+	b.mutex.Lock()
+	g.Expect(b.pairSetup).To(BeNil())
+	g.Expect(b.state.FailedPairSetups).To(Equal(1))
+	b.state.FailedPairSetups = maxPairSetupTries - 1
+	b.mutex.Unlock()
+	g.Expect(c.pairSetup("111-22-333")).To(Equal(byte(tlvErrorAuthentication)))
+	g.Expect(c.pairSetup(testPIN)).To(Equal(byte(tlvErrorMaxTries)))
+	c.conn.Close()
+
+	b = newTestBridge(g, dir, &sent)
+	c = newTestController(g, b)
+	g.Expect(c.pairSetup(testPIN)).To(Equal(byte(tlvErrorMaxTries)))
+	g.Expect(b.isPaired()).To(BeFalse())
+	c.conn.Close()
+}
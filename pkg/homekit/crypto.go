@@ -0,0 +1,173 @@
+package homekit
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// maxFrameLength is the maximum plaintext length of an encrypted session frame.
+const (
+	maxFrameLength = 1024
+	// tagLength is the size of the Poly1305 authentication tag
+	tagLength = 16
+)
+
+// deriveKey derives a 32 bytes key from the shared secret, as done by every HomeKit procedure.
+func deriveKey(secret []byte, salt string, info string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha512.New, secret, []byte(salt), []byte(info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// namedNonce returns the 12 bytes nonce built from an 8 bytes name, like "PS-Msg05".
+func namedNonce(name string) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce[4:], name)
+	return nonce
+}
+
+func counterNonce(counter uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.LittleEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+func seal(key []byte, nonce []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+func open(key []byte, nonce []byte, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// secureConn wraps a controller connection. It is transparent until encryption is enabled, after pair verify.
+// Once enabled, data is exchanged in frames made of a 2 bytes little endian length, used as additional data,
+// followed by the encrypted payload and its authentication tag.
+type secureConn struct {
+	net.Conn
+
+	readMutex  sync.Mutex
+	writeMutex sync.Mutex
+
+	encrypted    bool
+	readKey      []byte
+	writeKey     []byte
+	readCounter  uint64
+	writeCounter uint64
+	readBuffer   []byte
+}
+
+func newSecureConn(conn net.Conn) *secureConn {
+	return &secureConn{Conn: conn}
+}
+
+// enableEncryption switches the connection to encrypted mode, using the keys derived from the pair verify shared secret.
+func (c *secureConn) enableEncryption(sharedSecret []byte) error {
+	readKey, err := deriveKey(sharedSecret, "Control-Salt", "Control-Write-Encryption-Key")
+	if err != nil {
+		return err
+	}
+	writeKey, err := deriveKey(sharedSecret, "Control-Salt", "Control-Read-Encryption-Key")
+	if err != nil {
+		return err
+	}
+
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.readKey = readKey
+	c.writeKey = writeKey
+	c.encrypted = true
+	return nil
+}
+
+func (c *secureConn) isEncrypted() bool {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.encrypted
+}
+
+func (c *secureConn) Read(b []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	if !c.encrypted {
+		return c.Conn.Read(b)
+	}
+	if len(c.readBuffer) == 0 {
+		if err := c.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.readBuffer)
+	c.readBuffer = c.readBuffer[n:]
+	return n, nil
+}
+
+func (c *secureConn) readFrame() error {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.Conn, header); err != nil {
+		return err
+	}
+	length := int(binary.LittleEndian.Uint16(header))
+	if length > maxFrameLength {
+		return fmt.Errorf("encrypted frame too long (%d bytes)", length)
+	}
+	ciphertext := make([]byte, length+tagLength)
+	if _, err := io.ReadFull(c.Conn, ciphertext); err != nil {
+		return err
+	}
+	plaintext, err := open(c.readKey, counterNonce(c.readCounter), ciphertext, header)
+	if err != nil {
+		return err
+	}
+	c.readCounter++
+	c.readBuffer = plaintext
+	return nil
+}
+
+func (c *secureConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if !c.encrypted {
+		return c.Conn.Write(b)
+	}
+	written := 0
+	for written < len(b) {
+		n := len(b) - written
+		if n > maxFrameLength {
+			n = maxFrameLength
+		}
+		header := make([]byte, 2)
+		binary.LittleEndian.PutUint16(header, uint16(n))
+		ciphertext, err := seal(c.writeKey, counterNonce(c.writeCounter), b[written:written+n], header)
+		if err != nil {
+			return written, err
+		}
+		c.writeCounter++
+		if _, err := c.Conn.Write(append(header, ciphertext...)); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
@@ -0,0 +1,103 @@
+package homekit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+// sharedSecret is the secret used by the known answer tests: bytes 0x00 to 0x1f.
+func sharedSecret() []byte {
+	secret := make([]byte, 32)
+	for idx := range secret {
+		secret[idx] = byte(idx)
+	}
+	return secret
+}
+
+// TestDeriveKey checks HKDF-SHA-512 against keys computed with OpenSSL:
+// openssl kdf -keylen 32 -kdfopt digest:SHA512 -kdfopt hexkey:<secret> -kdfopt salt:<salt> -kdfopt info:<info> HKDF
+func TestDeriveKey(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	key, err := deriveKey(sharedSecret(), "Control-Salt", "Control-Read-Encryption-Key")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(key).To(Equal(fromHex("c09403ef8aa6c5045cbd8cf9bf3e665b2caed623af2be0e87c8f80f519914d3d")))
+
+	key, err = deriveKey(sharedSecret(), "Pair-Setup-Encrypt-Salt", "Pair-Setup-Encrypt-Info")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(key).To(Equal(fromHex("52890146745a52e57b82b859a7a3679c7f3d40bb295b055a0c8fa8af92a3746d")))
+}
+
+// TestSeal_RFC8439 checks ChaCha20-Poly1305 against the AEAD test vector of RFC 8439, section 2.8.2.
+func TestSeal_RFC8439(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	key := fromHex("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f")
+	nonce := fromHex("070000004041424344454647")
+	aad := fromHex("50515253c0c1c2c3c4c5c6c7")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	expected := fromHex(`
+		d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d6
+		3dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b36
+		92ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc
+		3ff4def08e4b7a9de576d26586cec64b6116
+		1ae10b594f09e26a7e902ecbd0600691`)
+
+	sealed, err := seal(key, nonce, plaintext, aad)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(sealed).To(Equal(expected))
+	opened, err := open(key, nonce, sealed, aad)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(opened).To(Equal(plaintext))
+	_, err = open(key, nonce, sealed, nil)
+	g.Expect(err).To(HaveOccurred())
+}
+
+// bufferConn is a connection reading from in and writing to out.
+type bufferConn struct {
+	net.Conn
+	in  *bytes.Buffer
+	out *bytes.Buffer
+}
+
+func (c *bufferConn) Read(b []byte) (int, error) {
+	return c.in.Read(b)
+}
+
+func (c *bufferConn) Write(b []byte) (int, error) {
+	return c.out.Write(b)
+}
+
+// TestSecureConn_Frames checks the encrypted frames against frames computed with an independent implementation
+// of HKDF-SHA-512 and ChaCha20-Poly1305, itself checked against the RFC 8439 test vector.
+// Frames are the 2 bytes little endian length, used as additional data, then the encrypted payload and its tag.
+// The nonce is the frame counter, in little endian after 4 zero bytes.
+func TestSecureConn_Frames(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// The controller request, encrypted with the Control-Write-Encryption-Key
+	in := bytes.NewBuffer(fromHex(`
+		1d006ecb4b84f15aa0dd68624751c345dd91735ee85d6c76f499d7d3602cf197
+		6e3f8d9a11058445d1139c2fbea152`))
+	out := &bytes.Buffer{}
+	conn := newSecureConn(&bufferConn{in: in, out: out})
+	g.Expect(conn.enableEncryption(sharedSecret())).To(Succeed())
+
+	request, err := ioutil.ReadAll(conn)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(request)).To(Equal("GET /accessories HTTP/1.1\r\n\r\n"))
+
+	// The accessory responses, encrypted with the Control-Read-Encryption-Key, counting frames
+	_, err = conn.Write([]byte("HTTP/1.1 204 No Content\r\n\r\n"))
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = conn.Write([]byte("EVENT/1.0 200 OK\r\n\r\n"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out.Bytes()).To(Equal(fromHex(`
+		1b000c1e1407a8a5a0c3a290852aca8bd237957656ee663f04141bfddec191b1
+		02a429bbf5d24d456ac6fce5431400577e5c7cb2cb50c6a6477224f1bfd0e3ed
+		725f23053519aa6a9dc113b592578d9d375b8c`)))
+}
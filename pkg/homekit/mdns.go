@@ -0,0 +1,164 @@
+package homekit
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	hapService = "_hap._tcp.local."
+	mdnsTTL    = 120
+)
+
+var mdnsAddress = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsResponder advertises the HAP service using multicast DNS, so that controllers discover the bridge.
+type mdnsResponder struct {
+	instance string
+	host     string
+	port     int
+	txt      func() []string
+	conn     *net.UDPConn
+}
+
+// dnsLabel turns the bridge name into a single DNS label.
+func dnsLabel(name string) string {
+	return strings.Replace(name, ".", "-", -1)
+}
+
+func newMDNSResponder(name string, port int, txt func() []string) (*mdnsResponder, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsAddress)
+	if err != nil {
+		return nil, err
+	}
+	label := dnsLabel(name)
+	return &mdnsResponder{
+		instance: label + "." + hapService,
+		host:     strings.Replace(label, " ", "-", -1) + ".local.",
+		port:     port,
+		txt:      txt,
+		conn:     conn,
+	}, nil
+}
+
+// run answers queries about the HAP service until the responder is closed.
+func (m *mdnsResponder) run() {
+	m.announce()
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if m.matches(buf[:n]) {
+			m.send(mdnsTTL)
+		}
+	}
+}
+
+// matches reports whether the message is a query for one of the advertised records.
+func (m *mdnsResponder) matches(msg []byte) bool {
+	var p dnsmessage.Parser
+	header, err := p.Start(msg)
+	if err != nil || header.Response {
+		return false
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return false
+	}
+	for _, q := range questions {
+		switch strings.ToLower(q.Name.String()) {
+		case hapService, strings.ToLower(m.instance), strings.ToLower(m.host):
+			return true
+		}
+	}
+	return false
+}
+
+// announce advertises the service, which is needed when the TXT records change.
+func (m *mdnsResponder) announce() {
+	m.send(mdnsTTL)
+	time.Sleep(time.Second)
+	m.send(mdnsTTL)
+}
+
+// close sends goodbye records, then stops answering queries.
+func (m *mdnsResponder) close() {
+	m.send(0)
+	m.conn.Close()
+}
+
+func (m *mdnsResponder) send(ttl uint32) {
+	msg, err := m.response(ttl)
+	if err != nil {
+		log.WithError(err).Warn("Failed to build mDNS response")
+		return
+	}
+	if _, err := m.conn.WriteToUDP(msg, mdnsAddress); err != nil {
+		log.WithError(err).Debug("Failed to send mDNS response")
+	}
+}
+
+func (m *mdnsResponder) response(ttl uint32) ([]byte, error) {
+	service, err := dnsmessage.NewName(hapService)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := dnsmessage.NewName(m.instance)
+	if err != nil {
+		return nil, err
+	}
+	host, err := dnsmessage.NewName(m.host)
+	if err != nil {
+		return nil, err
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	// Records unique to this host have the cache flush bit set, in the class top bit
+	flushClass := dnsmessage.ClassINET | 1<<15
+	if err := b.PTRResource(dnsmessage.ResourceHeader{Name: service, Class: dnsmessage.ClassINET, TTL: ttl}, dnsmessage.PTRResource{PTR: instance}); err != nil {
+		return nil, err
+	}
+	if err := b.SRVResource(dnsmessage.ResourceHeader{Name: instance, Class: flushClass, TTL: ttl}, dnsmessage.SRVResource{Port: uint16(m.port), Target: host}); err != nil {
+		return nil, err
+	}
+	if err := b.TXTResource(dnsmessage.ResourceHeader{Name: instance, Class: flushClass, TTL: ttl}, dnsmessage.TXTResource{TXT: m.txt()}); err != nil {
+		return nil, err
+	}
+	for _, ip := range localIPv4() {
+		a := dnsmessage.AResource{}
+		copy(a.A[:], ip)
+		if err := b.AResource(dnsmessage.ResourceHeader{Name: host, Class: flushClass, TTL: ttl}, a); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// localIPv4 returns the non loopback IPv4 addresses of the host.
+func localIPv4() []net.IP {
+	out := []net.IP{}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return out
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		if ip := ipNet.IP.To4(); ip != nil {
+			out = append(out, ip)
+		}
+	}
+	return out
+}
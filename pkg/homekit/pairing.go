@@ -0,0 +1,369 @@
+package homekit
+
+import (
+	"crypto/rand"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+// Pairing methods
+const (
+	methodPairSetup     = 0x00
+	methodAddPairing    = 0x03
+	methodRemovePairing = 0x04
+	methodListPairings  = 0x05
+)
+
+// verifyState holds the pair verify ephemeral keys, between M2 and M4.
+type verifyState struct {
+	publicKey           [32]byte
+	controllerPublicKey [32]byte
+	sharedSecret        [32]byte
+	sessionKey          []byte
+}
+
+func (b *Bridge) isPaired() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state.paired()
+}
+
+func tlvFailure(state byte, code byte) tlv8 {
+	t := tlv8{}
+	t.addByte(tlvState, state)
+	t.addByte(tlvError, code)
+	return t
+}
+
+// handlePairSetup implements the pair setup procedure, exchanging long term keys using the setup code.
+func (s *session) handlePairSetup(body []byte) response {
+	req, err := decodeTLV8(body)
+	if err != nil {
+		return response{status: 400}
+	}
+	state, _ := req.getByte(tlvState)
+
+	switch state {
+	case 1:
+		return tlvResponse(s.pairSetupStart(req))
+	case 3:
+		return tlvResponse(s.pairSetupVerify(req))
+	case 5:
+		return tlvResponse(s.pairSetupExchange(req))
+	}
+	return tlvResponse(tlvFailure(state+1, tlvErrorUnknown))
+}
+
+// pairSetupStart handles M1, returning the SRP salt and public key.
+func (s *session) pairSetupStart(req tlv8) tlv8 {
+	if method, _ := req.getByte(tlvMethod); method != methodPairSetup {
+		return tlvFailure(2, tlvErrorUnknown)
+	}
+
+	b := s.bridge
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state.paired() {
+		return tlvFailure(2, tlvErrorUnavailable)
+	}
+	if b.state.FailedPairSetups >= maxPairSetupTries {
+		s.logger().Warn("HomeKit pair setup refused, too many failed tries. Remove the state file to reset pairing.")
+		return tlvFailure(2, tlvErrorMaxTries)
+	}
+	if b.pairSetup != nil && b.pairSetup != s {
+		return tlvFailure(2, tlvErrorBusy)
+	}
+
+	srp, err := newSRPServer(b.config.PIN)
+	if err != nil {
+		return tlvFailure(2, tlvErrorUnknown)
+	}
+	b.pairSetup = s
+	s.srp = srp
+
+	res := tlv8{}
+	res.addByte(tlvState, 2)
+	res.add(tlvSalt, srp.salt)
+	res.add(tlvPublicKey, srp.PublicKey())
+	return res
+}
+
+// pairSetupVerify handles M3, checking the controller proof of the setup code.
+func (s *session) pairSetupVerify(req tlv8) tlv8 {
+	publicKey, _ := req.get(tlvPublicKey)
+	proof, _ := req.get(tlvProof)
+	if s.srp == nil {
+		return tlvFailure(4, tlvErrorUnknown)
+	}
+	if err := s.srp.Verify(publicKey, proof); err != nil {
+		s.srp = nil
+		b := s.bridge
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if b.pairSetup == s {
+			b.pairSetup = nil
+		}
+		// Tries are counted across restarts, so that the setup code cannot be guessed
+		b.state.FailedPairSetups++
+		s.logger().WithError(err).WithField("failed-tries", b.state.FailedPairSetups).Warn("HomeKit pair setup failed, invalid setup code")
+		if err := b.saveState(); err != nil {
+			s.logger().WithError(err).Error("Failed to save HomeKit pair setup tries")
+		}
+		return tlvFailure(4, tlvErrorAuthentication)
+	}
+
+	res := tlv8{}
+	res.addByte(tlvState, 4)
+	res.add(tlvProof, s.srp.M2)
+	return res
+}
+
+// pairSetupExchange handles M5, storing the controller long term key and returning the bridge one.
+func (s *session) pairSetupExchange(req tlv8) tlv8 {
+	if s.srp == nil || s.srp.K == nil {
+		return tlvFailure(6, tlvErrorUnknown)
+	}
+	sessionKey, err := deriveKey(s.srp.K, "Pair-Setup-Encrypt-Salt", "Pair-Setup-Encrypt-Info")
+	if err != nil {
+		return tlvFailure(6, tlvErrorUnknown)
+	}
+	encrypted, _ := req.get(tlvEncryptedData)
+	decrypted, err := open(sessionKey, namedNonce("PS-Msg05"), encrypted, nil)
+	if err != nil {
+		return tlvFailure(6, tlvErrorAuthentication)
+	}
+	sub, err := decodeTLV8(decrypted)
+	if err != nil {
+		return tlvFailure(6, tlvErrorAuthentication)
+	}
+	controllerID, _ := sub.get(tlvIdentifier)
+	controllerLTPK, _ := sub.get(tlvPublicKey)
+	signature, _ := sub.get(tlvSignature)
+	if len(controllerLTPK) != ed25519.PublicKeySize {
+		return tlvFailure(6, tlvErrorAuthentication)
+	}
+
+	controllerX, err := deriveKey(s.srp.K, "Pair-Setup-Controller-Sign-Salt", "Pair-Setup-Controller-Sign-Info")
+	if err != nil {
+		return tlvFailure(6, tlvErrorUnknown)
+	}
+	controllerInfo := append(append(controllerX, controllerID...), controllerLTPK...)
+	if !ed25519.Verify(controllerLTPK, controllerInfo, signature) {
+		return tlvFailure(6, tlvErrorAuthentication)
+	}
+
+	b := s.bridge
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.state.addPairing(pairing{ID: string(controllerID), PublicKey: controllerLTPK, Admin: true}); err != nil {
+		return tlvFailure(6, tlvErrorAuthentication)
+	}
+	b.state.FailedPairSetups = 0
+	if err := b.pairingsChanged(); err != nil {
+		s.logger().WithError(err).Error("Failed to save HomeKit pairing")
+		return tlvFailure(6, tlvErrorUnknown)
+	}
+	b.pairSetup = nil
+
+	accessoryX, err := deriveKey(s.srp.K, "Pair-Setup-Accessory-Sign-Salt", "Pair-Setup-Accessory-Sign-Info")
+	if err != nil {
+		return tlvFailure(6, tlvErrorUnknown)
+	}
+	accessoryLTPK := b.state.publicKey()
+	accessoryInfo := append(append(accessoryX, b.state.DeviceID...), accessoryLTPK...)
+
+	resSub := tlv8{}
+	resSub.add(tlvIdentifier, []byte(b.state.DeviceID))
+	resSub.add(tlvPublicKey, accessoryLTPK)
+	resSub.add(tlvSignature, ed25519.Sign(b.state.PrivateKey, accessoryInfo))
+	resEncrypted, err := seal(sessionKey, namedNonce("PS-Msg06"), resSub.encode(), nil)
+	if err != nil {
+		return tlvFailure(6, tlvErrorUnknown)
+	}
+	s.srp = nil
+
+	s.logger().WithField("controller", string(controllerID)).Info("HomeKit controller paired")
+	res := tlv8{}
+	res.addByte(tlvState, 6)
+	res.add(tlvEncryptedData, resEncrypted)
+	return res
+}
+
+// handlePairVerify implements the pair verify procedure, establishing an encrypted session with a paired controller.
+// Encryption is enabled once the M4 response has been sent.
+func (s *session) handlePairVerify(body []byte) (response, func() error) {
+	req, err := decodeTLV8(body)
+	if err != nil {
+		return response{status: 400}, nil
+	}
+	state, _ := req.getByte(tlvState)
+
+	switch state {
+	case 1:
+		return tlvResponse(s.pairVerifyStart(req)), nil
+	case 3:
+		res, ok := s.pairVerifyFinish(req)
+		if !ok {
+			return tlvResponse(res), nil
+		}
+		secret := s.verify.sharedSecret
+		s.verify = nil
+		return tlvResponse(res), func() error {
+			return s.conn.enableEncryption(secret[:])
+		}
+	}
+	return tlvResponse(tlvFailure(state+1, tlvErrorUnknown)), nil
+}
+
+// pairVerifyStart handles M1, generating an ephemeral key pair and proving the bridge identity.
+func (s *session) pairVerifyStart(req tlv8) tlv8 {
+	controllerPublicKey, _ := req.get(tlvPublicKey)
+	if len(controllerPublicKey) != 32 {
+		return tlvFailure(2, tlvErrorUnknown)
+	}
+
+	v := &verifyState{}
+	copy(v.controllerPublicKey[:], controllerPublicKey)
+	var secretKey [32]byte
+	if _, err := rand.Read(secretKey[:]); err != nil {
+		return tlvFailure(2, tlvErrorUnknown)
+	}
+	curve25519.ScalarBaseMult(&v.publicKey, &secretKey)
+	curve25519.ScalarMult(&v.sharedSecret, &secretKey, &v.controllerPublicKey)
+
+	sessionKey, err := deriveKey(v.sharedSecret[:], "Pair-Verify-Encrypt-Salt", "Pair-Verify-Encrypt-Info")
+	if err != nil {
+		return tlvFailure(2, tlvErrorUnknown)
+	}
+	v.sessionKey = sessionKey
+
+	b := s.bridge
+	b.mutex.Lock()
+	deviceID := b.state.DeviceID
+	privateKey := b.state.PrivateKey
+	b.mutex.Unlock()
+
+	accessoryInfo := append(append(v.publicKey[:], deviceID...), v.controllerPublicKey[:]...)
+	sub := tlv8{}
+	sub.add(tlvIdentifier, []byte(deviceID))
+	sub.add(tlvSignature, ed25519.Sign(privateKey, accessoryInfo))
+	encrypted, err := seal(sessionKey, namedNonce("PV-Msg02"), sub.encode(), nil)
+	if err != nil {
+		return tlvFailure(2, tlvErrorUnknown)
+	}
+	s.verify = v
+
+	res := tlv8{}
+	res.addByte(tlvState, 2)
+	res.add(tlvPublicKey, v.publicKey[:])
+	res.add(tlvEncryptedData, encrypted)
+	return res
+}
+
+// pairVerifyFinish handles M3, checking the controller is paired and owns its long term key.
+func (s *session) pairVerifyFinish(req tlv8) (tlv8, bool) {
+	v := s.verify
+	if v == nil {
+		return tlvFailure(4, tlvErrorUnknown), false
+	}
+	encrypted, _ := req.get(tlvEncryptedData)
+	decrypted, err := open(v.sessionKey, namedNonce("PV-Msg03"), encrypted, nil)
+	if err != nil {
+		return tlvFailure(4, tlvErrorAuthentication), false
+	}
+	sub, err := decodeTLV8(decrypted)
+	if err != nil {
+		return tlvFailure(4, tlvErrorAuthentication), false
+	}
+	controllerID, _ := sub.get(tlvIdentifier)
+	signature, _ := sub.get(tlvSignature)
+
+	b := s.bridge
+	b.mutex.Lock()
+	p, found := b.state.findPairing(string(controllerID))
+	b.mutex.Unlock()
+	if !found {
+		s.logger().WithField("controller", string(controllerID)).Warn("HomeKit pair verify failed, unknown controller")
+		return tlvFailure(4, tlvErrorAuthentication), false
+	}
+	controllerInfo := append(append(v.controllerPublicKey[:], controllerID...), v.publicKey[:]...)
+	if !ed25519.Verify(p.PublicKey, controllerInfo, signature) {
+		return tlvFailure(4, tlvErrorAuthentication), false
+	}
+
+	s.controllerID = p.ID
+	res := tlv8{}
+	res.addByte(tlvState, 4)
+	return res, true
+}
+
+// handlePairings lets admin controllers add, remove and list pairings.
+func (s *session) handlePairings(body []byte) (response, func() error) {
+	req, err := decodeTLV8(body)
+	if err != nil {
+		return response{status: 400}, nil
+	}
+	method, _ := req.getByte(tlvMethod)
+
+	b := s.bridge
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	current, found := b.state.findPairing(s.controllerID)
+	if !found || !current.Admin {
+		return tlvResponse(tlvFailure(2, tlvErrorAuthentication)), nil
+	}
+
+	res := tlv8{}
+	res.addByte(tlvState, 2)
+	switch method {
+	case methodAddPairing:
+		id, _ := req.get(tlvIdentifier)
+		publicKey, _ := req.get(tlvPublicKey)
+		permissions, _ := req.getByte(tlvPermissions)
+		if err := b.state.addPairing(pairing{ID: string(id), PublicKey: publicKey, Admin: permissions == 1}); err != nil {
+			return tlvResponse(tlvFailure(2, tlvErrorUnknown)), nil
+		}
+	case methodRemovePairing:
+		id, _ := req.get(tlvIdentifier)
+		b.state.removePairing(string(id))
+		// Close the connections of controllers that are not paired anymore, once the response is sent
+		closed := []*session{}
+		for other := range b.sessions {
+			if _, found := b.state.findPairing(other.controllerID); other.controllerID != "" && !found {
+				closed = append(closed, other)
+			}
+		}
+		if err := b.pairingsChanged(); err != nil {
+			return tlvResponse(tlvFailure(2, tlvErrorUnknown)), nil
+		}
+		return tlvResponse(res), func() error {
+			for _, other := range closed {
+				other.conn.Close()
+			}
+			return nil
+		}
+	case methodListPairings:
+		for idx, p := range b.state.Pairings {
+			if idx > 0 {
+				res.add(tlvSeparator, nil)
+			}
+			permissions := byte(0)
+			if p.Admin {
+				permissions = 1
+			}
+			res.add(tlvIdentifier, []byte(p.ID))
+			res.add(tlvPublicKey, p.PublicKey)
+			res.addByte(tlvPermissions, permissions)
+		}
+		return tlvResponse(res), nil
+	default:
+		return tlvResponse(tlvFailure(2, tlvErrorUnknown)), nil
+	}
+
+	if err := b.pairingsChanged(); err != nil {
+		return tlvResponse(tlvFailure(2, tlvErrorUnknown)), nil
+	}
+	return tlvResponse(res), nil
+}
@@ -0,0 +1,332 @@
+package homekit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	contentTypeTLV8 = "application/pairing+tlv8"
+	contentTypeJSON = "application/hap+json"
+
+	// statusConnectionAuthorizationRequired is returned for requests made before pair verify
+	statusConnectionAuthorizationRequired = 470
+
+	// switchResetDelay is the time after which a switch turns itself off
+	switchResetDelay = time.Second
+
+	// unverifiedIdleTimeout is the time after which idle connections are closed, until pair verify succeeds.
+	// It releases pair setup from controllers which stopped in the middle of it.
+	unverifiedIdleTimeout = time.Minute
+)
+
+// session is a controller connection.
+type session struct {
+	bridge *Bridge
+	conn   *secureConn
+
+	// controllerID is the pairing identifier of the controller, once verified
+	controllerID string
+	srp          *srpServer
+	verify       *verifyState
+
+	mutex         sync.Mutex
+	subscriptions map[string]bool
+}
+
+func newSession(b *Bridge, conn net.Conn) *session {
+	return &session{
+		bridge:        b,
+		conn:          newSecureConn(conn),
+		subscriptions: make(map[string]bool),
+	}
+}
+
+type response struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+func tlvResponse(t tlv8) response {
+	return response{status: http.StatusOK, contentType: contentTypeTLV8, body: t.encode()}
+}
+
+func jsonResponse(status int, v interface{}) response {
+	body, _ := json.Marshal(v)
+	return response{status: status, contentType: contentTypeJSON, body: body}
+}
+
+func (s *session) logger() *log.Entry {
+	return log.WithFields(log.Fields{
+		"remote-address": s.conn.RemoteAddr().String(),
+		"controller":     s.controllerID,
+	})
+}
+
+func (s *session) serve() {
+	defer s.conn.Close()
+	reader := bufio.NewReader(s.conn)
+	for {
+		// Verified controllers keep their connection open to receive events
+		deadline := time.Time{}
+		if !s.conn.isEncrypted() {
+			deadline = time.Now().Add(s.bridge.idleTimeout)
+		}
+		if err := s.conn.SetReadDeadline(deadline); err != nil {
+			return
+		}
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return
+		}
+
+		res, after := s.handle(req, body)
+		if err := s.write("HTTP/1.1", res); err != nil {
+			return
+		}
+		if after != nil {
+			if err := after(); err != nil {
+				s.logger().WithError(err).Error("HomeKit session failure")
+				return
+			}
+		}
+	}
+}
+
+// write sends a response or an event, depending on the protocol.
+func (s *session) write(protocol string, res response) error {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %d %s\r\n", protocol, res.status, http.StatusText(res.status))
+	if len(res.body) > 0 {
+		fmt.Fprintf(buf, "Content-Type: %s\r\n", res.contentType)
+	}
+	fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n", len(res.body))
+	buf.Write(res.body)
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+// handle routes the request. The returned function, when not nil, is run once the response has been sent.
+func (s *session) handle(req *http.Request, body []byte) (response, func() error) {
+	path := req.URL.Path
+	switch {
+	case req.Method == http.MethodPost && path == "/pair-setup":
+		return s.handlePairSetup(body), nil
+	case req.Method == http.MethodPost && path == "/pair-verify":
+		return s.handlePairVerify(body)
+	case req.Method == http.MethodPost && path == "/identify":
+		if s.bridge.isPaired() {
+			return jsonResponse(http.StatusBadRequest, map[string]int{"status": statusInsufficientPrivileges}), nil
+		}
+		return response{status: http.StatusNoContent}, nil
+	}
+
+	if !s.conn.isEncrypted() {
+		return jsonResponse(statusConnectionAuthorizationRequired, map[string]int{"status": statusInsufficientPrivileges}), nil
+	}
+
+	switch {
+	case req.Method == http.MethodGet && path == "/accessories":
+		s.bridge.mutex.Lock()
+		defer s.bridge.mutex.Unlock()
+		return jsonResponse(http.StatusOK, s.bridge.db), nil
+	case req.Method == http.MethodGet && path == "/characteristics":
+		return s.handleGetCharacteristics(req.URL.Query().Get("id")), nil
+	case req.Method == http.MethodPut && path == "/characteristics":
+		return s.handlePutCharacteristics(body), nil
+	case req.Method == http.MethodPost && path == "/pairings":
+		return s.handlePairings(body)
+	}
+	return response{status: http.StatusNotFound}, nil
+}
+
+type characteristicStatus struct {
+	AID    int         `json:"aid"`
+	IID    int         `json:"iid"`
+	Value  interface{} `json:"value,omitempty"`
+	Status *int        `json:"status,omitempty"`
+}
+
+type characteristicsBody struct {
+	Characteristics []characteristicStatus `json:"characteristics"`
+}
+
+func statusPtr(status int) *int {
+	return &status
+}
+
+func (s *session) handleGetCharacteristics(ids string) response {
+	out := characteristicsBody{}
+	failed := false
+
+	s.bridge.mutex.Lock()
+	defer s.bridge.mutex.Unlock()
+	for _, id := range strings.Split(ids, ",") {
+		parts := strings.SplitN(id, ".", 2)
+		if len(parts) != 2 {
+			return jsonResponse(http.StatusBadRequest, map[string]int{"status": statusInvalidValue})
+		}
+		aid, _ := strconv.Atoi(parts[0])
+		iid, _ := strconv.Atoi(parts[1])
+		res := characteristicStatus{AID: aid, IID: iid}
+
+		_, c := s.bridge.db.find(aid, iid)
+		switch {
+		case c == nil:
+			res.Status = statusPtr(statusResourceNotFound)
+			failed = true
+		case !c.hasPerm("pr"):
+			res.Status = statusPtr(statusWriteOnly)
+			failed = true
+		default:
+			res.Value = c.Value
+		}
+		out.Characteristics = append(out.Characteristics, res)
+	}
+
+	if failed {
+		for idx := range out.Characteristics {
+			if out.Characteristics[idx].Status == nil {
+				out.Characteristics[idx].Status = statusPtr(statusSuccess)
+			}
+		}
+		return jsonResponse(http.StatusMultiStatus, out)
+	}
+	return jsonResponse(http.StatusOK, out)
+}
+
+// characteristicWrite is a write request. Value and Events are pointers, as both are optional.
+type characteristicWrite struct {
+	AID    int          `json:"aid"`
+	IID    int          `json:"iid"`
+	Value  *interface{} `json:"value"`
+	Events *bool        `json:"ev"`
+}
+
+func truthy(v interface{}) bool {
+	switch value := v.(type) {
+	case bool:
+		return value
+	case float64:
+		return value != 0
+	}
+	return false
+}
+
+func (s *session) handlePutCharacteristics(body []byte) response {
+	req := struct {
+		Characteristics []characteristicWrite `json:"characteristics"`
+	}{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return jsonResponse(http.StatusBadRequest, map[string]int{"status": statusInvalidValue})
+	}
+
+	out := characteristicsBody{}
+	failed := false
+	for _, w := range req.Characteristics {
+		status := s.writeCharacteristic(w)
+		if status != statusSuccess {
+			failed = true
+		}
+		out.Characteristics = append(out.Characteristics, characteristicStatus{AID: w.AID, IID: w.IID, Status: statusPtr(status)})
+	}
+	if failed {
+		return jsonResponse(http.StatusMultiStatus, out)
+	}
+	return response{status: http.StatusNoContent}
+}
+
+func (s *session) writeCharacteristic(w characteristicWrite) int {
+	s.bridge.mutex.Lock()
+	acc, c := s.bridge.db.find(w.AID, w.IID)
+	s.bridge.mutex.Unlock()
+	if c == nil {
+		return statusResourceNotFound
+	}
+
+	if w.Events != nil {
+		if !c.hasPerm("ev") {
+			return statusNotificationDenied
+		}
+		s.mutex.Lock()
+		s.subscriptions[charID(w.AID, w.IID)] = *w.Events
+		s.mutex.Unlock()
+	}
+	if w.Value == nil {
+		return statusSuccess
+	}
+	if !c.hasPerm("pw") {
+		return statusReadOnly
+	}
+	if c.Type != charOn || !truthy(*w.Value) {
+		// Identify and switch off are no-ops
+		return statusSuccess
+	}
+
+	logger := s.logger().WithFields(log.Fields{
+		"remote":  acc.sw.Remote,
+		"command": acc.sw.Command,
+	})
+	if err := s.bridge.send(acc.sw.Remote, acc.sw.Command); err != nil {
+		logger.WithError(err).Error("Failed to send command requested over HomeKit")
+		return statusCommunicationError
+	}
+	logger.Info("Command sent on behalf of HomeKit controller")
+
+	s.bridge.setValue(w.AID, w.IID, true, s)
+	time.AfterFunc(switchResetDelay, func() {
+		s.bridge.setValue(w.AID, w.IID, false, nil)
+	})
+	return statusSuccess
+}
+
+// setValue updates the characteristic value, notifying the subscribed sessions except the origin one.
+func (b *Bridge) setValue(aid int, iid int, value interface{}, origin *session) {
+	b.mutex.Lock()
+	_, c := b.db.find(aid, iid)
+	if c == nil {
+		// The switch was removed meanwhile
+		b.mutex.Unlock()
+		return
+	}
+	c.Value = value
+	sessions := []*session{}
+	for s := range b.sessions {
+		if s != origin && s.subscribed(charID(aid, iid)) {
+			sessions = append(sessions, s)
+		}
+	}
+	b.mutex.Unlock()
+
+	event := jsonResponse(http.StatusOK, characteristicsBody{
+		Characteristics: []characteristicStatus{{AID: aid, IID: iid, Value: value}},
+	})
+	for _, s := range sessions {
+		if err := s.write("EVENT/1.0", event); err != nil {
+			s.logger().WithError(err).Warn("Failed to send HomeKit event")
+		}
+	}
+}
+
+func (s *session) subscribed(id string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.subscriptions[id]
+}
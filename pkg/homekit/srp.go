@@ -0,0 +1,175 @@
+package homekit
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"fmt"
+	"hash"
+	"math/big"
+)
+
+// srpGroup holds the SRP-6a parameters: group prime and generator, hash function and username.
+type srpGroup struct {
+	N        *big.Int
+	g        *big.Int
+	hash     func() hash.Hash
+	username string
+}
+
+// srpHomeKit is the group used by HomeKit pair setup: the 3072 bits prime from RFC 5054 with generator 5,
+// SHA-512 and the fixed Pair-Setup username.
+var srpHomeKit = &srpGroup{
+	N:        srpN3072,
+	g:        big.NewInt(5),
+	hash:     sha512.New,
+	username: "Pair-Setup",
+}
+
+var srpN3072, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+		"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05"+
+		"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB"+
+		"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718"+
+		"3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33"+
+		"A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7"+
+		"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864"+
+		"D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2"+
+		"08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF", 16)
+
+// pad left pads i with zeros to the length of the group prime.
+func (grp *srpGroup) pad(i *big.Int) []byte {
+	b := i.Bytes()
+	length := len(grp.N.Bytes())
+	if len(b) >= length {
+		return b
+	}
+	out := make([]byte, length)
+	copy(out[length-len(b):], b)
+	return out
+}
+
+func (grp *srpGroup) H(parts ...[]byte) []byte {
+	h := grp.hash()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func (grp *srpGroup) hashInt(parts ...[]byte) *big.Int {
+	return new(big.Int).SetBytes(grp.H(parts...))
+}
+
+// k is the multiplier parameter, H(N | PAD(g)).
+func (grp *srpGroup) k() *big.Int {
+	return grp.hashInt(grp.N.Bytes(), grp.pad(grp.g))
+}
+
+// x is the private key derived from the salt and password, H(s | H(I | ":" | P)).
+func (grp *srpGroup) x(salt []byte, password string) *big.Int {
+	return grp.hashInt(salt, grp.H([]byte(grp.username+":"+password)))
+}
+
+// u is the scrambling parameter, H(PAD(A) | PAD(B)).
+func (grp *srpGroup) u(A *big.Int, B *big.Int) *big.Int {
+	return grp.hashInt(grp.pad(A), grp.pad(B))
+}
+
+// clientProof is M1 = H(H(N) xor H(g), H(I), s, A, B, K).
+func (grp *srpGroup) clientProof(salt []byte, A *big.Int, B *big.Int, K []byte) []byte {
+	hN := grp.H(grp.N.Bytes())
+	hG := grp.H(grp.g.Bytes())
+	for idx := range hN {
+		hN[idx] ^= hG[idx]
+	}
+	return grp.H(hN, grp.H([]byte(grp.username)), salt, A.Bytes(), B.Bytes(), K)
+}
+
+// srpServer implements the server side of SRP-6a.
+type srpServer struct {
+	grp  *srpGroup
+	salt []byte
+	v    *big.Int
+	b    *big.Int
+	B    *big.Int
+	// K is the session key, available once the client proof has been verified
+	K []byte
+	// M2 is the server proof, available once the client proof has been verified
+	M2 []byte
+}
+
+func newSRPServer(password string) (*srpServer, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return newSRPServerWithSecrets(srpHomeKit, password, salt, new(big.Int).SetBytes(b)), nil
+}
+
+func newSRPServerWithSecrets(grp *srpGroup, password string, salt []byte, b *big.Int) *srpServer {
+	v := new(big.Int).Exp(grp.g, grp.x(salt, password), grp.N)
+
+	// B = k*v + g^b
+	B := new(big.Int).Mul(grp.k(), v)
+	B.Add(B, new(big.Int).Exp(grp.g, b, grp.N))
+	B.Mod(B, grp.N)
+
+	return &srpServer{
+		grp:  grp,
+		salt: salt,
+		v:    v,
+		b:    b,
+		B:    B,
+	}
+}
+
+// PublicKey returns the server public key B.
+func (s *srpServer) PublicKey() []byte {
+	return s.B.Bytes()
+}
+
+// Verify checks the client proof M1 against the client public key A, computing the session key and server proof.
+func (s *srpServer) Verify(clientPublicKey []byte, clientProof []byte) error {
+	K, err := s.sessionKey(clientPublicKey)
+	if err != nil {
+		return err
+	}
+	A := new(big.Int).SetBytes(clientPublicKey)
+	M1 := s.grp.clientProof(s.salt, A, s.B, K)
+	if subtle.ConstantTimeCompare(M1, clientProof) != 1 {
+		return fmt.Errorf("invalid client proof")
+	}
+
+	s.K = K
+	s.M2 = s.grp.H(A.Bytes(), M1, K)
+	return nil
+}
+
+// premasterSecret returns S = (A * v^u) ^ b.
+func (s *srpServer) premasterSecret(clientPublicKey []byte) (*big.Int, error) {
+	A := new(big.Int).SetBytes(clientPublicKey)
+	if new(big.Int).Mod(A, s.grp.N).Sign() == 0 {
+		return nil, fmt.Errorf("invalid client public key")
+	}
+	S := new(big.Int).Exp(s.v, s.grp.u(A, s.B), s.grp.N)
+	S.Mul(S, A)
+	S.Exp(S, s.b, s.grp.N)
+	return S, nil
+}
+
+// sessionKey returns K = H(S).
+func (s *srpServer) sessionKey(clientPublicKey []byte) ([]byte, error) {
+	S, err := s.premasterSecret(clientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return s.grp.H(S.Bytes()), nil
+}
@@ -0,0 +1,136 @@
+package homekit
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+// pairing is a controller (iOS device) paired with the bridge.
+type pairing struct {
+	ID        string `json:"id"`
+	PublicKey []byte `json:"publicKey"`
+	Admin     bool   `json:"admin"`
+}
+
+// state is the bridge identity and pairings, persisted across restarts.
+type state struct {
+	// DeviceID is the bridge pairing identifier, formatted like a MAC address.
+	DeviceID   string             `json:"deviceId"`
+	PrivateKey ed25519.PrivateKey `json:"privateKey"`
+	// ConfigNumber is incremented every time the accessories change, so that controllers refresh them.
+	ConfigNumber int       `json:"configNumber"`
+	ConfigHash   string    `json:"configHash"`
+	Pairings     []pairing `json:"pairings"`
+	// AIDs holds the accessory identifier of every switch, which must be stable across restarts.
+	AIDs map[string]int `json:"aids"`
+	// FailedPairSetups counts the pair setups which failed with a wrong setup code.
+	// Pair setup is refused once it reaches maxPairSetupTries, until the state is reset.
+	FailedPairSetups int `json:"failedPairSetups,omitempty"`
+}
+
+// maxPairSetupTries is the number of failed pair setups after which pair setup is refused.
+const maxPairSetupTries = 100
+
+// loadState loads the state from file, generating a new identity when the file does not exist.
+func loadState(filename string) (*state, error) {
+	s := &state{}
+	err := utils.LoadFromFile(s, filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if s.DeviceID == "" {
+		id := make([]byte, 6)
+		if _, err := rand.Read(id); err != nil {
+			return nil, err
+		}
+		s.DeviceID = net.HardwareAddr(id).String()
+	}
+	if len(s.PrivateKey) != ed25519.PrivateKeySize {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		s.PrivateKey = key
+	}
+	if s.ConfigNumber == 0 {
+		s.ConfigNumber = 1
+	}
+	if s.AIDs == nil {
+		s.AIDs = make(map[string]int)
+	}
+	return s, nil
+}
+
+func (s *state) publicKey() ed25519.PublicKey {
+	return s.PrivateKey.Public().(ed25519.PublicKey)
+}
+
+func (s *state) findPairing(id string) (pairing, bool) {
+	for _, p := range s.Pairings {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return pairing{}, false
+}
+
+// addPairing adds or updates a pairing. Updating a pairing with a different public key is an error.
+func (s *state) addPairing(p pairing) error {
+	for idx, existing := range s.Pairings {
+		if existing.ID != p.ID {
+			continue
+		}
+		if string(existing.PublicKey) != string(p.PublicKey) {
+			return fmt.Errorf("controller %s is already paired with another key", p.ID)
+		}
+		s.Pairings[idx].Admin = p.Admin
+		return nil
+	}
+	s.Pairings = append(s.Pairings, p)
+	return nil
+}
+
+// removePairing removes the pairing. When no admin controller is left, every pairing is removed.
+func (s *state) removePairing(id string) {
+	out := []pairing{}
+	hasAdmin := false
+	for _, p := range s.Pairings {
+		if p.ID == id {
+			continue
+		}
+		hasAdmin = hasAdmin || p.Admin
+		out = append(out, p)
+	}
+	if !hasAdmin {
+		out = nil
+	}
+	s.Pairings = out
+}
+
+// assignAIDs allocates an accessory identifier to every switch missing one.
+// Identifiers of removed switches are not reused.
+func (s *state) assignAIDs(switches []Switch) {
+	next := bridgeAID + 1
+	for _, aid := range s.AIDs {
+		if aid >= next {
+			next = aid + 1
+		}
+	}
+	for _, sw := range switches {
+		if _, found := s.AIDs[sw.key()]; !found {
+			s.AIDs[sw.key()] = next
+			next++
+		}
+	}
+}
+
+func (s *state) paired() bool {
+	return len(s.Pairings) > 0
+}
@@ -0,0 +1,110 @@
+package homekit
+
+import (
+	"fmt"
+)
+
+// TLV8 item types used by the pairing procedures.
+const (
+	tlvMethod        = 0x00
+	tlvIdentifier    = 0x01
+	tlvSalt          = 0x02
+	tlvPublicKey     = 0x03
+	tlvProof         = 0x04
+	tlvEncryptedData = 0x05
+	tlvState         = 0x06
+	tlvError         = 0x07
+	tlvSignature     = 0x0a
+	tlvPermissions   = 0x0b
+	tlvSeparator     = 0xff
+)
+
+// TLV8 error codes.
+const (
+	tlvErrorUnknown        = 0x01
+	tlvErrorAuthentication = 0x02
+	tlvErrorMaxPeers       = 0x04
+	tlvErrorMaxTries       = 0x05
+	tlvErrorUnavailable    = 0x06
+	tlvErrorBusy           = 0x07
+)
+
+// tlvItem is a single type/value pair.
+type tlvItem struct {
+	typ   byte
+	value []byte
+}
+
+// tlv8 is an ordered list of items. Values longer than 255 bytes are fragmented on encoding.
+type tlv8 []tlvItem
+
+func (t *tlv8) add(typ byte, value []byte) {
+	*t = append(*t, tlvItem{typ: typ, value: value})
+}
+
+func (t *tlv8) addByte(typ byte, value byte) {
+	t.add(typ, []byte{value})
+}
+
+// get returns the value of the first item with the given type.
+func (t tlv8) get(typ byte) ([]byte, bool) {
+	for _, item := range t {
+		if item.typ == typ {
+			return item.value, true
+		}
+	}
+	return nil, false
+}
+
+func (t tlv8) getByte(typ byte) (byte, bool) {
+	v, found := t.get(typ)
+	if !found || len(v) != 1 {
+		return 0, false
+	}
+	return v[0], true
+}
+
+func (t tlv8) encode() []byte {
+	out := []byte{}
+	for _, item := range t {
+		value := item.value
+		if len(value) == 0 {
+			out = append(out, item.typ, 0)
+			continue
+		}
+		for len(value) > 0 {
+			n := len(value)
+			if n > 255 {
+				n = 255
+			}
+			out = append(out, item.typ, byte(n))
+			out = append(out, value[:n]...)
+			value = value[n:]
+		}
+	}
+	return out
+}
+
+func decodeTLV8(data []byte) (tlv8, error) {
+	out := tlv8{}
+	// lastFull is true when the previous item was a 255 bytes fragment, to be continued
+	lastFull := false
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, fmt.Errorf("truncated TLV8 item")
+		}
+		typ, n := data[0], int(data[1])
+		if len(data) < 2+n {
+			return nil, fmt.Errorf("truncated TLV8 item value")
+		}
+		value := data[2 : 2+n]
+		if lastFull && out[len(out)-1].typ == typ {
+			out[len(out)-1].value = append(out[len(out)-1].value, value...)
+		} else {
+			out = append(out, tlvItem{typ: typ, value: append([]byte{}, value...)})
+		}
+		lastFull = n == 255
+		data = data[2+n:]
+	}
+	return out, nil
+}
@@ -0,0 +1,43 @@
+package homekit
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestTLV8(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	long := bytes.Repeat([]byte{0xab}, 300)
+	in := tlv8{}
+	in.addByte(tlvState, 2)
+	in.add(tlvPublicKey, long)
+	in.add(tlvSeparator, nil)
+	in.add(tlvIdentifier, []byte("controller"))
+
+	raw := in.encode()
+	// Values longer than 255 bytes are fragmented
+	g.Expect(raw[:3]).To(Equal([]byte{tlvState, 1, 2}))
+	g.Expect(raw[3:5]).To(Equal([]byte{tlvPublicKey, 255}))
+	g.Expect(raw[260:262]).To(Equal([]byte{tlvPublicKey, 45}))
+	g.Expect(raw[307:309]).To(Equal([]byte{tlvSeparator, 0}))
+
+	out, err := decodeTLV8(raw)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(out).To(HaveLen(4))
+	state, found := out.getByte(tlvState)
+	g.Expect(found).To(BeTrue())
+	g.Expect(state).To(Equal(byte(2)))
+	value, _ := out.get(tlvPublicKey)
+	g.Expect(value).To(Equal(long))
+	value, _ = out.get(tlvIdentifier)
+	g.Expect(string(value)).To(Equal("controller"))
+
+	_, found = out.get(tlvProof)
+	g.Expect(found).To(BeFalse())
+
+	_, err = decodeTLV8([]byte{tlvState, 2, 1})
+	g.Expect(err).To(HaveOccurred())
+}
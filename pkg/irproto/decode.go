@@ -0,0 +1,80 @@
+package irproto
+
+import (
+	"fmt"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// tolerance is the relative error accepted on durations when decoding, as captured codes are not exact.
+const tolerance = 0.25
+
+// ParseBroadlink converts a code in the format used by Broadlink devices to pulses, reverting Broadlink.
+func ParseBroadlink(code remotes.IRCommand) (Pulses, error) {
+	p := Pulses{}
+	for idx := 0; idx < len(code); idx++ {
+		ticks := int(code[idx])
+		if ticks == 0 {
+			// Long durations are escaped with a zero byte, followed by the duration on two bytes
+			if idx+2 >= len(code) {
+				return nil, fmt.Errorf("truncated duration at offset %d", idx)
+			}
+			ticks = int(code[idx+1])<<8 | int(code[idx+2])
+			idx += 2
+		}
+		us := (ticks*broadlinkTickNum + broadlinkTickDen/2) / broadlinkTickDen
+		if len(p)%2 == 0 {
+			p.Mark(us)
+		} else {
+			p.Space(us)
+		}
+	}
+	return p, nil
+}
+
+func matches(us int, expected int) bool {
+	diff := us - expected
+	if diff < 0 {
+		diff = -diff
+	}
+	return float64(diff) <= float64(expected)*tolerance
+}
+
+// decodeBytes returns the bytes of pulses encoded with the timing, least significant bit first, false when the pulses do not match.
+func (p Pulses) decodeBytes(t Timing, n int) ([]byte, bool) {
+	if len(p) < 2+n*16+1 || !matches(p[0], t.HeaderMark) || !matches(p[1], t.HeaderSpace) {
+		return nil, false
+	}
+	out := make([]byte, n)
+	for i := 0; i < n*8; i++ {
+		mark, space := p[2+2*i], p[3+2*i]
+		if !matches(mark, t.BitMark) {
+			return nil, false
+		}
+		switch {
+		case matches(space, t.OneSpace):
+			out[i/8] |= 1 << uint(i%8)
+		case !matches(space, t.ZeroSpace):
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// DecodeNEC returns the address and command of NEC pulses, false when the pulses are not a NEC code.
+func DecodeNEC(p Pulses) (byte, byte, bool) {
+	b, ok := p.decodeBytes(necTiming, 4)
+	if !ok || b[1] != ^b[0] || b[3] != ^b[2] {
+		return 0, 0, false
+	}
+	return b[0], b[2], true
+}
+
+// DecodeSamsung returns the address and command of Samsung pulses, false when the pulses are not a Samsung code.
+func DecodeSamsung(p Pulses) (byte, byte, bool) {
+	b, ok := p.decodeBytes(samsungTiming, 4)
+	if !ok || b[1] != b[0] || b[3] != ^b[2] {
+		return 0, 0, false
+	}
+	return b[0], b[2], true
+}
@@ -0,0 +1,66 @@
+package irproto
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+func TestParseBroadlink(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p, err := ParseBroadlink(remotes.IRCommand{0x00, 0x01, 0x28, 0x94, 0x12, 0x00, 0x0d, 0x05})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(p).To(HaveLen(4))
+	// Durations are rounded to ticks
+	g.Expect(p[0]).To(BeNumerically("~", 9000, 31))
+	g.Expect(p[1]).To(BeNumerically("~", 4500, 31))
+
+	_, err = ParseBroadlink(remotes.IRCommand{0x94, 0x00, 0x01})
+	g.Expect(err).To(MatchError(ContainSubstring("truncated")))
+}
+
+func TestDecode(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for address := 0; address <= 0xff; address += 0x33 {
+		for command := 0; command <= 0xff; command += 0x11 {
+			p, err := ParseBroadlink(NEC(byte(address), byte(command)).Broadlink())
+			g.Expect(err).NotTo(HaveOccurred())
+			a, c, ok := DecodeNEC(p)
+			g.Expect(ok).To(BeTrue())
+			g.Expect([]byte{a, c}).To(Equal([]byte{byte(address), byte(command)}))
+			_, _, ok = DecodeSamsung(p)
+			g.Expect(ok).To(BeFalse())
+
+			p, err = ParseBroadlink(Samsung(byte(address), byte(command)).Broadlink())
+			g.Expect(err).NotTo(HaveOccurred())
+			a, c, ok = DecodeSamsung(p)
+			g.Expect(ok).To(BeTrue())
+			g.Expect([]byte{a, c}).To(Equal([]byte{byte(address), byte(command)}))
+			_, _, ok = DecodeNEC(p)
+			g.Expect(ok).To(BeFalse())
+		}
+	}
+
+	// Captured durations are not exact
+	p := NEC(0x04, 0x08)
+	for idx := range p {
+		p[idx] = p[idx] * 110 / 100
+	}
+	a, c, ok := DecodeNEC(p)
+	g.Expect(ok).To(BeTrue())
+	g.Expect([]byte{a, c}).To(Equal([]byte{0x04, 0x08}))
+
+	// Complements are checked
+	p = Pulses{}
+	p.Header(necTiming)
+	p.Bytes([]byte{0x04, 0x04, 0x08, 0xf7}, necTiming)
+	p.Footer(necTiming)
+	_, _, ok = DecodeNEC(p)
+	g.Expect(ok).To(BeFalse())
+	_, _, ok = DecodeNEC(Pulses{9000, 4500, 560})
+	g.Expect(ok).To(BeFalse())
+}
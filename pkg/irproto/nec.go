@@ -0,0 +1,39 @@
+package irproto
+
+// necTiming is shared by NEC and Samsung codes, which only differ by their header and address.
+var necTiming = Timing{
+	HeaderMark:  9000,
+	HeaderSpace: 4500,
+	BitMark:     560,
+	OneSpace:    1690,
+	ZeroSpace:   560,
+	Gap:         40000,
+}
+
+var samsungTiming = Timing{
+	HeaderMark:  4500,
+	HeaderSpace: 4500,
+	BitMark:     560,
+	OneSpace:    1690,
+	ZeroSpace:   560,
+	Gap:         47000,
+}
+
+// NEC returns the pulses of a NEC code, used by LG, Toshiba, Yamaha and many others:
+// the 8 bits address and command, each followed by its complement.
+func NEC(address byte, command byte) Pulses {
+	p := Pulses{}
+	p.Header(necTiming)
+	p.Bytes([]byte{address, ^address, command, ^command}, necTiming)
+	p.Footer(necTiming)
+	return p
+}
+
+// Samsung returns the pulses of a Samsung code (Samsung32): the 8 bits address, sent twice, then the command followed by its complement.
+func Samsung(address byte, command byte) Pulses {
+	p := Pulses{}
+	p.Header(samsungTiming)
+	p.Bytes([]byte{address, address, command, ^command}, samsungTiming)
+	p.Footer(samsungTiming)
+	return p
+}
@@ -0,0 +1,34 @@
+package irproto
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNEC(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := NEC(0x04, 0x08)
+	// Header, 32 bits, footer
+	g.Expect(p).To(HaveLen(2 + 32*2 + 2))
+	g.Expect(p[:2]).To(Equal(Pulses{9000, 4500}))
+	// Address 0x04, least significant bit first
+	g.Expect(p[2:8]).To(Equal(Pulses{560, 560, 560, 560, 560, 1690}))
+	// Complement of the address
+	g.Expect(p[18:24]).To(Equal(Pulses{560, 1690, 560, 1690, 560, 560}))
+	g.Expect(p[len(p)-2:]).To(Equal(Pulses{560, 40000}))
+}
+
+func TestSamsung(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := Samsung(0x07, 0x02)
+	g.Expect(p).To(HaveLen(2 + 32*2 + 2))
+	g.Expect(p[:2]).To(Equal(Pulses{4500, 4500}))
+	// Address is sent twice
+	g.Expect(p[2:18]).To(Equal(p[18:34]))
+	// Command 0x02, then its complement 0xfd
+	g.Expect(p[34:38]).To(Equal(Pulses{560, 560, 560, 1690}))
+	g.Expect(p[50:54]).To(Equal(Pulses{560, 1690, 560, 560}))
+}
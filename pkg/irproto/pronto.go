@@ -0,0 +1,52 @@
+package irproto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// prontoClock is the Pronto reference clock period, in microseconds.
+const prontoClock = 0.241246
+
+// ParsePronto decodes a raw (learned) Pronto hex code, like "0000 006D 0022 0002 0157 00AC ...".
+// The once sequence is followed by the repeat sequence, if any.
+func ParsePronto(code string) (Pulses, error) {
+	fields := strings.Fields(code)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("pronto code is too short")
+	}
+	words := make([]int, len(fields))
+	for idx, f := range fields {
+		if len(f) != 4 {
+			return nil, fmt.Errorf("invalid pronto word %q, expected 4 hex digits", f)
+		}
+		w, err := strconv.ParseUint(f, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pronto word %q", f)
+		}
+		words[idx] = int(w)
+	}
+
+	if words[0] != 0 {
+		return nil, fmt.Errorf("unsupported pronto format %04X, only raw codes (0000) are supported", words[0])
+	}
+	frequency, once, repeat := words[1], words[2], words[3]
+	if frequency == 0 {
+		return nil, fmt.Errorf("invalid pronto carrier frequency")
+	}
+	if once+repeat == 0 {
+		return nil, fmt.Errorf("pronto code has no burst pair")
+	}
+	if len(words) != 4+2*(once+repeat) {
+		return nil, fmt.Errorf("pronto code has %d words, expected %d", len(words), 4+2*(once+repeat))
+	}
+
+	period := float64(frequency) * prontoClock
+	p := Pulses{}
+	for idx := 4; idx < len(words); idx += 2 {
+		p.Mark(int(float64(words[idx])*period + 0.5))
+		p.Space(int(float64(words[idx+1])*period + 0.5))
+	}
+	return p, nil
+}
@@ -0,0 +1,27 @@
+package irproto
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParsePronto(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p, err := ParsePronto("0000 006D 0002 0000 0156 00AB 0015 0040")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p).To(Equal(Pulses{8993, 4497, 552, 1683}))
+
+	// Repeat sequence follows the once sequence
+	p, err = ParsePronto("0000 006d 0001 0001 0156 00ab 0156 0055")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(p).To(Equal(Pulses{8993, 4497, 8993, 2235}))
+
+	_, err = ParsePronto("0100 006D 0001 0000 0156 00AB")
+	g.Expect(err).To(MatchError("unsupported pronto format 0100, only raw codes (0000) are supported"))
+	_, err = ParsePronto("0000 006D 0002 0000 0156 00AB")
+	g.Expect(err).To(MatchError("pronto code has 6 words, expected 8"))
+	_, err = ParsePronto("0000 006D 0001 0000 0156 0XAB")
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,122 @@
+package irproto
+
+import (
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+const (
+	// Broadlink durations are expressed in ticks of 8192/269 µs (~30.45µs).
+	broadlinkTickNum = 8192
+	broadlinkTickDen = 269
+	// trailingGap is the final space appended to every code, matching what Broadlink devices produce on capture.
+	trailingGap = 0x0d05 * broadlinkTickNum / broadlinkTickDen
+)
+
+// Timing describes the pulse distance encoding used by most IR protocols.
+// All durations are expressed in microseconds.
+type Timing struct {
+	HeaderMark  int
+	HeaderSpace int
+	BitMark     int
+	OneSpace    int
+	ZeroSpace   int
+	// Gap is the space sent after the footer mark, separating frames.
+	Gap int
+}
+
+// Pulses is a sequence of alternating mark and space durations, in microseconds, starting with a mark.
+type Pulses []int
+
+// Mark appends an IR mark (carrier on) of the given duration.
+func (p *Pulses) Mark(us int) {
+	p.add(us, true)
+}
+
+// Space appends an IR space (carrier off) of the given duration.
+func (p *Pulses) Space(us int) {
+	p.add(us, false)
+}
+
+func (p *Pulses) add(us int, mark bool) {
+	n := len(*p)
+	// Marks live at even indices, spaces at odd ones: merge consecutive pulses of the same kind
+	if n > 0 && (n%2 == 1) == mark {
+		(*p)[n-1] += us
+		return
+	}
+	if n == 0 && !mark {
+		// Leading spaces are meaningless
+		return
+	}
+	*p = append(*p, us)
+}
+
+// Header appends the header mark and space of the given timing.
+func (p *Pulses) Header(t Timing) {
+	p.Mark(t.HeaderMark)
+	p.Space(t.HeaderSpace)
+}
+
+// Footer appends the footer mark followed by the inter-frame gap of the given timing.
+func (p *Pulses) Footer(t Timing) {
+	p.Mark(t.BitMark)
+	p.Space(t.Gap)
+}
+
+// Bits appends the nbits lowest bits of value, least significant bit first.
+func (p *Pulses) Bits(value uint64, nbits int, t Timing) {
+	for i := 0; i < nbits; i++ {
+		p.Mark(t.BitMark)
+		if value&(1<<uint(i)) != 0 {
+			p.Space(t.OneSpace)
+		} else {
+			p.Space(t.ZeroSpace)
+		}
+	}
+}
+
+// BitsMSB appends the nbits lowest bits of value, most significant bit first.
+func (p *Pulses) BitsMSB(value uint64, nbits int, t Timing) {
+	for i := nbits - 1; i >= 0; i-- {
+		p.Mark(t.BitMark)
+		if value&(1<<uint(i)) != 0 {
+			p.Space(t.OneSpace)
+		} else {
+			p.Space(t.ZeroSpace)
+		}
+	}
+}
+
+// Bytes appends every byte of data, least significant bit first.
+func (p *Pulses) Bytes(data []byte, t Timing) {
+	for _, b := range data {
+		p.Bits(uint64(b), 8, t)
+	}
+}
+
+// Broadlink converts the pulses to the code format used by Broadlink devices, suitable for sending as is.
+func (p Pulses) Broadlink() remotes.IRCommand {
+	out := make([]byte, 0, len(p)+3)
+	for _, us := range p {
+		out = appendTicks(out, us)
+	}
+	if len(p)%2 == 1 {
+		// Always terminate with a space so that consecutive repeats do not merge
+		out = appendTicks(out, trailingGap)
+	}
+	return out
+}
+
+func appendTicks(out []byte, us int) []byte {
+	ticks := (us*broadlinkTickDen + broadlinkTickNum/2) / broadlinkTickNum
+	if ticks < 1 {
+		ticks = 1
+	}
+	if ticks < 256 {
+		return append(out, byte(ticks))
+	}
+	if ticks > 0xffff {
+		ticks = 0xffff
+	}
+	return append(out, 0, byte(ticks>>8), byte(ticks))
+}
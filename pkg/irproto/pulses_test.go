@@ -0,0 +1,36 @@
+package irproto
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPulses_Broadlink(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	p := Pulses{}
+	// Leading space is dropped, consecutive marks are merged
+	p.Space(100)
+	p.Mark(4500)
+	p.Mark(4500)
+	p.Space(4500)
+	p.Mark(560)
+
+	g.Expect(p).To(Equal(Pulses{9000, 4500, 560}))
+	// Long durations are escaped with a zero byte, trailing gap is added after the final mark
+	g.Expect([]byte(p.Broadlink())).To(Equal([]byte{0x00, 0x01, 0x28, 0x94, 0x12, 0x00, 0x0d, 0x05}))
+}
+
+func TestPulses_Bits(t *testing.T) {
+	g := NewGomegaWithT(t)
+	timing := Timing{BitMark: 1, OneSpace: 3, ZeroSpace: 2}
+
+	p := Pulses{}
+	p.Bits(0x2, 2, timing)
+	g.Expect(p).To(Equal(Pulses{1, 2, 1, 3}))
+
+	p = Pulses{}
+	p.BitsMSB(0x2, 2, timing)
+	g.Expect(p).To(Equal(Pulses{1, 3, 1, 2}))
+}
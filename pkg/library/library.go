@@ -0,0 +1,184 @@
+package library
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
+)
+
+// extensions of template files, written in JSON or YAML
+var extensions = map[string]bool{
+	".json": true,
+	".yaml": true,
+	".yml":  true,
+}
+
+// Source holds templates, in a directory or in a file system like the templates bundled with the binary.
+type Source struct {
+	// Name is the directory of the templates, or names the file system in errors.
+	Name string
+	// FS holds the templates, nil when they are read from the Name directory.
+	FS http.FileSystem
+}
+
+// Dir returns the source of the templates stored in dir.
+func Dir(dir string) Source {
+	return Source{Name: dir}
+}
+
+func (s Source) fileSystem() http.FileSystem {
+	if s.FS != nil {
+		return s.FS
+	}
+	return http.Dir(s.Name)
+}
+
+// location returns where the template file is, as shown in errors.
+func (s Source) location(file string) string {
+	return filepath.Join(s.Name, filepath.FromSlash(file))
+}
+
+// load loads the template stored in file, a path relative to the source.
+func (s Source) load(file string) (*remotes.Remote, error) {
+	if s.FS == nil {
+		return storage.LoadRemoteFile(nil, s.location(file))
+	}
+	r, err := storage.LoadRemoteFile(s.FS, "/"+file)
+	if problems, ok := err.(storage.ValidationError); ok {
+		for idx := range problems {
+			problems[idx].File = s.location(file)
+		}
+	}
+	return r, err
+}
+
+// walk calls fn with every template file of the source, as a slash separated path relative to the source, in name order.
+// Files and directories starting with a dot are skipped.
+func (s Source) walk(fn func(file string) error) error {
+	var walkDir func(dir string) error
+	walkDir = func(dir string) error {
+		d, err := s.fileSystem().Open("/" + dir)
+		if err != nil {
+			return err
+		}
+		infos, err := d.Readdir(-1)
+		d.Close()
+		if err != nil {
+			return err
+		}
+		sort.Slice(infos, func(i, j int) bool {
+			return infos[i].Name() < infos[j].Name()
+		})
+		for _, info := range infos {
+			name := path.Join(dir, info.Name())
+			switch {
+			case strings.HasPrefix(info.Name(), "."):
+			case info.IsDir():
+				if err := walkDir(name); err != nil {
+					return err
+				}
+			case extensions[strings.ToLower(path.Ext(name))]:
+				if err := fn(name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walkDir("")
+	if os.IsNotExist(err) {
+		// Missing sources are empty
+		return nil
+	}
+	return err
+}
+
+// Library holds remote templates, which remotes can extend or be copied from.
+// Templates are named after their path in their source, without extension: samsung/tv.json is samsung/tv.
+type Library struct {
+	// templates are resolved, in name order
+	templates remotes.RemoteList
+	files     map[string]string
+}
+
+// Load loads every template of the sources, and of their subdirectories. A missing directory is an empty source.
+// Templates of later sources replace the templates of earlier sources with the same name, and may extend them.
+func Load(sources ...Source) (*Library, error) {
+	l := &Library{files: make(map[string]string)}
+	byName := make(map[string]*remotes.Remote)
+	for _, src := range sources {
+		loaded := make(map[string]bool)
+		err := src.walk(func(file string) error {
+			name := strings.TrimSuffix(file, path.Ext(file))
+			if loaded[name] {
+				return fmt.Errorf("template %q is defined twice, by %s", name, src.location(file))
+			}
+			r, err := src.load(file)
+			if err != nil {
+				return err
+			}
+			r.Name = name
+			byName[name] = r
+			loaded[name] = true
+			l.files[name] = src.location(file)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	templates := make(remotes.RemoteList, 0, len(byName))
+	for _, r := range byName {
+		templates = append(templates, r)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	locate := func(index int) (string, string) {
+		return l.files[templates[index].Name], ""
+	}
+	if problems := storage.ValidateRemotes(templates, locate); len(problems) > 0 {
+		return nil, problems
+	}
+	// Templates may extend other templates
+	resolved, err := templates.Resolve(nil)
+	if err != nil {
+		return nil, err
+	}
+	if problems := storage.ValidateRemotes(resolved, locate); len(problems) > 0 {
+		return nil, problems
+	}
+	l.templates = resolved
+	return l, nil
+}
+
+// Find returns the template with the given name, nil when there is none.
+func (l *Library) Find(name string) *remotes.Remote {
+	return l.templates.Find(name)
+}
+
+// File returns where the template with the given name was loaded from.
+func (l *Library) File(name string) string {
+	return l.files[name]
+}
+
+// Finder looks templates up in the library, when resolving remotes.
+func (l *Library) Finder() remotes.TemplateFinder {
+	return func(name string) (*remotes.Remote, bool) {
+		r := l.Find(name)
+		return r, r != nil
+	}
+}
+
+// Templates returns every template, in name order. Templates hold what they inherit.
+func (l *Library) Templates() remotes.RemoteList {
+	return l.templates
+}
@@ -0,0 +1,132 @@
+package library
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/irproto"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/storage"
+)
+
+func writeFile(g *GomegaWithT, filename string, content string) {
+	g.Expect(os.MkdirAll(filepath.Dir(filename), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filename, []byte(content), 0644)).To(Succeed())
+}
+
+func TestLoad(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "library")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	// Missing directories are empty libraries
+	l, err := Load(Dir(filepath.Join(dir, "missing")))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(l.Templates()).To(BeEmpty())
+
+	writeFile(g, filepath.Join(dir, "samsung", "tv.json"), `{"version": 2, "brand": "Samsung", "commands": {"power": "0001", "mute": "0002"}}`)
+	writeFile(g, filepath.Join(dir, "samsung", "tv-4k.yaml"), "extends: samsung/tv\ncommands:\n  netflix: \"0003\"\n")
+	writeFile(g, filepath.Join(dir, "README.md"), "Not a template")
+	l, err = Load(Dir(dir))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(l.Templates().Names()).To(Equal([]string{"samsung/tv", "samsung/tv-4k"}))
+	g.Expect(l.Find("samsung/tv").Brand).To(Equal("Samsung"))
+	g.Expect(l.Find("lg/tv")).To(BeNil())
+
+	// Remotes extend templates, through the store
+	store := storage.WithTemplates(storage.NewDirStore(filepath.Join(dir, "config")), l.Finder())
+	tv := &remotes.Remote{Name: "living-tv", Extends: "samsung/tv-4k", Commands: map[string]remotes.IRCommand{"mute": {4}}}
+	g.Expect(store.SaveRemotes(remotes.RemoteList{tv})).To(Succeed())
+	rl, err := store.LoadRemotes()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rl[0].Brand).To(Equal("Samsung"))
+	g.Expect(rl[0].CommandNames()).To(Equal([]string{"mute", "netflix", "power"}))
+	g.Expect(rl[0].Commands["mute"]).To(Equal(remotes.IRCommand{4}))
+
+	// Only what is not inherited is saved
+	rl[0].Commands["input"] = remotes.IRCommand{5}
+	g.Expect(store.SaveRemotes(rl)).To(Succeed())
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "config", "remotes", "living-tv.json"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(raw)).NotTo(ContainSubstring("netflix"))
+	g.Expect(string(raw)).To(ContainSubstring("input"))
+
+	// Invalid templates are reported
+	writeFile(g, filepath.Join(dir, "lg", "tv.yml"), "version: 2\ncommands:\n  power: zz\n")
+	_, err = Load(Dir(dir))
+	g.Expect(err).To(MatchError(ContainSubstring("invalid hex IR code zz")))
+}
+
+func TestLoad_Sources(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	bundled, err := ioutil.TempDir("", "bundled")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(bundled)
+	local, err := ioutil.TempDir("", "library")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(local)
+
+	writeFile(g, filepath.Join(bundled, "samsung", "tv.json"), `{"version": 2, "brand": "Samsung", "commands": {"power": "0001"}}`)
+	writeFile(g, filepath.Join(bundled, "lg", "tv.json"), `{"version": 2, "brand": "LG", "commands": {"power": "0001"}}`)
+	writeFile(g, filepath.Join(local, "lg", "tv.json"), `{"version": 2, "brand": "LG", "model": "AKB", "commands": {"power": "0002"}}`)
+	writeFile(g, filepath.Join(local, "samsung", "tv-4k.json"), `{"version": 2, "extends": "samsung/tv", "commands": {"netflix": "0003"}}`)
+
+	// Later sources replace and extend the templates of earlier ones
+	l, err := Load(Source{Name: "bundled", FS: http.Dir(bundled)}, Dir(local))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(l.Templates().Names()).To(Equal([]string{"lg/tv", "samsung/tv", "samsung/tv-4k"}))
+	g.Expect(l.Find("lg/tv").Commands["power"]).To(Equal(remotes.IRCommand{0, 2}))
+	g.Expect(l.Find("samsung/tv-4k").CommandNames()).To(Equal([]string{"netflix", "power"}))
+	g.Expect(l.File("samsung/tv")).To(Equal(filepath.Join("bundled", "samsung", "tv.json")))
+
+	writeFile(g, filepath.Join(bundled, "sony", "tv.json"), `{"version": 2, "commands": {"power": "zz"}}`)
+	_, err = Load(Source{Name: "bundled", FS: http.Dir(bundled)})
+	g.Expect(err).To(MatchError(ContainSubstring(filepath.Join("bundled", "sony", "tv.json"))))
+}
+
+func TestLibrary_Search(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	l := &Library{templates: remotes.RemoteList{
+		{Name: "lg/tv", Protocol: "nec", Metadata: remotes.Metadata{Brand: "LG", Model: "AKB75095307", Category: "tv"}},
+		{Name: "samsung/soundbar", Metadata: remotes.Metadata{Brand: "Samsung", Model: "AH59-02692E", Category: "audio"}},
+		{Name: "samsung/tv", Protocol: "samsung", Metadata: remotes.Metadata{Brand: "Samsung", Model: "BN59-01199F", Category: "tv"}},
+	}}
+
+	g.Expect(l.Search("samsung", "tv").Names()).To(Equal([]string{"samsung/tv"}))
+	g.Expect(l.Search("TV").Names()).To(Equal([]string{"lg/tv", "samsung/tv"}))
+	g.Expect(l.Search("nec").Names()).To(Equal([]string{"lg/tv"}))
+	g.Expect(l.Search("bn59-01199").Names()).To(Equal([]string{"samsung/tv"}))
+	g.Expect(l.Search()).To(HaveLen(3))
+
+	r, err := l.Lookup("samsung/tv")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(r.Name).To(Equal("samsung/tv"))
+	r, err = l.Lookup("Samsung/bn59-01199f")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(r.Name).To(Equal("samsung/tv"))
+	_, err = l.Lookup("sony/tv")
+	g.Expect(err).To(HaveOccurred())
+	_, err = l.Lookup("tv")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestBundled(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	l, err := Load(Source{Name: "bundled", FS: http.Dir(filepath.Join("..", "..", "assets", "library"))})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(l.Search("samsung", "tv")).To(HaveLen(1))
+
+	// Bundled codes are generated from the protocol of the template
+	g.Expect(l.Find("samsung/tv").Commands["power"]).To(Equal(irproto.Samsung(0x07, 0x02).Broadlink()))
+	g.Expect(l.Find("lg/tv").Commands["power"]).To(Equal(irproto.NEC(0x04, 0x08).Broadlink()))
+}
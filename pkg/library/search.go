@@ -0,0 +1,90 @@
+package library
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// normalize folds case and removes separators, so that BN59-01199F and bn5901199f match.
+func normalize(s string) string {
+	out := strings.Builder{}
+	for _, c := range s {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			out.WriteRune(unicode.ToLower(c))
+		}
+	}
+	return out.String()
+}
+
+// keywords returns the normalized words a template is indexed by: its name, brand, model, category, protocol and display name.
+func keywords(r *remotes.Remote) []string {
+	fields := append(strings.Split(r.Name, "/"), r.Brand, r.Model, r.Category, r.Protocol)
+	fields = append(fields, strings.Fields(r.DisplayName)...)
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if n := normalize(f); n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// matches tells whether every term is part of a keyword of the template.
+func matches(r *remotes.Remote, terms []string) bool {
+	words := keywords(r)
+	for _, term := range terms {
+		found := false
+		for _, w := range words {
+			if strings.Contains(w, normalize(term)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns the templates matching every term, in name order.
+// Terms match part of the template name, brand, model, category, protocol or display name, ignoring case and separators:
+// "samsung tv" finds the Samsung TV templates. Every template matches when there is no term.
+func (l *Library) Search(terms ...string) remotes.RemoteList {
+	out := remotes.RemoteList{}
+	for _, r := range l.templates {
+		if matches(r, terms) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Lookup returns the template named ref, or the single template whose brand and model are given by ref, as BRAND/MODEL.
+// Brand and model ignore case and separators.
+func (l *Library) Lookup(ref string) (*remotes.Remote, error) {
+	if r := l.Find(ref); r != nil {
+		return r, nil
+	}
+	idx := strings.Index(ref, "/")
+	if idx < 0 {
+		return nil, fmt.Errorf("no template named %q, templates are named like samsung/tv", ref)
+	}
+	brand, model := normalize(ref[:idx]), normalize(ref[idx+1:])
+	found := remotes.RemoteList{}
+	for _, r := range l.templates {
+		if normalize(r.Name) == normalize(ref) || (normalize(r.Brand) == brand && normalize(r.Model) == model) {
+			found = append(found, r)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no template named %q, nor with brand %q and model %q", ref, ref[:idx], ref[idx+1:])
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("%q matches several templates: %s", ref, strings.Join(found.Names(), ", "))
+}
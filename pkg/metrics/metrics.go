@@ -0,0 +1,256 @@
+// Package metrics keeps counters, gauges and histograms, exposed in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the Prometheus text format, written by Registry.Write.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds of histogram buckets, in seconds, suited to network calls.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// Registry holds metrics, written together.
+type Registry struct {
+	mutex    sync.Mutex
+	families []*family
+	hooks    []func()
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// family is a metric, with a series for every combination of label values.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	// value of counters and gauges, sum of histograms
+	value float64
+	// counts of histograms, per bucket, not cumulative
+	counts []uint64
+	count  uint64
+}
+
+func (r *Registry) register(name string, help string, kind string, labels []string, buckets []float64) *family {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, f := range r.families {
+		if f.name == name {
+			panic(fmt.Sprintf("metric %s is registered twice", name))
+		}
+	}
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series of the label values, created when missing. The family must be locked.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, found := f.series[key]
+	if !found {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == kindHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value which only increases, like the number of commands sent.
+type Counter struct {
+	f *family
+}
+
+// Counter registers a counter, with the given label names.
+func (r *Registry) Counter(name string, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, kindCounter, labels, nil)}
+}
+
+// Inc adds one to the series of the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series of the label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", c.f.name))
+	}
+	c.f.mutex.Lock()
+	defer c.f.mutex.Unlock()
+	c.f.get(labelValues).value += v
+}
+
+// Gauge is a value which goes up and down, like the availability of a device.
+type Gauge struct {
+	f *family
+}
+
+// Gauge registers a gauge, with the given label names.
+func (r *Registry) Gauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, kindGauge, labels, nil)}
+}
+
+// Set sets the series of the label values to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.mutex.Lock()
+	defer g.f.mutex.Unlock()
+	g.f.get(labelValues).value = v
+}
+
+// Reset removes every series, like when the labelled objects may have been removed.
+func (g *Gauge) Reset() {
+	g.f.mutex.Lock()
+	defer g.f.mutex.Unlock()
+	g.f.series = make(map[string]*series)
+}
+
+// Histogram counts observations, like durations, in buckets.
+type Histogram struct {
+	f *family
+}
+
+// Histogram registers a histogram using the given bucket upper bounds, in increasing order, with the given label names.
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets of histogram %s are not sorted", name))
+	}
+	return &Histogram{r.register(name, help, kindHistogram, labels, buckets)}
+}
+
+// Observe adds v to the series of the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.mutex.Lock()
+	defer h.f.mutex.Unlock()
+	s := h.f.get(labelValues)
+	s.value += v
+	s.count++
+	for idx, bound := range h.f.buckets {
+		if v <= bound {
+			s.counts[idx]++
+			break
+		}
+	}
+}
+
+// OnWrite registers a function called before writing metrics, which may update gauges.
+func (r *Registry) OnWrite(hook func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+// Write writes every metric in the Prometheus text format, in name order.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	hooks := append([]func(){}, r.hooks...)
+	families := append([]*family{}, r.families...)
+	r.mutex.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+	out := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(out)
+	}
+	return out.Flush()
+}
+
+func (f *family) write(out *bufio.Writer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	fmt.Fprintf(out, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(out, "# TYPE %s %s\n", f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != kindHistogram {
+			fmt.Fprintf(out, "%s%s %s\n", f.name, f.labelPairs(s, "", 0), formatFloat(s.value))
+			continue
+		}
+		cumulative := uint64(0)
+		for idx, bound := range f.buckets {
+			cumulative += s.counts[idx]
+			fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, f.labelPairs(s, "le", bound), cumulative)
+		}
+		fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, f.labelPairs(s, "le", math.Inf(1)), s.count)
+		fmt.Fprintf(out, "%s_sum%s %s\n", f.name, f.labelPairs(s, "", 0), formatFloat(s.value))
+		fmt.Fprintf(out, "%s_count%s %d\n", f.name, f.labelPairs(s, "", 0), s.count)
+	}
+}
+
+// labelPairs formats the labels of the series, along with the extra label when not empty.
+func (f *family) labelPairs(s *series, extra string, extraValue float64) string {
+	pairs := make([]string, 0, len(f.labels)+1)
+	for idx, name := range f.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(s.labelValues[idx])))
+	}
+	if extra != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra, formatFloat(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	r := NewRegistry()
+	sent := r.Counter("sent_total", "Commands sent.", "remote", "result")
+	online := r.Gauge("online", "Device availability.", "device")
+	latency := r.Histogram("latency_seconds", "Send latency.", []float64{0.1, 1}, "device")
+	r.Counter("reloads_total", "Reloads,\nwith a \\ in help.")
+
+	sent.Inc("tv", "success")
+	sent.Inc("tv", "success")
+	sent.Add(0.5, `a"b`, "failure")
+	online.Set(1, "office")
+	latency.Observe(0.05, "office")
+	latency.Observe(0.5, "office")
+	latency.Observe(3, "office")
+	r.OnWrite(func() {
+		online.Reset()
+		online.Set(0, "shelf")
+	})
+
+	out := bytes.Buffer{}
+	g.Expect(r.Write(&out)).To(Succeed())
+	g.Expect(out.String()).To(Equal(`# HELP latency_seconds Send latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{device="office",le="0.1"} 1
+latency_seconds_bucket{device="office",le="1"} 2
+latency_seconds_bucket{device="office",le="+Inf"} 3
+latency_seconds_sum{device="office"} 3.55
+latency_seconds_count{device="office"} 3
+# HELP online Device availability.
+# TYPE online gauge
+online{device="shelf"} 0
+# HELP reloads_total Reloads,\nwith a \\ in help.
+# TYPE reloads_total counter
+# HELP sent_total Commands sent.
+# TYPE sent_total counter
+sent_total{remote="a\"b",result="failure"} 0.5
+sent_total{remote="tv",result="success"} 2
+`))
+}
+
+func TestRegistry_Misuse(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	r := NewRegistry()
+	c := r.Counter("sent_total", "Commands sent.", "remote")
+	g.Expect(func() { c.Inc() }).To(Panic())
+	g.Expect(func() { c.Add(-1, "tv") }).To(Panic())
+	g.Expect(func() { r.Gauge("sent_total", "Again.") }).To(Panic())
+	g.Expect(func() { r.Histogram("latency", "Unsorted.", []float64{1, 0.1}) }).To(Panic())
+}
@@ -0,0 +1,268 @@
+package mqtt
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+)
+
+const (
+	// DefaultTopicPrefix is the prefix used by every topic, unless configured otherwise.
+	DefaultTopicPrefix = "ir-remotes"
+
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+)
+
+// Config holds the MQTT broker connection settings.
+type Config struct {
+	// Broker is the broker URL, like tcp://localhost:1883 or ssl://localhost:8883.
+	Broker      string
+	ClientID    string
+	Username    string
+	Password    string
+	TopicPrefix string
+	QoS         byte
+	// TLS is used for ssl:// and tls:// broker URLs. Optional.
+	TLS            *tls.Config
+	ConnectTimeout time.Duration
+	// DiscoveryPrefix is the Home Assistant discovery topic prefix. Discovery is disabled when empty.
+	DiscoveryPrefix string
+	// Logger logs the bridge activity, tagged with the broker. Defaults to the standard logger.
+	Logger *log.Entry
+}
+
+// SendOptions are given in the payload of command requests.
+type SendOptions struct {
+	// Count is the number of times the command is repeated.
+	Count int `json:"count"`
+	// Partial makes the send succeed when any device succeeds, instead of every device.
+	Partial bool `json:"partial"`
+	// RequestID identifies the message, in logs. It is generated for every message.
+	RequestID string `json:"-"`
+}
+
+// Sender sends the IR command of a remote, using the options of the request.
+type Sender func(remote string, command string, opts SendOptions) error
+
+// Result is published after each command sent on behalf of an MQTT message.
+type Result struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Bridge connects to a MQTT broker, sending IR commands on request and publishing results and availability.
+//
+// Topics, relative to the configured prefix:
+//
+//	status                            bridge availability (online/offline, retained)
+//	devices/<device>/availability     device availability (online/offline, retained)
+//	<remote>/<command>/set            command request, payload is the optional repeat count, or SendOptions as JSON
+//	<remote>/<command>/result         command result, as JSON
+//
+// Names are escaped in topics, as MQTT forbids wildcards in published topics: characters %, /, + and #
+// are percent-encoded, like tv/vol%2B/set for command vol+.
+type Bridge struct {
+	config Config
+	send   Sender
+	client paho.Client
+
+	discoveryMutex sync.Mutex
+	// discoveryKnown holds the discovery topics published, or found on the broker before the first publication.
+	discoveryKnown     map[string]bool
+	discoveryPublished bool
+}
+
+// NewBridge creates a bridge using the given configuration. Commands are sent using the provided sender.
+func NewBridge(config Config, send Sender) *Bridge {
+	if config.TopicPrefix == "" {
+		config.TopicPrefix = DefaultTopicPrefix
+	}
+	if config.ClientID == "" {
+		config.ClientID = DefaultTopicPrefix
+	}
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = 10 * time.Second
+	}
+	if config.Logger == nil {
+		config.Logger = log.NewEntry(log.StandardLogger())
+	}
+	config.Logger = config.Logger.WithField("broker", config.Broker)
+	b := &Bridge{
+		config:         config,
+		send:           send,
+		discoveryKnown: make(map[string]bool),
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetConnectTimeout(config.ConnectTimeout).
+		SetWill(b.topic("status"), payloadOffline, config.QoS, true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			config.Logger.WithError(err).Warn("Lost connection to MQTT broker")
+		})
+	if config.TLS != nil {
+		opts.SetTLSConfig(config.TLS)
+	}
+	b.client = paho.NewClient(opts)
+	return b
+}
+
+func (b *Bridge) topic(parts ...string) string {
+	return b.config.TopicPrefix + "/" + strings.Join(parts, "/")
+}
+
+var topicEscaper = strings.NewReplacer("%", "%25", "/", "%2F", "+", "%2B", "#", "%23")
+
+// topicName escapes the name of a remote, command or device, so that it is a single level of a topic.
+func topicName(name string) string {
+	return topicEscaper.Replace(name)
+}
+
+// Connect connects to the broker. Connection is automatically restored when lost.
+func (b *Bridge) Connect() error {
+	token := b.client.Connect()
+	if !token.WaitTimeout(b.config.ConnectTimeout) {
+		return fmt.Errorf("timed out connecting to MQTT broker %s", b.config.Broker)
+	}
+	return token.Error()
+}
+
+// Disconnect publishes the offline status and disconnects from the broker.
+func (b *Bridge) Disconnect() {
+	if b.client.IsConnected() {
+		b.publish(b.topic("status"), true, payloadOffline)
+	}
+	b.client.Disconnect(250)
+}
+
+// PublishDeviceAvailability publishes whether the device is online.
+func (b *Bridge) PublishDeviceAvailability(device string, online bool) error {
+	payload := payloadOffline
+	if online {
+		payload = payloadOnline
+	}
+	return b.publish(b.topic("devices", topicName(device), "availability"), true, payload)
+}
+
+func (b *Bridge) publish(topic string, retained bool, payload interface{}) error {
+	token := b.client.Publish(topic, b.config.QoS, retained, payload)
+	if !token.WaitTimeout(b.config.ConnectTimeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return token.Error()
+}
+
+// onConnect is called on every (re)connection: subscriptions are not kept by the broker across clean sessions.
+func (b *Bridge) onConnect(client paho.Client) {
+	logger := b.config.Logger
+	logger.Info("Connected to MQTT broker")
+
+	token := client.Subscribe(b.topic("+", "+", "set"), b.config.QoS, b.onSetMessage)
+	if token.WaitTimeout(b.config.ConnectTimeout) && token.Error() != nil {
+		logger.WithError(token.Error()).Error("Failed to subscribe to MQTT commands")
+	}
+	if b.config.DiscoveryPrefix != "" {
+		token := client.Subscribe(b.discoveryFilter(), b.config.QoS, b.onDiscoveryMessage)
+		if token.WaitTimeout(b.config.ConnectTimeout) && token.Error() != nil {
+			logger.WithError(token.Error()).Error("Failed to subscribe to MQTT discovery")
+		}
+	}
+	if err := b.publish(b.topic("status"), true, payloadOnline); err != nil {
+		logger.WithError(err).Error("Failed to publish MQTT status")
+	}
+}
+
+func (b *Bridge) onSetMessage(_ paho.Client, msg paho.Message) {
+	// Topic is <prefix>/<remote>/<command>/set
+	parts := strings.Split(strings.TrimPrefix(msg.Topic(), b.config.TopicPrefix+"/"), "/")
+	if len(parts) != 3 {
+		return
+	}
+	remote, err := url.PathUnescape(parts[0])
+	if err != nil {
+		return
+	}
+	command, err := url.PathUnescape(parts[1])
+	if err != nil {
+		return
+	}
+	payload := string(msg.Payload())
+	requestID := newRequestID()
+
+	// Do not block the message router while the command is sent
+	go func() {
+		err := b.handleSet(remote, command, payload, requestID)
+		res := Result{Success: err == nil}
+		logger := b.config.Logger.WithFields(log.Fields{
+			"remote":     remote,
+			"command":    command,
+			"request_id": requestID,
+		})
+		if err != nil {
+			res.Error = err.Error()
+			logger.WithError(err).Error("Failed to send command requested over MQTT")
+		}
+
+		raw, _ := json.Marshal(res)
+		if err := b.publish(b.topic(topicName(remote), topicName(command), "result"), false, raw); err != nil {
+			logger.WithError(err).Error("Failed to publish MQTT command result")
+		}
+	}()
+}
+
+func (b *Bridge) handleSet(remote string, command string, payload string, requestID string) error {
+	opts, err := parseSendOptions(payload)
+	if err != nil {
+		return err
+	}
+	opts.RequestID = requestID
+	return b.send(remote, command, opts)
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// parseSendOptions parses the payload of command requests: empty, a repeat count, or SendOptions as JSON.
+func parseSendOptions(payload string) (SendOptions, error) {
+	opts := SendOptions{Count: 1}
+	payload = strings.TrimSpace(payload)
+	switch {
+	case payload == "":
+		return opts, nil
+	case strings.HasPrefix(payload, "{"):
+		if err := json.Unmarshal([]byte(payload), &opts); err != nil {
+			return opts, fmt.Errorf("invalid options %q, %s", payload, err)
+		}
+		if opts.Count < 1 || opts.Count > devices.MaxRepeat {
+			return opts, fmt.Errorf("invalid repeat count %d, expected 1 to %d", opts.Count, devices.MaxRepeat)
+		}
+	default:
+		var err error
+		opts.Count, err = strconv.Atoi(payload)
+		if err != nil || opts.Count < 1 || opts.Count > devices.MaxRepeat {
+			return opts, fmt.Errorf("invalid repeat count %q, expected 1 to %d", payload, devices.MaxRepeat)
+		}
+	}
+	return opts, nil
+}
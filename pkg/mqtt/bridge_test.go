@@ -0,0 +1,128 @@
+package mqtt
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+type sentCommand struct {
+	remote  string
+	command string
+	opts    SendOptions
+}
+
+func newTestClient(g *GomegaWithT, broker *testBroker) paho.Client {
+	opts := paho.NewClientOptions().AddBroker(broker.URL()).SetClientID("test")
+	client := paho.NewClient(opts)
+	token := client.Connect()
+	g.Expect(token.WaitTimeout(time.Second)).To(BeTrue())
+	g.Expect(token.Error()).NotTo(HaveOccurred())
+	return client
+}
+
+func TestBridge(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	broker, err := newTestBroker()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer broker.Close()
+
+	mutex := sync.Mutex{}
+	sent := []sentCommand{}
+	requestIDs := []string{}
+	send := func(remote string, command string, opts SendOptions) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requestIDs = append(requestIDs, opts.RequestID)
+		opts.RequestID = ""
+		sent = append(sent, sentCommand{remote, command, opts})
+		if command == "missing" {
+			return fmt.Errorf("remote %q has no command %q", remote, command)
+		}
+		return nil
+	}
+
+	logger, hook := test.NewNullLogger()
+	bridge := NewBridge(Config{Broker: broker.URL(), TopicPrefix: "home", QoS: 1, Logger: log.NewEntry(logger)}, send)
+	g.Expect(bridge.Connect()).To(Succeed())
+	g.Expect(bridge.PublishDeviceAvailability("living-room", true)).To(Succeed())
+
+	g.Eventually(func() string {
+		payload, _ := broker.Retained("home/status")
+		return payload
+	}).Should(Equal("online"))
+	payload, _ := broker.Retained("home/devices/living-room/availability")
+	g.Expect(payload).To(Equal("online"))
+
+	results := make(chan string, 10)
+	client := newTestClient(g, broker)
+	defer client.Disconnect(0)
+	token := client.Subscribe("home/+/+/result", 0, func(_ paho.Client, msg paho.Message) {
+		results <- msg.Topic() + " " + string(msg.Payload())
+	})
+	g.Expect(token.WaitTimeout(time.Second)).To(BeTrue())
+
+	client.Publish("home/tv/power/set", 0, false, "3").Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/power/result {"success":true}`)))
+
+	client.Publish("home/tv/power/set", 0, false, "").Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/power/result {"success":true}`)))
+
+	client.Publish("home/tv/missing/set", 0, false, "").Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/missing/result {"success":false,"error":"remote \"tv\" has no command \"missing\""}`)))
+	// Failures are logged with the configured logger, along with the request ID given to the sender
+	g.Eventually(hook.LastEntry).ShouldNot(BeNil())
+	g.Expect(hook.LastEntry().Data).To(HaveKeyWithValue("command", "missing"))
+	g.Expect(hook.LastEntry().Data).To(HaveKeyWithValue("broker", broker.URL()))
+	mutex.Lock()
+	g.Expect(requestIDs).NotTo(ContainElement(""))
+	g.Expect(hook.LastEntry().Data).To(HaveKeyWithValue("request_id", requestIDs[len(requestIDs)-1]))
+	mutex.Unlock()
+
+	client.Publish("home/tv/power/set", 0, false, "zero").Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/power/result {"success":false,"error":"invalid repeat count \"zero\", expected 1 to 256"}`)))
+
+	// The device receives the count in one byte, larger counts would wrap
+	client.Publish("home/tv/power/set", 0, false, "300").Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/power/result {"success":false,"error":"invalid repeat count \"300\", expected 1 to 256"}`)))
+	client.Publish("home/tv/power/set", 0, false, "256").Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/power/result {"success":true}`)))
+
+	// Options are given as JSON, the count defaults to 1
+	client.Publish("home/tv/power/set", 0, false, `{"partial": true}`).Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/power/result {"success":true}`)))
+	client.Publish("home/tv/power/set", 0, false, `{"count": 0}`).Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/power/result {"success":false,"error":"invalid repeat count 0, expected 1 to 256"}`)))
+
+	// Names are escaped in topics
+	client.Publish("home/tv/vol%2B/set", 0, false, "").Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/vol%2B/result {"success":true}`)))
+	client.Publish("home/tv/a%2Fb/set", 0, false, "").Wait()
+	g.Eventually(results).Should(Receive(Equal(`home/tv/a%2Fb/result {"success":true}`)))
+	g.Expect(bridge.PublishDeviceAvailability("hall#1", false)).To(Succeed())
+	payload, _ = broker.Retained("home/devices/hall%231/availability")
+	g.Expect(payload).To(Equal("offline"))
+
+	mutex.Lock()
+	g.Expect(sent).To(Equal([]sentCommand{
+		{"tv", "power", SendOptions{Count: 3}},
+		{"tv", "power", SendOptions{Count: 1}},
+		{"tv", "missing", SendOptions{Count: 1}},
+		{"tv", "power", SendOptions{Count: 256}},
+		{"tv", "power", SendOptions{Count: 1, Partial: true}},
+		{"tv", "vol+", SendOptions{Count: 1}},
+		{"tv", "a/b", SendOptions{Count: 1}},
+	}))
+	mutex.Unlock()
+
+	bridge.Disconnect()
+	payload, _ = broker.Retained("home/status")
+	g.Expect(payload).To(Equal("offline"))
+}
@@ -0,0 +1,209 @@
+package mqtt
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// testBroker is a minimal in-process MQTT broker, supporting QoS 0 and 1 publishing, retained messages and wills.
+// Messages are always delivered with QoS 0.
+type testBroker struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	sessions map[*testSession]bool
+	retained map[string][]byte
+}
+
+type testSession struct {
+	conn    net.Conn
+	mutex   sync.Mutex
+	filters []string
+	will    *packets.PublishPacket
+}
+
+func newTestBroker() (*testBroker, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	b := &testBroker{
+		listener: l,
+		sessions: make(map[*testSession]bool),
+		retained: make(map[string][]byte),
+	}
+	go b.accept()
+	return b, nil
+}
+
+func (b *testBroker) URL() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *testBroker) Close() {
+	b.listener.Close()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for s := range b.sessions {
+		s.conn.Close()
+	}
+}
+
+func (b *testBroker) Retained(topic string) (string, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	payload, found := b.retained[topic]
+	return string(payload), found
+}
+
+// Retain stores a retained message, as if published by a client.
+func (b *testBroker) Retain(topic string, payload string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.retained[topic] = []byte(payload)
+}
+
+func (b *testBroker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		s := &testSession{conn: conn}
+		b.mutex.Lock()
+		b.sessions[s] = true
+		b.mutex.Unlock()
+		go b.serve(s)
+	}
+}
+
+func (b *testBroker) serve(s *testSession) {
+	clean := false
+	defer func() {
+		s.conn.Close()
+		b.mutex.Lock()
+		delete(b.sessions, s)
+		b.mutex.Unlock()
+		if !clean && s.will != nil {
+			b.dispatch(s.will)
+		}
+	}()
+
+	for {
+		cp, err := packets.ReadPacket(s.conn)
+		if err != nil {
+			return
+		}
+		switch p := cp.(type) {
+		case *packets.ConnectPacket:
+			if p.WillFlag {
+				will := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+				will.TopicName = p.WillTopic
+				will.Payload = p.WillMessage
+				will.Retain = p.WillRetain
+				s.will = will
+			}
+			s.write(packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = make([]byte, len(p.Topics))
+			s.mutex.Lock()
+			s.filters = append(s.filters, p.Topics...)
+			s.mutex.Unlock()
+			s.write(ack)
+			b.sendRetained(s, p.Topics)
+		case *packets.PublishPacket:
+			if p.Qos > 0 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				s.write(ack)
+			}
+			b.dispatch(p)
+		case *packets.PingreqPacket:
+			s.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			clean = true
+			return
+		}
+	}
+}
+
+func (b *testBroker) dispatch(p *packets.PublishPacket) {
+	b.mutex.Lock()
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.TopicName)
+		} else {
+			b.retained[p.TopicName] = p.Payload
+		}
+	}
+	sessions := make([]*testSession, 0, len(b.sessions))
+	for s := range b.sessions {
+		sessions = append(sessions, s)
+	}
+	b.mutex.Unlock()
+
+	for _, s := range sessions {
+		if s.matches(p.TopicName) {
+			s.deliver(p.TopicName, p.Payload, false)
+		}
+	}
+}
+
+func (b *testBroker) sendRetained(s *testSession, filters []string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for topic, payload := range b.retained {
+		for _, f := range filters {
+			if topicMatches(f, topic) {
+				s.deliver(topic, payload, true)
+				break
+			}
+		}
+	}
+}
+
+func (s *testSession) matches(topic string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, f := range s.filters {
+		if topicMatches(f, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *testSession) deliver(topic string, payload []byte, retained bool) {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName = topic
+	p.Payload = payload
+	p.Retain = retained
+	s.write(p)
+}
+
+func (s *testSession) write(p packets.ControlPacket) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p.Write(s.conn)
+}
+
+func topicMatches(filter string, topic string) bool {
+	fParts := strings.Split(filter, "/")
+	tParts := strings.Split(topic, "/")
+	for idx, f := range fParts {
+		if f == "#" {
+			return true
+		}
+		if idx >= len(tParts) {
+			return false
+		}
+		if f != "+" && f != tParts[idx] {
+			return false
+		}
+	}
+	return len(fParts) == len(tParts)
+}
@@ -0,0 +1,193 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/rooms"
+)
+
+// DefaultDiscoveryPrefix is the topic prefix Home Assistant listens to for MQTT discovery.
+const DefaultDiscoveryPrefix = "homeassistant"
+
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// haDevice is the device description shared by Home Assistant entities.
+type haDevice struct {
+	Identifiers   []string    `json:"identifiers"`
+	Connections   [][2]string `json:"connections,omitempty"`
+	Name          string      `json:"name"`
+	Manufacturer  string      `json:"manufacturer,omitempty"`
+	Model         string      `json:"model,omitempty"`
+	SuggestedArea string      `json:"suggested_area,omitempty"`
+	ViaDevice     string      `json:"via_device,omitempty"`
+}
+
+type haAvailability struct {
+	Topic string `json:"topic"`
+}
+
+// haEntity holds the configuration of the button and binary_sensor entities.
+type haEntity struct {
+	Name             string           `json:"name"`
+	UniqueID         string           `json:"unique_id"`
+	CommandTopic     string           `json:"command_topic,omitempty"`
+	PayloadPress     string           `json:"payload_press,omitempty"`
+	StateTopic       string           `json:"state_topic,omitempty"`
+	PayloadOn        string           `json:"payload_on,omitempty"`
+	PayloadOff       string           `json:"payload_off,omitempty"`
+	DeviceClass      string           `json:"device_class,omitempty"`
+	Availability     []haAvailability `json:"availability"`
+	AvailabilityMode string           `json:"availability_mode,omitempty"`
+	Device           haDevice         `json:"device"`
+}
+
+func objectID(parts ...string) string {
+	return invalidIDChars.ReplaceAllString(strings.Join(parts, "_"), "_")
+}
+
+func (b *Bridge) discoveryTopic(component string, object string) string {
+	return strings.Join([]string{b.config.DiscoveryPrefix, component, objectID(b.config.TopicPrefix), object, "config"}, "/")
+}
+
+// discoveryFilter matches every discovery topic published by the bridge.
+func (b *Bridge) discoveryFilter() string {
+	return strings.Join([]string{b.config.DiscoveryPrefix, "+", objectID(b.config.TopicPrefix), "+", "config"}, "/")
+}
+
+func (b *Bridge) deviceIdentifier(d *devices.DeviceInfo) string {
+	return objectID(b.config.TopicPrefix, "device", strings.Replace(d.MACAddress, ":", "", -1))
+}
+
+// discoveryMessages builds the discovery configuration of every entity, indexed by topic.
+// Devices become connectivity sensors, remotes become devices holding one button per command.
+// Buttons are sent by the device routed for the remote, like the device of its room, or the first device of the list.
+func (b *Bridge) discoveryMessages(remoteList remotes.RemoteList, deviceList devices.DeviceInfoList) map[string]haEntity {
+	out := make(map[string]haEntity)
+	statusAvailability := haAvailability{Topic: b.topic("status")}
+
+	for _, d := range deviceList {
+		id := b.deviceIdentifier(d)
+		out[b.discoveryTopic("binary_sensor", id)] = haEntity{
+			Name:         d.Name,
+			UniqueID:     id,
+			StateTopic:   b.topic("devices", topicName(d.Name), "availability"),
+			PayloadOn:    payloadOnline,
+			PayloadOff:   payloadOffline,
+			DeviceClass:  "connectivity",
+			Availability: []haAvailability{statusAvailability},
+			Device: haDevice{
+				Identifiers:   []string{id},
+				Connections:   [][2]string{{"mac", d.MACAddress}},
+				Name:          d.Name,
+				Manufacturer:  "Broadlink",
+				Model:         d.TypeName,
+				SuggestedArea: d.Room,
+			},
+		}
+	}
+	if len(deviceList) == 0 {
+		return out
+	}
+
+	for _, r := range remoteList {
+		sender := deviceList[0]
+		if targets, err := rooms.Targets(r, deviceList, nil, false); err == nil {
+			sender = targets[0]
+		}
+		availability := []haAvailability{
+			statusAvailability,
+			{Topic: b.topic("devices", topicName(sender.Name), "availability")},
+		}
+		remoteID := objectID(b.config.TopicPrefix, "remote", r.Name)
+		for _, cmd := range r.CommandNames() {
+			id := objectID(b.config.TopicPrefix, r.Name, cmd)
+			out[b.discoveryTopic("button", id)] = haEntity{
+				Name:             cmd,
+				UniqueID:         id,
+				CommandTopic:     b.topic(topicName(r.Name), topicName(cmd), "set"),
+				PayloadPress:     "1",
+				Availability:     availability,
+				AvailabilityMode: "all",
+				Device: haDevice{
+					Identifiers:   []string{remoteID},
+					Name:          r.Title(),
+					Manufacturer:  r.Brand,
+					Model:         r.Model,
+					SuggestedArea: r.Room,
+					ViaDevice:     b.deviceIdentifier(sender),
+				},
+			}
+		}
+	}
+	return out
+}
+
+// PublishDiscovery publishes the Home Assistant discovery configuration matching the remotes and devices.
+// Entities published before, including by a previous run, that no longer exist are removed.
+// It does nothing unless Config.DiscoveryPrefix is set.
+func (b *Bridge) PublishDiscovery(remoteList remotes.RemoteList, deviceList devices.DeviceInfoList) error {
+	if b.config.DiscoveryPrefix == "" {
+		return nil
+	}
+	messages := b.discoveryMessages(remoteList, deviceList)
+
+	b.discoveryMutex.Lock()
+	stale := []string{}
+	for topic := range b.discoveryKnown {
+		if _, found := messages[topic]; !found {
+			stale = append(stale, topic)
+		}
+	}
+	b.discoveryKnown = make(map[string]bool)
+	for topic := range messages {
+		b.discoveryKnown[topic] = true
+	}
+	b.discoveryPublished = true
+	b.discoveryMutex.Unlock()
+
+	for _, topic := range stale {
+		if err := b.publish(topic, true, ""); err != nil {
+			return err
+		}
+	}
+	for topic, msg := range messages {
+		raw, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if err := b.publish(topic, true, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onDiscoveryMessage tracks retained discovery configurations, removing the ones left over by a previous run.
+func (b *Bridge) onDiscoveryMessage(_ paho.Client, msg paho.Message) {
+	if len(msg.Payload()) == 0 {
+		return
+	}
+	topic := msg.Topic()
+
+	b.discoveryMutex.Lock()
+	defer b.discoveryMutex.Unlock()
+	if !b.discoveryPublished {
+		// Stale entries are removed on first publication
+		b.discoveryKnown[topic] = true
+		return
+	}
+	if b.discoveryKnown[topic] {
+		return
+	}
+	go func() {
+		if err := b.publish(topic, true, ""); err != nil {
+			b.config.Logger.WithError(err).WithField("topic", topic).Error("Failed to remove stale discovery configuration")
+		}
+	}()
+}
@@ -0,0 +1,105 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+func TestBridge_PublishDiscovery(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	broker, err := newTestBroker()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer broker.Close()
+
+	// Left over by a previous run
+	staleTopic := "homeassistant/button/ir-remotes/ir-remotes_old_power/config"
+	broker.Retain(staleTopic, "{}")
+
+	send := func(string, string, SendOptions) error { return nil }
+	bridge := NewBridge(Config{Broker: broker.URL(), DiscoveryPrefix: DefaultDiscoveryPrefix}, send)
+	g.Expect(bridge.Connect()).To(Succeed())
+	defer bridge.Disconnect()
+
+	tv := remotes.NewRemote("tv")
+	tv.DisplayName = "Living room TV"
+	tv.Brand = "Sony"
+	tv.Room = "Living room"
+	g.Expect(tv.AddCommand("power", []byte{1})).To(Succeed())
+	g.Expect(tv.AddCommand("vol up", []byte{2})).To(Succeed())
+	g.Expect(tv.AddCommand("vol+", []byte{4})).To(Succeed())
+	ampli := remotes.NewRemote("ampli")
+	g.Expect(ampli.AddCommand("power", []byte{3})).To(Succeed())
+	ampli.Device = "office"
+	deviceList := devices.DeviceInfoList{
+		{Name: "living-room", MACAddress: "78:0f:77:5a:b2:92", TypeName: "RM Mini"},
+		{Name: "office", MACAddress: "78:0f:77:5a:b2:93", TypeName: "RM Mini"},
+	}
+
+	g.Eventually(func() bool {
+		_, found := broker.Retained(staleTopic)
+		if !found {
+			return true
+		}
+		// Retry until the stale configuration has been seen by the bridge
+		g.Expect(bridge.PublishDiscovery(remotes.RemoteList{tv, ampli}, deviceList)).To(Succeed())
+		return false
+	}).Should(BeTrue())
+
+	retained := func(topic string) func() string {
+		return func() string {
+			payload, _ := broker.Retained(topic)
+			return payload
+		}
+	}
+
+	g.Eventually(retained("homeassistant/button/ir-remotes/ir-remotes_tv_vol_up/config")).ShouldNot(BeEmpty())
+	raw, _ := broker.Retained("homeassistant/button/ir-remotes/ir-remotes_tv_vol_up/config")
+	button := haEntity{}
+	g.Expect(json.Unmarshal([]byte(raw), &button)).To(Succeed())
+	g.Expect(button.Name).To(Equal("vol up"))
+	g.Expect(button.CommandTopic).To(Equal("ir-remotes/tv/vol up/set"))
+	g.Expect(button.Device.Identifiers).To(Equal([]string{"ir-remotes_remote_tv"}))
+	g.Expect(button.Device.ViaDevice).To(Equal("ir-remotes_device_780f775ab292"))
+	g.Expect(button.Availability).To(ConsistOf(
+		haAvailability{Topic: "ir-remotes/status"},
+		haAvailability{Topic: "ir-remotes/devices/living-room/availability"},
+	))
+	g.Expect(button.Device.Name).To(Equal("Living room TV"))
+	g.Expect(button.Device.Manufacturer).To(Equal("Sony"))
+	g.Expect(button.Device.SuggestedArea).To(Equal("Living room"))
+
+	// MQTT forbids wildcards in the topics published to
+	g.Eventually(retained("homeassistant/button/ir-remotes/ir-remotes_tv_vol_/config")).ShouldNot(BeEmpty())
+	raw, _ = broker.Retained("homeassistant/button/ir-remotes/ir-remotes_tv_vol_/config")
+	button = haEntity{}
+	g.Expect(json.Unmarshal([]byte(raw), &button)).To(Succeed())
+	g.Expect(button.Name).To(Equal("vol+"))
+	g.Expect(button.CommandTopic).To(Equal("ir-remotes/tv/vol%2B/set"))
+
+	// Buttons are sent by the preferred device of the remote
+	g.Eventually(retained("homeassistant/button/ir-remotes/ir-remotes_ampli_power/config")).ShouldNot(BeEmpty())
+	raw, _ = broker.Retained("homeassistant/button/ir-remotes/ir-remotes_ampli_power/config")
+	button = haEntity{}
+	g.Expect(json.Unmarshal([]byte(raw), &button)).To(Succeed())
+	g.Expect(button.Device.Name).To(Equal("ampli"))
+	g.Expect(button.Device.ViaDevice).To(Equal("ir-remotes_device_780f775ab293"))
+	g.Expect(button.Availability).To(ContainElement(haAvailability{Topic: "ir-remotes/devices/office/availability"}))
+
+	g.Eventually(retained("homeassistant/binary_sensor/ir-remotes/ir-remotes_device_780f775ab292/config")).ShouldNot(BeEmpty())
+	raw, _ = broker.Retained("homeassistant/binary_sensor/ir-remotes/ir-remotes_device_780f775ab292/config")
+	sensor := haEntity{}
+	g.Expect(json.Unmarshal([]byte(raw), &sensor)).To(Succeed())
+	g.Expect(sensor.StateTopic).To(Equal("ir-remotes/devices/living-room/availability"))
+	g.Expect(sensor.Device.Connections).To(Equal([][2]string{{"mac", "78:0f:77:5a:b2:92"}}))
+
+	// Removing a remote removes its buttons
+	g.Expect(bridge.PublishDiscovery(remotes.RemoteList{tv}, deviceList)).To(Succeed())
+	g.Eventually(retained("homeassistant/button/ir-remotes/ir-remotes_ampli_power/config")).Should(BeEmpty())
+	g.Expect(retained("homeassistant/button/ir-remotes/ir-remotes_tv_power/config")()).NotTo(BeEmpty())
+}
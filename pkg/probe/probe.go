@@ -0,0 +1,235 @@
+// Package probe finds the IR codes of a device without its remote, by sending candidate codes until the device responds.
+package probe
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/irproto"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// protocols generate the codes of the supported protocols from an address and a command, and decode them back.
+var protocols = map[string]struct {
+	encode func(address byte, command byte) irproto.Pulses
+	decode func(p irproto.Pulses) (byte, byte, bool)
+}{
+	"nec":     {irproto.NEC, irproto.DecodeNEC},
+	"samsung": {irproto.Samsung, irproto.DecodeSamsung},
+}
+
+// Protocols returns the sorted list of protocols candidates are generated with.
+func Protocols() []string {
+	out := make([]string, 0, len(protocols))
+	for name := range protocols {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Candidate is a code to try, given by its protocol, address and command.
+type Candidate struct {
+	Protocol string
+	Address  byte
+	Command  byte
+}
+
+// Code returns the IR code of the candidate, as sent by Broadlink devices.
+func (c Candidate) Code() remotes.IRCommand {
+	return protocols[c.Protocol].encode(c.Address, c.Command).Broadlink()
+}
+
+func (c Candidate) String() string {
+	return fmt.Sprintf("%s address 0x%02x command 0x%02x", c.Protocol, c.Address, c.Command)
+}
+
+// PowerCode is the power code of a brand.
+type PowerCode struct {
+	// Brand is in lower case, empty when unknown.
+	Brand string
+	Candidate
+}
+
+// PowerCodes returns the power codes of the templates, like the templates of the library, in order.
+// Templates whose protocol is not supported, or whose power command cannot be decoded, are skipped.
+func PowerCodes(templates remotes.RemoteList) []PowerCode {
+	out := []PowerCode{}
+	for _, t := range templates {
+		proto, found := protocols[t.Protocol]
+		if !found {
+			continue
+		}
+		cmdName, found := t.Lookup("power", nil)
+		if !found {
+			continue
+		}
+		p, err := irproto.ParseBroadlink(t.Commands[cmdName])
+		if err != nil {
+			continue
+		}
+		if address, command, ok := proto.decode(p); ok {
+			out = append(out, PowerCode{Brand: strings.ToLower(t.Brand), Candidate: Candidate{t.Protocol, address, command}})
+		}
+	}
+	return out
+}
+
+// Brands returns the sorted brands of the power codes.
+func Brands(known []PowerCode) []string {
+	out := []string{}
+	seen := make(map[string]bool)
+	for _, k := range known {
+		if k.Brand != "" && !seen[k.Brand] {
+			seen[k.Brand] = true
+			out = append(out, k.Brand)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Options restrict the candidates to try.
+type Options struct {
+	// Known are the power codes tried first, see PowerCodes. Their commands are then tried with every address.
+	Known []PowerCode
+	// Brand tries the known power codes of the brand first.
+	Brand string
+	// Protocol only tries the codes of the protocol, when not empty.
+	Protocol string
+	// Address skips looking for the address when not negative, Protocol must be set then.
+	Address int
+}
+
+// Stage is the step of a session.
+type Stage int
+
+const (
+	// StageAddress looks for the protocol and address of the device, by sending power commands.
+	StageAddress Stage = iota
+	// StageCommands sends every command of the address found, to find the ones the device responds to.
+	StageCommands
+	// StageDone is reached once every candidate was tried.
+	StageDone
+)
+
+// Session sends candidates in order, narrowing them with the answers: once the device responds to a power command,
+// its protocol and address are known, and only the commands of that address are tried.
+type Session struct {
+	stage      Stage
+	candidates []Candidate
+	next       int
+	current    Candidate
+	responded  []Candidate
+}
+
+// NewSession returns a session trying the candidates matching the options.
+func NewSession(opts Options) (*Session, error) {
+	if opts.Protocol != "" {
+		if _, found := protocols[opts.Protocol]; !found {
+			return nil, fmt.Errorf("unsupported protocol %q (expected one of %s)", opts.Protocol, strings.Join(Protocols(), ", "))
+		}
+	}
+	s := &Session{}
+	if opts.Address >= 0 {
+		if opts.Protocol == "" {
+			return nil, fmt.Errorf("protocol is required along with the address")
+		}
+		if opts.Address > 0xff {
+			return nil, fmt.Errorf("address 0x%x is out of range, addresses are 8 bits", opts.Address)
+		}
+		s.findCommands(opts.Protocol, byte(opts.Address))
+		return s, nil
+	}
+	s.candidates = powerCandidates(opts.Known, strings.ToLower(opts.Brand), opts.Protocol)
+	return s, nil
+}
+
+// powerCandidates returns the known power codes, the brand ones first, then the known power commands of the protocols with every address.
+func powerCandidates(known []PowerCode, brand string, protocol string) []Candidate {
+	out := []Candidate{}
+	seen := make(map[Candidate]bool)
+	add := func(c Candidate) {
+		if !seen[c] && (protocol == "" || c.Protocol == protocol) {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	for _, k := range known {
+		if k.Brand == brand {
+			add(k.Candidate)
+		}
+	}
+	for _, k := range known {
+		add(k.Candidate)
+	}
+	for _, p := range Protocols() {
+		for address := 0; address <= 0xff; address++ {
+			for _, k := range known {
+				if k.Protocol == p {
+					add(Candidate{Protocol: p, Address: byte(address), Command: k.Command})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// findCommands switches to trying every command of the address.
+func (s *Session) findCommands(protocol string, address byte) {
+	s.stage = StageCommands
+	s.candidates = make([]Candidate, 0, 0x100)
+	for command := 0; command <= 0xff; command++ {
+		s.candidates = append(s.candidates, Candidate{Protocol: protocol, Address: address, Command: byte(command)})
+	}
+	s.next = 0
+}
+
+// Next returns the next candidate to send, false once every candidate was tried.
+func (s *Session) Next() (Candidate, bool) {
+	for s.next < len(s.candidates) {
+		c := s.candidates[s.next]
+		s.next++
+		if s.isResponded(c) {
+			continue
+		}
+		s.current = c
+		return c, true
+	}
+	s.stage = StageDone
+	return Candidate{}, false
+}
+
+func (s *Session) isResponded(c Candidate) bool {
+	for _, r := range s.responded {
+		if r == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Responded records that the device responded to the last candidate returned by Next.
+// When looking for the address, the commands of the candidate address are tried next.
+func (s *Session) Responded() {
+	s.responded = append(s.responded, s.current)
+	if s.stage == StageAddress {
+		s.findCommands(s.current.Protocol, s.current.Address)
+	}
+}
+
+// Stage returns the current step of the session.
+func (s *Session) Stage() Stage {
+	return s.stage
+}
+
+// Progress returns the number of candidates tried, and the number of candidates of the current stage.
+func (s *Session) Progress() (int, int) {
+	return s.next, len(s.candidates)
+}
+
+// Found returns the candidates the device responded to, in order.
+func (s *Session) Found() []Candidate {
+	return s.responded
+}
@@ -0,0 +1,105 @@
+package probe
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/irproto"
+	"github.com/j-vizcaino/ir-remotes/pkg/library"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// testPowerCodes returns the power codes of the bundled templates.
+func testPowerCodes(g *GomegaWithT) []PowerCode {
+	lib, err := library.Load(library.Dir("../../assets/library"))
+	g.Expect(err).NotTo(HaveOccurred())
+	return PowerCodes(lib.Templates())
+}
+
+func TestPowerCodes(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	known := testPowerCodes(g)
+	g.Expect(known).To(ConsistOf(
+		PowerCode{"lg", Candidate{Protocol: "nec", Address: 0x04, Command: 0x08}},
+		PowerCode{"samsung", Candidate{Protocol: "samsung", Address: 0x07, Command: 0x02}},
+	))
+	g.Expect(Brands(known)).To(Equal([]string{"lg", "samsung"}))
+
+	// Templates of other protocols, without power command or with codes of another protocol are skipped
+	toshiba := &remotes.Remote{Name: "toshiba/tv", Protocol: "nec", Metadata: remotes.Metadata{Brand: "Toshiba"}, Commands: map[string]remotes.IRCommand{
+		"Power": irproto.NEC(0x40, 0x12).Broadlink(),
+	}}
+	templates := remotes.RemoteList{
+		toshiba,
+		{Name: "daikin/ac", Protocol: "daikin", Commands: map[string]remotes.IRCommand{"power": {0x26}}},
+		{Name: "sony/tv", Protocol: "nec", Commands: map[string]remotes.IRCommand{"mute": irproto.NEC(0x01, 0x14).Broadlink()}},
+		{Name: "other/tv", Protocol: "nec", Commands: map[string]remotes.IRCommand{"power": irproto.Samsung(0x07, 0x02).Broadlink()}},
+	}
+	g.Expect(PowerCodes(templates)).To(Equal([]PowerCode{{"toshiba", Candidate{Protocol: "nec", Address: 0x40, Command: 0x12}}}))
+}
+
+func TestSession(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	s, err := NewSession(Options{Known: testPowerCodes(g), Brand: "LG", Address: -1})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(s.Stage()).To(Equal(StageAddress))
+
+	// Power codes of the brand are tried first
+	c, ok := s.Next()
+	g.Expect(ok).To(BeTrue())
+	g.Expect(c).To(Equal(Candidate{Protocol: "nec", Address: 0x04, Command: 0x08}))
+	g.Expect(c.Code()).To(Equal(irproto.NEC(0x04, 0x08).Broadlink()))
+	c, _ = s.Next()
+	g.Expect(c).To(Equal(Candidate{Protocol: "samsung", Address: 0x07, Command: 0x02}))
+
+	// Then every address, with the known power commands
+	for c.Address != 0x12 || c.Protocol != "nec" {
+		c, ok = s.Next()
+		g.Expect(ok).To(BeTrue())
+	}
+	s.Responded()
+	g.Expect(s.Stage()).To(Equal(StageCommands))
+
+	// Every command of the address is tried, except the ones found already
+	tried := 0
+	for c, ok = s.Next(); ok; c, ok = s.Next() {
+		g.Expect(c.Protocol).To(Equal("nec"))
+		g.Expect(c.Address).To(Equal(byte(0x12)))
+		if c.Command == 0x40 {
+			s.Responded()
+		}
+		tried++
+	}
+	g.Expect(tried).To(Equal(0xff))
+	g.Expect(s.Stage()).To(Equal(StageDone))
+	g.Expect(s.Found()).To(HaveLen(2))
+	g.Expect(s.Found()[1]).To(Equal(Candidate{Protocol: "nec", Address: 0x12, Command: 0x40}))
+}
+
+func TestNewSession(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// Candidates are restricted to the protocol
+	s, err := NewSession(Options{Known: testPowerCodes(g), Protocol: "samsung", Address: -1})
+	g.Expect(err).NotTo(HaveOccurred())
+	for c, ok := s.Next(); ok; c, ok = s.Next() {
+		g.Expect(c.Protocol).To(Equal("samsung"))
+	}
+
+	// Known addresses skip looking for the address
+	s, err = NewSession(Options{Protocol: "nec", Address: 0x04})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(s.Stage()).To(Equal(StageCommands))
+	_, total := s.Progress()
+	g.Expect(total).To(Equal(0x100))
+
+	_, err = NewSession(Options{Protocol: "rc5", Address: -1})
+	g.Expect(err).To(MatchError(ContainSubstring("unsupported protocol")))
+	_, err = NewSession(Options{Address: 0x04})
+	g.Expect(err).To(HaveOccurred())
+	_, err = NewSession(Options{Protocol: "nec", Address: 0x100})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,167 @@
+package remotes
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxSuggestions is the number of command names suggested when a command is not found.
+const maxSuggestions = 3
+
+// Aliases lists alternative names of commands, shared by every remote, like {"volume_up": ["vol_up", "vol+"]}.
+// Every name of an entry matches commands named after any other name of the entry.
+type Aliases map[string][]string
+
+// NormalizeName folds case and removes separators, so that VolUp, vol_up and vol-up match.
+// Plus signs and trailing minus signs are kept, since vol+ and vol- are different commands.
+func NormalizeName(name string) string {
+	out := strings.Builder{}
+	for _, c := range name {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) || c == '+' {
+			out.WriteRune(unicode.ToLower(c))
+		}
+	}
+	if strings.HasSuffix(name, "-") {
+		out.WriteRune('-')
+	}
+	return out.String()
+}
+
+// equivalents returns the normalized names equivalent to name, name first.
+func (a Aliases) equivalents(name string) []string {
+	normalized := NormalizeName(name)
+	out := []string{normalized}
+	seen := map[string]bool{normalized: true}
+	for canonical, aliases := range a {
+		names := append([]string{canonical}, aliases...)
+		matched := false
+		for _, n := range names {
+			if NormalizeName(n) == normalized {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, n := range names {
+			if n = NormalizeName(n); !seen[n] {
+				seen[n] = true
+				out = append(out, n)
+			}
+		}
+	}
+	sort.Strings(out[1:])
+	return out
+}
+
+// Lookup returns the name of the command matching name, tried in order:
+//
+//   - the command with this exact name
+//   - the command of the remote alias with this exact name
+//   - the command, or remote alias, with the same name when ignoring case and separators
+//   - the command, or remote alias, matching any name equivalent to name in the global aliases
+func (r *Remote) Lookup(name string, global Aliases) (string, bool) {
+	if _, found := r.Commands[name]; found {
+		return name, true
+	}
+	if cmdName, found := r.Aliases[name]; found {
+		return cmdName, true
+	}
+
+	// Normalized names of commands, then aliases, in name order so that lookups are deterministic
+	normalized := make(map[string]string)
+	for _, cmdName := range r.CommandNames() {
+		if n := NormalizeName(cmdName); normalized[n] == "" {
+			normalized[n] = cmdName
+		}
+	}
+	aliases := make([]string, 0, len(r.Aliases))
+	for alias := range r.Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		if n := NormalizeName(alias); normalized[n] == "" {
+			normalized[n] = r.Aliases[alias]
+		}
+	}
+	for _, n := range global.equivalents(name) {
+		if cmdName, found := normalized[n]; found {
+			return cmdName, true
+		}
+	}
+	return "", false
+}
+
+// Suggest returns the names of commands and aliases close to name, closest first.
+func (r *Remote) Suggest(name string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	target := NormalizeName(name)
+	candidates := []candidate{}
+	consider := func(n string) {
+		normalized := NormalizeName(n)
+		distance := editDistance(target, normalized)
+		// Allow one edit every 3 characters, and names containing the other one
+		if distance <= 1+len(target)/3 || (target != "" && strings.Contains(normalized, target)) {
+			candidates = append(candidates, candidate{n, distance})
+		}
+	}
+	for _, cmdName := range r.CommandNames() {
+		consider(cmdName)
+	}
+	for alias := range r.Aliases {
+		consider(alias)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	out := []string{}
+	for _, c := range candidates {
+		if len(out) == maxSuggestions {
+			break
+		}
+		out = append(out, c.name)
+	}
+	return out
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func minInt(values ...int) int {
+	out := values[0]
+	for _, v := range values[1:] {
+		if v < out {
+			out = v
+		}
+	}
+	return out
+}
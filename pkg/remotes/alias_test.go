@@ -0,0 +1,51 @@
+package remotes
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNormalizeName(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(NormalizeName("VolUp")).To(Equal("volup"))
+	g.Expect(NormalizeName("vol_up")).To(Equal("volup"))
+	g.Expect(NormalizeName("Vol-Up")).To(Equal("volup"))
+	g.Expect(NormalizeName("vol+")).To(Equal("vol+"))
+	g.Expect(NormalizeName("vol-")).To(Equal("vol-"))
+}
+
+func TestRemote_Lookup(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	r := NewRemote("tv")
+	for _, name := range []string{"volume_up", "arrow_up", "power", "Mute"} {
+		g.Expect(r.AddCommand(name, []byte{1})).To(Succeed())
+	}
+	r.Aliases = map[string]string{"on": "power", "vol+": "volume_up"}
+	global := Aliases{"volume_up": {"vol_up", "volup"}, "mute": {"silence"}}
+
+	lookup := func(name string) string {
+		cmdName, found := r.Lookup(name, global)
+		if !found {
+			return ""
+		}
+		return cmdName
+	}
+	g.Expect(lookup("power")).To(Equal("power"))
+	g.Expect(lookup("on")).To(Equal("power"))
+	g.Expect(lookup("ON")).To(Equal("power"))
+	g.Expect(lookup("VolumeUp")).To(Equal("volume_up"))
+	g.Expect(lookup("vol+")).To(Equal("volume_up"))
+	g.Expect(lookup("VolUp")).To(Equal("volume_up"))
+	g.Expect(lookup("vol_up")).To(Equal("volume_up"))
+	g.Expect(lookup("mute")).To(Equal("Mute"))
+	g.Expect(lookup("silence")).To(Equal("Mute"))
+	g.Expect(lookup("vol-")).To(BeEmpty())
+	g.Expect(lookup("arow_up")).To(BeEmpty())
+
+	g.Expect(r.Suggest("arow_up")).To(Equal([]string{"arrow_up"}))
+	g.Expect(r.Suggest("up")).To(Equal([]string{"arrow_up", "volume_up"}))
+	g.Expect(r.Suggest("input")).To(BeEmpty())
+}
@@ -1,33 +1,42 @@
 package remotes
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 )
 
+// IRCommand is a Broadlink IR code, encoded as hex string in configuration files.
 type IRCommand []byte
 
-func (i *IRCommand) UnmarshalJSON(b []byte) error {
-	var s string
-	if err := json.Unmarshal(b, &s); err != nil {
-		return err
+// UnmarshalText decodes the hex string, used by YAML and TOML files.
+func (i *IRCommand) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("invalid IR command format, empty code")
 	}
-
-	var out []byte
-	matched, err := fmt.Sscanf(s, "%x", &out)
-	if err != nil {
-		return err
-	}
-
-	if matched != 1 {
-		return fmt.Errorf("invalid IR command format")
+	out := make([]byte, hex.DecodedLen(len(b)))
+	if _, err := hex.Decode(out, b); err != nil {
+		return fmt.Errorf("invalid IR command format, %s", err)
 	}
 
 	*i = out
 	return nil
 }
 
+// MarshalText encodes the command as hex string, used by YAML and TOML files.
+func (i IRCommand) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%x", []byte(i))), nil
+}
+
+func (i *IRCommand) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return i.UnmarshalText([]byte(s))
+}
+
 func (i IRCommand) MarshalJSON() ([]byte, error) {
-	s := fmt.Sprintf("%x", []byte(i))
-	return json.Marshal(s)
+	s, _ := i.MarshalText()
+	return json.Marshal(string(s))
 }
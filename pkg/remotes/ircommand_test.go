@@ -3,6 +3,7 @@ package remotes
 import (
 	"encoding/json"
 	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
 	"testing"
 )
 
@@ -22,3 +23,26 @@ func TestIRComand(t *testing.T) {
 	err = json.Unmarshal([]byte("12320"), &ir2)
 	g.Expect(err).To(HaveOccurred())
 }
+
+func TestIRComandText(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	r := NewRemote("tv")
+	r.Commands["power"] = IRCommand{0x26, 10, 16, 32, 42}
+	raw, err := yaml.Marshal(r)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(raw)).To(Equal("name: tv\ncommands:\n  power: 260a10202a\n"))
+
+	r2 := &Remote{}
+	g.Expect(yaml.Unmarshal(raw, r2)).To(Succeed())
+	g.Expect(r2).To(Equal(r))
+
+	g.Expect(yaml.Unmarshal([]byte("commands:\n  power: nothex\n"), r2)).ToNot(Succeed())
+
+	// The whole code must be hex, a code is never truncated
+	for _, code := range []string{"2600zz", "26 00", "2600 garbage", "260", "2", ""} {
+		var c IRCommand
+		g.Expect(c.UnmarshalText([]byte(code))).ToNot(Succeed(), code)
+		g.Expect(c).To(BeNil(), code)
+	}
+}
@@ -0,0 +1,125 @@
+package remotes
+
+// Usual remote categories, which UIs may use to pick an icon. Other categories are allowed.
+const (
+	CategoryTV        = "tv"
+	CategoryAC        = "ac"
+	CategoryProjector = "projector"
+	CategoryAudio     = "audio"
+	CategoryMedia     = "media"
+	CategoryLight     = "light"
+	CategoryFan       = "fan"
+)
+
+// DefaultColumns is the number of columns of layouts, when not set.
+const DefaultColumns = 3
+
+// Metadata describes the remote and where it is. Every field is optional.
+type Metadata struct {
+	// DisplayName is shown instead of the remote name.
+	DisplayName string `json:"displayName,omitempty" yaml:"displayName,omitempty"`
+	Brand       string `json:"brand,omitempty" yaml:"brand,omitempty"`
+	Model       string `json:"model,omitempty" yaml:"model,omitempty"`
+	// Category is the kind of appliance controlled, like tv, ac or projector.
+	Category string `json:"category,omitempty" yaml:"category,omitempty"`
+	// Room is where the appliance is: commands are sent by the devices of the same room.
+	Room string `json:"room,omitempty" yaml:"room,omitempty"`
+	// Device is the name of the device sending commands of the remote, when none is requested, whatever the room.
+	Device string `json:"device,omitempty" yaml:"device,omitempty"`
+	// Broadcast sends commands with every device of the room, instead of the first available one.
+	Broadcast bool `json:"broadcast,omitempty" yaml:"broadcast,omitempty"`
+	// Layout arranges the buttons of the remote, commands are listed by name when not set.
+	Layout *Layout `json:"layout,omitempty" yaml:"layout,omitempty"`
+}
+
+// Layout arranges the buttons of a remote on a grid, so that UIs can render the actual remote.
+// Commands without button are not rendered.
+type Layout struct {
+	// Columns is the width of the grid, DefaultColumns when zero.
+	Columns int      `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Groups  []Group  `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Buttons []Button `json:"buttons" yaml:"buttons"`
+}
+
+// Group gathers buttons, like the volume or navigation buttons.
+type Group struct {
+	Name  string `json:"name" yaml:"name"`
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+}
+
+// Button sends a command of the remote.
+type Button struct {
+	Command string `json:"command" yaml:"command"`
+	// Label is shown on the button, the command name is shown when neither label nor icon are set.
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+	// Icon names the icon shown on the button, like power-off or volume-up.
+	Icon string `json:"icon,omitempty" yaml:"icon,omitempty"`
+	// Group is the name of the group the button belongs to, if any.
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// Row and Column locate the button on the grid, starting from 0.
+	Row    int `json:"row" yaml:"row"`
+	Column int `json:"column" yaml:"column"`
+	// Width is the number of columns used by the button, 1 when zero.
+	Width int `json:"width,omitempty" yaml:"width,omitempty"`
+}
+
+// GridColumns returns the width of the grid.
+func (l *Layout) GridColumns() int {
+	if l.Columns <= 0 {
+		return DefaultColumns
+	}
+	return l.Columns
+}
+
+// Span returns the number of columns used by the button.
+func (b Button) Span() int {
+	if b.Width <= 0 {
+		return 1
+	}
+	return b.Width
+}
+
+// Title returns the name displayed for the remote.
+func (r *Remote) Title() string {
+	if r.DisplayName != "" {
+		return r.DisplayName
+	}
+	return r.Name
+}
+
+// ButtonLayout returns the layout of the remote.
+// When not set, every command has a button, in name order.
+func (r *Remote) ButtonLayout() *Layout {
+	if r.Layout != nil {
+		return r.Layout
+	}
+	l := &Layout{Columns: DefaultColumns, Buttons: []Button{}}
+	for idx, name := range r.CommandNames() {
+		l.Buttons = append(l.Buttons, Button{
+			Command: name,
+			Row:     idx / DefaultColumns,
+			Column:  idx % DefaultColumns,
+		})
+	}
+	return l
+}
+
+// RenameCommand updates the buttons sending the command, after it was renamed.
+func (l *Layout) RenameCommand(oldName string, newName string) {
+	for idx := range l.Buttons {
+		if l.Buttons[idx].Command == oldName {
+			l.Buttons[idx].Command = newName
+		}
+	}
+}
+
+// RemoveCommand removes the buttons sending the command, after it was removed.
+func (l *Layout) RemoveCommand(name string) {
+	buttons := make([]Button, 0, len(l.Buttons))
+	for _, b := range l.Buttons {
+		if b.Command != name {
+			buttons = append(buttons, b)
+		}
+	}
+	l.Buttons = buttons
+}
@@ -0,0 +1,63 @@
+package remotes
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+func TestButtonLayout(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	r := NewRemote("tv")
+	for idx, name := range []string{"power", "mute", "vol_up", "vol_down"} {
+		g.Expect(r.AddCommand(name, []byte{byte(idx)})).To(Succeed())
+	}
+	g.Expect(r.Title()).To(Equal("tv"))
+
+	// Every command has a button, in name order
+	l := r.ButtonLayout()
+	g.Expect(l.GridColumns()).To(Equal(DefaultColumns))
+	g.Expect(l.Buttons).To(Equal([]Button{
+		{Command: "mute", Row: 0, Column: 0},
+		{Command: "power", Row: 0, Column: 1},
+		{Command: "vol_down", Row: 0, Column: 2},
+		{Command: "vol_up", Row: 1, Column: 0},
+	}))
+
+	r.DisplayName = "Living room TV"
+	r.Layout = &Layout{
+		Columns: 2,
+		Groups:  []Group{{Name: "volume", Label: "Volume"}},
+		Buttons: []Button{
+			{Command: "power", Icon: "power-off", Width: 2},
+			{Command: "vol_up", Label: "+", Group: "volume", Row: 1},
+		},
+	}
+	g.Expect(r.Title()).To(Equal("Living room TV"))
+	g.Expect(r.ButtonLayout()).To(Equal(r.Layout))
+	g.Expect(r.Layout.Buttons[0].Span()).To(Equal(2))
+	g.Expect(r.Layout.Buttons[1].Span()).To(Equal(1))
+
+	r.Layout.RenameCommand("vol_up", "volume_up")
+	g.Expect(r.Layout.Buttons[1].Command).To(Equal("volume_up"))
+	r.Layout.RemoveCommand("power")
+	g.Expect(r.Layout.Buttons).To(HaveLen(1))
+
+	// Metadata fields are stored along with the remote fields
+	raw, err := json.Marshal(r)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(raw)).To(ContainSubstring(`"displayName":"Living room TV"`))
+	decoded := &Remote{}
+	g.Expect(json.Unmarshal(raw, decoded)).To(Succeed())
+	g.Expect(decoded).To(Equal(r))
+
+	raw, err = yaml.Marshal(r)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(raw)).To(ContainSubstring("displayName: Living room TV"))
+	decoded = &Remote{}
+	g.Expect(yaml.Unmarshal(raw, decoded)).To(Succeed())
+	g.Expect(decoded).To(Equal(r))
+}
@@ -5,9 +5,27 @@ import (
 	"sort"
 )
 
+const (
+	// KindIR is the default remote kind, replaying captured IR commands.
+	KindIR = "ir"
+	// KindClimate is an air-conditioner remote, whose IR codes are generated from the desired state using Protocol.
+	KindClimate = "climate"
+)
+
 type Remote struct {
-	Name     string               `json:"name"`
-	Commands map[string]IRCommand `json:"commands"`
+	Name     string `json:"name" yaml:"name"`
+	Kind     string `json:"kind,omitempty" yaml:"kind,omitempty"`
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	// Extends is the name of the remote, or library template, this remote inherits from.
+	Extends  string `json:"extends,omitempty" yaml:"extends,omitempty"`
+	Metadata `yaml:",inline"`
+	// Aliases are alternative names of commands, like {"vol_up": "volume_up"}.
+	Aliases  map[string]string    `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Commands map[string]IRCommand `json:"commands" yaml:"commands"`
+	// parent is the resolved remote this remote extends, nil unless resolved
+	parent *Remote
+	// overrides holds the fields, commands and aliases set by the remote rather than inherited, see Override
+	overrides map[string]bool
 }
 
 type RemoteList []*Remote
@@ -19,6 +37,11 @@ func NewRemote(name string) *Remote {
 	}
 }
 
+// IsClimate returns true when the remote is an air-conditioner remote.
+func (r *Remote) IsClimate() bool {
+	return r.Kind == KindClimate
+}
+
 func (r *Remote) AddCommand(name string, irCode []byte) error {
 	_, ok := r.Commands[name]
 	if ok {
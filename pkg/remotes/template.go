@@ -0,0 +1,387 @@
+package remotes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TemplateFinder returns the template with the given name, like the templates of a library.
+type TemplateFinder func(name string) (*Remote, bool)
+
+// Parent returns the remote this remote inherits from, nil when it extends none or is not resolved.
+func (r *Remote) Parent() *Remote {
+	return r.parent
+}
+
+// Inherited tells whether the command is inherited, unmodified, from the parent.
+func (r *Remote) Inherited(cmdName string) bool {
+	if r.parent == nil || r.overrides[commandOverride+cmdName] {
+		return false
+	}
+	inherited, found := r.parent.Commands[cmdName]
+	return found && bytes.Equal(inherited, r.Commands[cmdName])
+}
+
+// Prefixes of the overrides of commands and aliases, fields being named as in files
+const (
+	commandOverride = "commands."
+	aliasOverride   = "aliases."
+)
+
+// Override marks fields, commands and aliases as set by the remote, so that they are stored,
+// even when they have the inherited value or are empty, instead of following later changes of the parent.
+// Fields are named as in files, like room, commands as commands.<name> and aliases as aliases.<alias>.
+// Fields, commands and aliases of remotes loaded from files are marked when resolved.
+func (r *Remote) Override(names ...string) {
+	overrides := make(map[string]bool, len(r.overrides)+len(names))
+	for name := range r.overrides {
+		overrides[name] = true
+	}
+	for _, name := range names {
+		overrides[name] = true
+	}
+	r.overrides = overrides
+}
+
+// Overrides tells whether the field, command or alias is set by the remote, see Override.
+func (r *Remote) Overrides(name string) bool {
+	return r.overrides[name]
+}
+
+// fieldName returns the name of the struct field in files.
+func fieldName(field reflect.StructField) string {
+	return strings.Split(field.Tag.Get("json"), ",")[0]
+}
+
+// inheritable returns the fields of the remote which are inherited, by name.
+func (r *Remote) inheritable() map[string]reflect.Value {
+	out := map[string]reflect.Value{
+		"kind":     reflect.ValueOf(&r.Kind).Elem(),
+		"protocol": reflect.ValueOf(&r.Protocol).Elem(),
+	}
+	metadata := reflect.ValueOf(&r.Metadata).Elem()
+	for idx := 0; idx < metadata.NumField(); idx++ {
+		out[fieldName(metadata.Type().Field(idx))] = metadata.Field(idx)
+	}
+	return out
+}
+
+// InheritedFields lists the names of the fields inherited from the parent, in the order of the struct.
+func InheritedFields() []string {
+	out := []string{"kind", "protocol"}
+	metadata := reflect.TypeOf(Metadata{})
+	for idx := 0; idx < metadata.NumField(); idx++ {
+		out = append(out, fieldName(metadata.Field(idx)))
+	}
+	return out
+}
+
+// overridesSet returns the overrides of the remote as stored, before resolution:
+// every field which is not empty, every command and alias, and the empty fields set explicitly.
+func (r *Remote) overridesSet() map[string]bool {
+	out := make(map[string]bool)
+	for name := range r.overrides {
+		out[name] = true
+	}
+	for name, field := range r.inheritable() {
+		if !isZero(field) {
+			out[name] = true
+		}
+	}
+	for name := range r.Commands {
+		out[commandOverride+name] = true
+	}
+	for alias := range r.Aliases {
+		out[aliasOverride+alias] = true
+	}
+	return out
+}
+
+// emptyOverrides returns the names of the fields set explicitly to an empty value, like broadcast set to false.
+// Those are written to files, unlike other empty fields. Only remotes extending another have some.
+func (r *Remote) emptyOverrides() []string {
+	if r.Extends == "" || len(r.overrides) == 0 {
+		return nil
+	}
+	fields := r.inheritable()
+	out := []string{}
+	for _, name := range InheritedFields() {
+		if r.overrides[name] && isZero(fields[name]) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// Resolve returns the remotes, where remotes extending others hold every inherited field, command and alias.
+// Remotes extend other remotes of the list first, then templates found with find, which may be nil.
+// Fields, commands and aliases of a remote override the inherited ones.
+// Resolved remotes keep track of their parent, so that Stored returns them as they were before resolution.
+func (rl RemoteList) Resolve(find TemplateFinder) (RemoteList, error) {
+	resolved := make(map[*Remote]*Remote)
+	// chain lists the names of the remotes extending r, to detect cycles
+	var resolve func(r *Remote, chain []string) (*Remote, error)
+	resolve = func(r *Remote, chain []string) (*Remote, error) {
+		if out, found := resolved[r]; found {
+			return out, nil
+		}
+		if r.Extends == "" {
+			return r, nil
+		}
+		chain = append(chain, r.Name)
+		for _, name := range chain {
+			if name == r.Extends {
+				return nil, fmt.Errorf("remote %q extends itself, through %s", chain[0], strings.Join(append(chain, r.Extends), " > "))
+			}
+		}
+
+		base := rl.Find(r.Extends)
+		if base == nil && find != nil {
+			base, _ = find(r.Extends)
+		}
+		if base == nil {
+			return nil, fmt.Errorf("remote %q extends %q, which does not exist", r.Name, r.Extends)
+		}
+		parent, err := resolve(base, chain)
+		if err != nil {
+			return nil, err
+		}
+		out := inherit(r, parent)
+		resolved[r] = out
+		return out, nil
+	}
+
+	out := make(RemoteList, len(rl))
+	for idx, r := range rl {
+		resolvedRemote, err := resolve(r, nil)
+		if err != nil {
+			return nil, err
+		}
+		out[idx] = resolvedRemote
+	}
+	return out, nil
+}
+
+// inherit returns a copy of r, holding the fields, commands and aliases of parent it does not override.
+func inherit(r *Remote, parent *Remote) *Remote {
+	out := *r
+	out.parent = parent
+	out.overrides = r.overridesSet()
+	parentFields := parent.inheritable()
+	for name, field := range out.inheritable() {
+		if !out.overrides[name] {
+			field.Set(parentFields[name])
+		}
+	}
+
+	out.Commands = make(map[string]IRCommand, len(parent.Commands)+len(r.Commands))
+	for name, cmd := range parent.Commands {
+		out.Commands[name] = cmd
+	}
+	for name, cmd := range r.Commands {
+		out.Commands[name] = cmd
+	}
+	if len(parent.Aliases)+len(r.Aliases) > 0 {
+		out.Aliases = make(map[string]string, len(parent.Aliases)+len(r.Aliases))
+		for alias, name := range parent.Aliases {
+			out.Aliases[alias] = name
+		}
+		for alias, name := range r.Aliases {
+			out.Aliases[alias] = name
+		}
+	}
+	return &out
+}
+
+func isZero(v reflect.Value) bool {
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+// Stored returns the remote as stored, without the fields, commands and aliases inherited from its parent.
+// Overridden fields, commands and aliases are stored, as well as the inherited ones which were modified.
+func (r *Remote) Stored() *Remote {
+	if r.parent == nil {
+		return r
+	}
+	out := *r
+	out.parent = nil
+	out.overrides = nil
+	parentFields := r.parent.inheritable()
+	for name, field := range out.inheritable() {
+		if r.overrides[name] {
+			if isZero(field) {
+				// Empty values are only stored when overridden explicitly
+				out.Override(name)
+			}
+			continue
+		}
+		if reflect.DeepEqual(field.Interface(), parentFields[name].Interface()) {
+			field.Set(reflect.Zero(field.Type()))
+		} else if isZero(field) {
+			out.Override(name)
+		}
+	}
+
+	out.Commands = make(map[string]IRCommand)
+	for name, cmd := range r.Commands {
+		if !r.Inherited(name) {
+			out.Commands[name] = cmd
+		}
+	}
+	out.Aliases = nil
+	for alias, name := range r.Aliases {
+		if inherited, found := r.parent.Aliases[alias]; found && inherited == name && !r.overrides[aliasOverride+alias] {
+			continue
+		}
+		if out.Aliases == nil {
+			out.Aliases = make(map[string]string)
+		}
+		out.Aliases[alias] = name
+	}
+	return &out
+}
+
+// Stored returns the remotes as stored, see Remote.Stored.
+func (rl RemoteList) Stored() RemoteList {
+	out := make(RemoteList, len(rl))
+	for idx, r := range rl {
+		out[idx] = r.Stored()
+	}
+	return out
+}
+
+// ExtendedBy returns the names of the remotes extending the remote with the given name.
+func (rl RemoteList) ExtendedBy(name string) []string {
+	out := []string{}
+	for _, r := range rl {
+		if r.Extends == name {
+			out = append(out, r.Name)
+		}
+	}
+	return out
+}
+
+// Flattened returns a copy of the remote holding what it inherits, which extends no remote anymore.
+// Commands, aliases and layout are copied, so that the copy can be edited.
+func (r *Remote) Flattened() *Remote {
+	out := *r
+	out.Extends = ""
+	out.parent = nil
+	out.overrides = nil
+	out.Commands = make(map[string]IRCommand, len(r.Commands))
+	for name, cmd := range r.Commands {
+		out.Commands[name] = append(IRCommand(nil), cmd...)
+	}
+	if r.Aliases != nil {
+		out.Aliases = make(map[string]string, len(r.Aliases))
+		for alias, name := range r.Aliases {
+			out.Aliases[alias] = name
+		}
+	}
+	if r.Layout != nil {
+		layout := *r.Layout
+		layout.Groups = append([]Group(nil), r.Layout.Groups...)
+		layout.Buttons = append([]Button(nil), r.Layout.Buttons...)
+		out.Layout = &layout
+	}
+	return &out
+}
+
+// plainRemote is encoded like a Remote, without its empty overrides.
+type plainRemote Remote
+
+// decodedOverrides marks the inherited fields found when decoding, so that empty ones override the inherited value.
+func (r *Remote) decodedOverrides(found func(name string) bool) {
+	names := []string{}
+	for _, name := range InheritedFields() {
+		if found(name) {
+			names = append(names, name)
+		}
+	}
+	if r.Extends != "" && len(names) > 0 {
+		r.Override(names...)
+	}
+}
+
+func (r *Remote) UnmarshalJSON(b []byte) error {
+	p := plainRemote(*r)
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	*r = Remote(p)
+	r.decodedOverrides(func(name string) bool {
+		_, found := keys[name]
+		return found
+	})
+	return nil
+}
+
+// MarshalJSON encodes the remote, along with the fields set explicitly to an empty value.
+func (r Remote) MarshalJSON() ([]byte, error) {
+	raw, err := json.Marshal(plainRemote(r))
+	if err != nil {
+		return nil, err
+	}
+	empty := r.emptyOverrides()
+	if len(empty) == 0 {
+		return raw, nil
+	}
+	fields := r.inheritable()
+	buf := bytes.NewBuffer(raw[:len(raw)-1])
+	for _, name := range empty {
+		value, err := json.Marshal(fields[name].Interface())
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(buf, ",%q:%s", name, value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (r *Remote) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p := plainRemote(*r)
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	keys := map[string]interface{}{}
+	if err := unmarshal(&keys); err != nil {
+		return err
+	}
+	*r = Remote(p)
+	r.decodedOverrides(func(name string) bool {
+		_, found := keys[name]
+		return found
+	})
+	return nil
+}
+
+// MarshalYAML encodes the remote, along with the fields set explicitly to an empty value.
+func (r Remote) MarshalYAML() (interface{}, error) {
+	empty := r.emptyOverrides()
+	if len(empty) == 0 {
+		return plainRemote(r), nil
+	}
+	raw, err := yaml.Marshal(plainRemote(r))
+	if err != nil {
+		return nil, err
+	}
+	out := yaml.MapSlice{}
+	if err := yaml.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	fields := r.inheritable()
+	for _, name := range empty {
+		out = append(out, yaml.MapItem{Key: name, Value: fields[name].Interface()})
+	}
+	return out, nil
+}
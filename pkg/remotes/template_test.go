@@ -0,0 +1,131 @@
+package remotes
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRemoteList_Resolve(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	template := NewRemote("samsung/tv")
+	template.Brand = "Samsung"
+	template.Category = CategoryTV
+	template.Commands["power"] = IRCommand{1}
+	template.Commands["mute"] = IRCommand{2}
+	template.Aliases = map[string]string{"on": "power"}
+	find := func(name string) (*Remote, bool) {
+		if name == template.Name {
+			return template, true
+		}
+		return nil, false
+	}
+
+	living := &Remote{Name: "living-tv", Extends: "samsung/tv", Metadata: Metadata{Room: "living-room"}, Commands: map[string]IRCommand{"mute": {3}}}
+	bedroom := &Remote{Name: "bedroom-tv", Extends: "living-tv", Metadata: Metadata{Room: "bedroom"}, Commands: map[string]IRCommand{"netflix": {4}}}
+	ampli := NewRemote("ampli")
+	rl, err := RemoteList{bedroom, living, ampli}.Resolve(find)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rl.Names()).To(Equal([]string{"bedroom-tv", "living-tv", "ampli"}))
+	g.Expect(rl[2]).To(BeIdenticalTo(ampli))
+
+	// Fields, commands and aliases are inherited, unless overridden
+	r := rl.Find("bedroom-tv")
+	g.Expect(r.Brand).To(Equal("Samsung"))
+	g.Expect(r.Room).To(Equal("bedroom"))
+	g.Expect(r.Commands).To(Equal(map[string]IRCommand{"power": {1}, "mute": {3}, "netflix": {4}}))
+	g.Expect(r.Aliases).To(Equal(map[string]string{"on": "power"}))
+	g.Expect(r.Parent().Name).To(Equal("living-tv"))
+	g.Expect(r.Inherited("power")).To(BeTrue())
+	g.Expect(r.Inherited("netflix")).To(BeFalse())
+	g.Expect(rl.Find("living-tv").Commands["mute"]).To(Equal(IRCommand{3}))
+	g.Expect(RemoteList{bedroom, living}.ExtendedBy("living-tv")).To(Equal([]string{"bedroom-tv"}))
+
+	// Stored remotes only hold what is not inherited
+	r.Commands["power"] = IRCommand{5}
+	r.Commands["input"] = IRCommand{6}
+	stored := rl.Stored()
+	g.Expect(stored[0]).To(Equal(&Remote{
+		Name:     "bedroom-tv",
+		Extends:  "living-tv",
+		Metadata: Metadata{Room: "bedroom"},
+		Commands: map[string]IRCommand{"netflix": {4}, "power": {5}, "input": {6}},
+	}))
+	g.Expect(stored[1]).To(Equal(living))
+	g.Expect(stored[2]).To(BeIdenticalTo(ampli))
+
+	// Flattened copies extend nothing, and are stored whole
+	flat := r.Flattened()
+	g.Expect(flat.Extends).To(BeEmpty())
+	g.Expect(flat.Parent()).To(BeNil())
+	g.Expect(flat.Stored().Commands).To(Equal(r.Commands))
+	flat.Commands["mute"][0] = 7
+	g.Expect(r.Commands["mute"]).To(Equal(IRCommand{3}))
+
+	// Missing and circular parents
+	_, err = RemoteList{&Remote{Name: "tv", Extends: "lg/tv"}}.Resolve(find)
+	g.Expect(err).To(MatchError(`remote "tv" extends "lg/tv", which does not exist`))
+	_, err = RemoteList{&Remote{Name: "a", Extends: "b"}, &Remote{Name: "b", Extends: "a"}}.Resolve(nil)
+	g.Expect(err).To(MatchError(`remote "a" extends itself, through a > b > a`))
+	_, err = RemoteList{&Remote{Name: "a", Extends: "a"}}.Resolve(nil)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestRemote_Overrides(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	base := NewRemote("base")
+	base.Room = "office"
+	base.Broadcast = true
+	base.Commands["power"] = IRCommand{1}
+	base.Commands["mute"] = IRCommand{2}
+
+	// Fields found in files are set by the remote, even when empty or equal to the inherited ones
+	child := &Remote{}
+	g.Expect(json.Unmarshal([]byte(`{"name": "child", "extends": "base", "room": "office", "broadcast": false, "commands": {"power": "01"}}`), child)).To(Succeed())
+	rl, err := RemoteList{base, child}.Resolve(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	r := rl.Find("child")
+	g.Expect(r.Room).To(Equal("office"))
+	g.Expect(r.Broadcast).To(BeFalse())
+	g.Expect(r.Inherited("power")).To(BeFalse())
+	g.Expect(r.Inherited("mute")).To(BeTrue())
+
+	// They are stored, so that later changes of the parent do not apply
+	stored := r.Stored()
+	g.Expect(stored.Room).To(Equal("office"))
+	g.Expect(stored.Commands).To(Equal(map[string]IRCommand{"power": {1}}))
+	base.Room = "hall"
+	rl, err = RemoteList{base, stored}.Resolve(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rl.Find("child").Room).To(Equal("office"))
+	g.Expect(rl.Find("child").Broadcast).To(BeFalse())
+
+	// Empty fields set explicitly are encoded
+	content, err := json.Marshal(stored)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(content)).To(ContainSubstring(`"broadcast":false`))
+	decoded := &Remote{}
+	g.Expect(json.Unmarshal(content, decoded)).To(Succeed())
+	g.Expect(decoded.Overrides("broadcast")).To(BeTrue())
+	content, err = yaml.Marshal(stored)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(content)).To(ContainSubstring("broadcast: false"))
+	decoded = &Remote{}
+	g.Expect(yaml.Unmarshal(content, decoded)).To(Succeed())
+	g.Expect(decoded.Overrides("broadcast")).To(BeTrue())
+	g.Expect(decoded.Room).To(Equal("office"))
+
+	// Fields edited to the inherited value are kept once overridden
+	other := &Remote{Name: "other", Extends: "base", Commands: map[string]IRCommand{}}
+	rl, err = RemoteList{base, other}.Resolve(nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	r = rl.Find("other")
+	g.Expect(r.Stored().Room).To(BeEmpty())
+	r.Override("room", "commands.mute")
+	g.Expect(r.Stored().Room).To(Equal("hall"))
+	g.Expect(r.Stored().Commands).To(Equal(map[string]IRCommand{"mute": {2}}))
+}
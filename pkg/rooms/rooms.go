@@ -0,0 +1,100 @@
+package rooms
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// Room gathers the remotes and devices located in the same room.
+type Room struct {
+	Name    string   `json:"name"`
+	Remotes []string `json:"remotes"`
+	Devices []string `json:"devices"`
+}
+
+// List returns the rooms of the remotes and devices, in name order.
+func List(rl remotes.RemoteList, dl devices.DeviceInfoList) []Room {
+	byName := make(map[string]*Room)
+	room := func(name string) *Room {
+		r, found := byName[name]
+		if !found {
+			r = &Room{Name: name, Remotes: []string{}, Devices: []string{}}
+			byName[name] = r
+		}
+		return r
+	}
+	for _, r := range rl {
+		if r.Room != "" {
+			room(r.Room).Remotes = append(room(r.Room).Remotes, r.Name)
+		}
+	}
+	for _, d := range dl {
+		if d.Room != "" {
+			room(d.Room).Devices = append(room(d.Room).Devices, d.Name)
+		}
+	}
+
+	out := make([]Room, 0, len(byName))
+	for _, r := range byName {
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Find returns the room with the given name.
+func Find(rl remotes.RemoteList, dl devices.DeviceInfoList, name string) (Room, bool) {
+	for _, r := range List(rl, dl) {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Room{}, false
+}
+
+// Targets returns the devices sending the commands of the remote:
+//
+//   - the preferred device of the remote, when set
+//   - every device of the remote room, when broadcasting
+//   - the first available device of the remote room, or its first device when none is available
+//   - the first device of the list, when the remote has no room or its room has no device
+//
+// Available tells whether a device is available, nil when they all are.
+func Targets(r *remotes.Remote, dl devices.DeviceInfoList, available func(name string) bool, broadcast bool) (devices.DeviceInfoList, error) {
+	if r.Device != "" {
+		d, found := dl.Find(devices.ByName(r.Device))
+		if !found {
+			return nil, fmt.Errorf("no such device named %q, preferred by remote %q", r.Device, r.Name)
+		}
+		return devices.DeviceInfoList{d}, nil
+	}
+	if len(dl) == 0 {
+		return nil, fmt.Errorf("no device listed")
+	}
+
+	inRoom := devices.DeviceInfoList{}
+	if r.Room != "" {
+		for _, d := range dl {
+			if d.Room == r.Room {
+				inRoom = append(inRoom, d)
+			}
+		}
+	}
+	if len(inRoom) == 0 {
+		return devices.DeviceInfoList{dl[0]}, nil
+	}
+	if broadcast || r.Broadcast {
+		return inRoom, nil
+	}
+	for _, d := range inRoom {
+		if available == nil || available(d.Name) {
+			return devices.DeviceInfoList{d}, nil
+		}
+	}
+	return devices.DeviceInfoList{inRoom[0]}, nil
+}
@@ -0,0 +1,102 @@
+package rooms
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+func names(dl devices.DeviceInfoList) []string {
+	out := []string{}
+	for _, d := range dl {
+		out = append(out, d.Name)
+	}
+	return out
+}
+
+func TestList(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tv := remotes.NewRemote("tv")
+	tv.Room = "living-room"
+	ampli := remotes.NewRemote("ampli")
+	ampli.Room = "living-room"
+	fan := remotes.NewRemote("fan")
+	fan.Room = "bedroom"
+	rl := remotes.RemoteList{tv, ampli, fan, remotes.NewRemote("other")}
+	dl := devices.DeviceInfoList{
+		{Name: "office"},
+		{Name: "shelf", Room: "living-room"},
+	}
+
+	g.Expect(List(rl, dl)).To(Equal([]Room{
+		{Name: "bedroom", Remotes: []string{"fan"}, Devices: []string{}},
+		{Name: "living-room", Remotes: []string{"tv", "ampli"}, Devices: []string{"shelf"}},
+	}))
+	room, found := Find(rl, dl, "bedroom")
+	g.Expect(found).To(BeTrue())
+	g.Expect(room.Remotes).To(Equal([]string{"fan"}))
+	_, found = Find(rl, dl, "kitchen")
+	g.Expect(found).To(BeFalse())
+}
+
+func TestTargets(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dl := devices.DeviceInfoList{
+		{Name: "office", Room: "office"},
+		{Name: "shelf", Room: "living-room"},
+		{Name: "ceiling", Room: "living-room"},
+	}
+	available := func(name string) bool {
+		return name != "shelf"
+	}
+
+	// Remotes without room use the first device
+	r := remotes.NewRemote("tv")
+	targets, err := Targets(r, dl, available, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(targets)).To(Equal([]string{"office"}))
+
+	// The first available device of the room
+	r.Room = "living-room"
+	targets, err = Targets(r, dl, nil, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(targets)).To(Equal([]string{"shelf"}))
+	targets, err = Targets(r, dl, available, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(targets)).To(Equal([]string{"ceiling"}))
+	targets, err = Targets(r, dl, func(string) bool { return false }, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(targets)).To(Equal([]string{"shelf"}))
+
+	// Every device of the room
+	targets, err = Targets(r, dl, available, true)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(targets)).To(Equal([]string{"shelf", "ceiling"}))
+	r.Broadcast = true
+	targets, err = Targets(r, dl, available, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(targets)).To(Equal([]string{"shelf", "ceiling"}))
+
+	// Rooms without device use the first device
+	r.Room = "kitchen"
+	targets, err = Targets(r, dl, available, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(targets)).To(Equal([]string{"office"}))
+
+	// The preferred device, whatever the room
+	r.Device = "shelf"
+	targets, err = Targets(r, dl, available, true)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(names(targets)).To(Equal([]string{"shelf"}))
+	r.Device = "garage"
+	_, err = Targets(r, dl, available, false)
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = Targets(remotes.NewRemote("tv"), devices.DeviceInfoList{}, nil, false)
+	g.Expect(err).To(HaveOccurred())
+}
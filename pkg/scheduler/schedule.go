@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// Action is an IR command sent when a schedule fires.
+type Action struct {
+	Remote  string `json:"remote"`
+	Command string `json:"command"`
+	// Device is the name of the device used to send the command. Empty means the default device.
+	Device string `json:"device,omitempty"`
+	// Repeat is the number of times the command is sent. Defaults to 1.
+	Repeat int `json:"repeat,omitempty"`
+	// Strict makes the action fail unless every device sending the command succeeds.
+	// By default, the action succeeds when any device succeeds, as devices of a room may not all be in line of sight.
+	Strict bool `json:"strict,omitempty"`
+}
+
+// Schedule fires a sequence of actions, either periodically using a cron expression, or once at a given time.
+type Schedule struct {
+	Name string `json:"name"`
+	// Cron is a standard 5 fields cron expression (or descriptor like @daily), evaluated in local time.
+	Cron string `json:"cron,omitempty"`
+	// At is the time of a one-shot schedule. The schedule is removed once fired.
+	At      *time.Time `json:"at,omitempty"`
+	Actions []Action   `json:"actions"`
+
+	cron cron.Schedule
+	next time.Time
+}
+
+// ScheduleList represents a list of schedules.
+type ScheduleList []*Schedule
+
+// Validate checks the schedule definition and prepares it for use.
+func (s *Schedule) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("schedule name is empty")
+	}
+	if (s.Cron == "") == (s.At == nil) {
+		return fmt.Errorf("schedule %q must have exactly one of cron or at", s.Name)
+	}
+	if s.Cron != "" {
+		c, err := cron.ParseStandard(s.Cron)
+		if err != nil {
+			return fmt.Errorf("schedule %q has invalid cron expression %q, %s", s.Name, s.Cron, err)
+		}
+		s.cron = c
+	}
+	if len(s.Actions) == 0 {
+		return fmt.Errorf("schedule %q has no action", s.Name)
+	}
+	for idx, a := range s.Actions {
+		if a.Remote == "" || a.Command == "" {
+			return fmt.Errorf("schedule %q action #%d must have a remote and a command", s.Name, idx)
+		}
+		if a.Repeat < 0 {
+			return fmt.Errorf("schedule %q action #%d has negative repeat count", s.Name, idx)
+		}
+	}
+	return nil
+}
+
+// nextAfter returns the time the schedule fires next, after the given time.
+// One-shot schedules return their time, even when it is in the past.
+func (s *Schedule) nextAfter(t time.Time) time.Time {
+	if s.At != nil {
+		return *s.At
+	}
+	return s.cron.Next(t)
+}
+
+// Find returns the schedule with the given name, or nil.
+func (sl ScheduleList) Find(name string) *Schedule {
+	for _, s := range sl {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxExecutions is the number of executions kept in the log.
+const maxExecutions = 100
+
+// Sender sends the IR command described by the action.
+type Sender func(a Action) error
+
+// Persister saves the schedule list whenever it changes.
+type Persister func(sl ScheduleList) error
+
+// Execution records the result of an action fired by a schedule.
+type Execution struct {
+	Schedule string    `json:"schedule"`
+	Time     time.Time `json:"time"`
+	Action   Action    `json:"action"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	// Missed is set when the action was not sent, as its one-shot schedule time passed while the scheduler was not running.
+	Missed bool `json:"missed,omitempty"`
+}
+
+// Status describes a schedule along with its next firing time.
+type Status struct {
+	*Schedule
+	Next time.Time `json:"next"`
+}
+
+// Scheduler fires schedules in the background.
+type Scheduler struct {
+	mutex      sync.Mutex
+	schedules  ScheduleList
+	executions []Execution
+	send       Sender
+	persist    Persister
+	wake       chan struct{}
+}
+
+// New creates a scheduler for the given schedules. One-shot schedules whose time has passed are discarded,
+// recording their actions as missed executions, then the schedule list is persisted.
+func New(schedules ScheduleList, send Sender, persist Persister) (*Scheduler, error) {
+	s := &Scheduler{
+		send:    send,
+		persist: persist,
+		wake:    make(chan struct{}, 1),
+	}
+	now := time.Now()
+	for _, sch := range schedules {
+		if err := sch.Validate(); err != nil {
+			return nil, err
+		}
+		if s.schedules.Find(sch.Name) != nil {
+			return nil, fmt.Errorf("duplicate schedule name %q", sch.Name)
+		}
+		if sch.At != nil && sch.At.Before(now) {
+			log.WithFields(log.Fields{
+				"schedule": sch.Name,
+				"at":       *sch.At,
+			}).Warn("One-shot schedule time has passed. Discarding.")
+			s.missed(sch)
+			continue
+		}
+		sch.next = sch.nextAfter(now)
+		s.schedules = append(s.schedules, sch)
+	}
+	if len(s.executions) > 0 {
+		if err := s.persist(s.schedules); err != nil {
+			log.WithError(err).Error("Failed to save schedules")
+		}
+	}
+	return s, nil
+}
+
+// missed records the actions of the one-shot schedule as missed executions, at the schedule time.
+func (s *Scheduler) missed(sch *Schedule) {
+	for _, a := range sch.Actions {
+		if a.Repeat == 0 {
+			a.Repeat = 1
+		}
+		s.record(Execution{
+			Schedule: sch.Name,
+			Time:     *sch.At,
+			Action:   a,
+			Error:    "missed, the scheduler was not running at the schedule time",
+			Missed:   true,
+		})
+	}
+}
+
+// Schedules returns the status of every schedule.
+func (s *Scheduler) Schedules() []Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	out := make([]Status, len(s.schedules))
+	for idx, sch := range s.schedules {
+		out[idx] = Status{Schedule: sch, Next: sch.next}
+	}
+	return out
+}
+
+// Executions returns the recent executions, most recent first.
+func (s *Scheduler) Executions() []Execution {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	out := make([]Execution, len(s.executions))
+	for idx, e := range s.executions {
+		out[len(out)-idx-1] = e
+	}
+	return out
+}
+
+// Add validates and registers a new schedule, then persists the schedule list.
+func (s *Scheduler) Add(sch *Schedule) error {
+	if err := sch.Validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if sch.At != nil && sch.At.Before(now) {
+		return fmt.Errorf("schedule %q time is in the past", sch.Name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.schedules.Find(sch.Name) != nil {
+		return fmt.Errorf("schedule %q already exists", sch.Name)
+	}
+	sch.next = sch.nextAfter(now)
+	s.schedules = append(s.schedules, sch)
+	if err := s.persist(s.schedules); err != nil {
+		s.schedules = s.schedules[:len(s.schedules)-1]
+		return fmt.Errorf("failed to save schedules, %s", err)
+	}
+	s.notify()
+	return nil
+}
+
+// Remove deletes the schedule with the given name, then persists the schedule list.
+// It returns false when no such schedule exists. The schedule is kept when the list cannot be saved.
+func (s *Scheduler) Remove(name string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := s.schedules
+	if !s.remove(name) {
+		return false, nil
+	}
+	if err := s.persist(s.schedules); err != nil {
+		s.schedules = previous
+		return true, fmt.Errorf("failed to save schedules, %s", err)
+	}
+	s.notify()
+	return true, nil
+}
+
+// remove deletes the schedule with the given name, leaving the previous list untouched.
+func (s *Scheduler) remove(name string) bool {
+	for idx, sch := range s.schedules {
+		if sch.Name == name {
+			remaining := make(ScheduleList, 0, len(s.schedules)-1)
+			remaining = append(remaining, s.schedules[:idx]...)
+			s.schedules = append(remaining, s.schedules[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextWakeUp returns the earliest time a schedule fires. Returns false when there is nothing scheduled.
+func (s *Scheduler) nextWakeUp() (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var next time.Time
+	for _, sch := range s.schedules {
+		if next.IsZero() || sch.next.Before(next) {
+			next = sch.next
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Run fires the schedules until the stop channel is closed.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	for {
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if next, ok := s.nextWakeUp(); ok {
+			timer = time.NewTimer(time.Until(next))
+			timeout = timer.C
+		}
+
+		select {
+		case <-stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-s.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+		case now := <-timeout:
+			s.fire(now)
+		}
+	}
+}
+
+// fire runs every schedule due at the given time, in order.
+func (s *Scheduler) fire(now time.Time) {
+	s.mutex.Lock()
+	due := ScheduleList{}
+	oneShot := false
+	for _, sch := range s.schedules {
+		if sch.next.After(now) {
+			continue
+		}
+		due = append(due, sch)
+		if sch.At != nil {
+			oneShot = true
+			continue
+		}
+		sch.next = sch.nextAfter(now)
+	}
+	if oneShot {
+		for _, sch := range due {
+			if sch.At != nil {
+				s.remove(sch.Name)
+			}
+		}
+		if err := s.persist(s.schedules); err != nil {
+			log.WithError(err).Error("Failed to save schedules")
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, sch := range due {
+		for _, a := range sch.Actions {
+			s.execute(sch.Name, a)
+		}
+	}
+}
+
+func (s *Scheduler) execute(name string, a Action) {
+	if a.Repeat == 0 {
+		a.Repeat = 1
+	}
+	e := Execution{
+		Schedule: name,
+		Time:     time.Now(),
+		Action:   a,
+		Success:  true,
+	}
+	logger := log.WithFields(log.Fields{
+		"schedule": name,
+		"remote":   a.Remote,
+		"command":  a.Command,
+		"device":   a.Device,
+	})
+	if err := s.send(a); err != nil {
+		e.Success = false
+		e.Error = err.Error()
+		logger.WithError(err).Error("Scheduled command failed")
+	} else {
+		logger.Info("Scheduled command sent")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.record(e)
+}
+
+// record appends the execution to the log, dropping the oldest ones. The mutex must be held, unless the scheduler is being created.
+func (s *Scheduler) record(e Execution) {
+	s.executions = append(s.executions, e)
+	if len(s.executions) > maxExecutions {
+		s.executions = s.executions[len(s.executions)-maxExecutions:]
+	}
+}
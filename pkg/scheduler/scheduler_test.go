@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSchedule_Validate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	at := time.Now()
+	actions := []Action{{Remote: "tv", Command: "power"}}
+
+	g.Expect((&Schedule{Name: "ok", Cron: "30 7 * * 1-5", Actions: actions}).Validate()).To(Succeed())
+	g.Expect((&Schedule{Name: "ok", At: &at, Actions: actions}).Validate()).To(Succeed())
+
+	g.Expect((&Schedule{Cron: "@daily", Actions: actions}).Validate()).To(HaveOccurred())
+	g.Expect((&Schedule{Name: "both", Cron: "@daily", At: &at, Actions: actions}).Validate()).To(HaveOccurred())
+	g.Expect((&Schedule{Name: "none", Actions: actions}).Validate()).To(HaveOccurred())
+	g.Expect((&Schedule{Name: "bad", Cron: "61 * * * *", Actions: actions}).Validate()).To(HaveOccurred())
+	g.Expect((&Schedule{Name: "empty", Cron: "@daily"}).Validate()).To(HaveOccurred())
+	g.Expect((&Schedule{Name: "partial", Cron: "@daily", Actions: []Action{{Remote: "tv"}}}).Validate()).To(HaveOccurred())
+}
+
+func TestScheduler_Fire(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	sent := []Action{}
+	send := func(a Action) error {
+		sent = append(sent, a)
+		if a.Command == "broken" {
+			return fmt.Errorf("send failure")
+		}
+		return nil
+	}
+	saved := ScheduleList{}
+	persist := func(sl ScheduleList) error {
+		saved = append(ScheduleList{}, sl...)
+		return nil
+	}
+
+	past := time.Now().Add(-time.Hour)
+	s, err := New(ScheduleList{
+		{Name: "expired", At: &past, Actions: []Action{{Remote: "tv", Command: "power"}}},
+		{Name: "hourly", Cron: "@hourly", Actions: []Action{{Remote: "tv", Command: "power"}}},
+	}, send, persist)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(s.Schedules()).To(HaveLen(1))
+	// Passed one-shot schedules are recorded as missed, and removed from the saved list
+	g.Expect(s.Executions()).To(Equal([]Execution{{
+		Schedule: "expired",
+		Time:     past,
+		Action:   Action{Remote: "tv", Command: "power", Repeat: 1},
+		Error:    "missed, the scheduler was not running at the schedule time",
+		Missed:   true,
+	}}))
+	g.Expect(saved).To(HaveLen(1))
+	g.Expect(saved[0].Name).To(Equal("hourly"))
+
+	at := time.Now().Add(time.Minute)
+	g.Expect(s.Add(&Schedule{Name: "once", At: &at, Actions: []Action{{Remote: "tv", Command: "broken", Repeat: 2}}})).To(Succeed())
+	g.Expect(s.Add(&Schedule{Name: "once", At: &at, Actions: []Action{{Remote: "tv", Command: "power"}}})).To(HaveOccurred())
+	g.Expect(saved).To(HaveLen(2))
+
+	// Only the one-shot schedule is due
+	s.fire(at)
+	g.Expect(sent).To(Equal([]Action{{Remote: "tv", Command: "broken", Repeat: 2}}))
+	g.Expect(saved).To(HaveLen(1))
+	g.Expect(saved[0].Name).To(Equal("hourly"))
+
+	// Cron schedule fires and is rescheduled
+	next := s.Schedules()[0].Next
+	s.fire(next)
+	g.Expect(sent).To(HaveLen(2))
+	g.Expect(s.Schedules()[0].Next).To(Equal(next.Add(time.Hour)))
+
+	executions := s.Executions()
+	g.Expect(executions).To(HaveLen(3))
+	g.Expect(executions[0].Schedule).To(Equal("hourly"))
+	g.Expect(executions[0].Action.Repeat).To(Equal(1))
+	g.Expect(executions[0].Success).To(BeTrue())
+	g.Expect(executions[1].Schedule).To(Equal("once"))
+	g.Expect(executions[1].Success).To(BeFalse())
+	g.Expect(executions[1].Error).To(Equal("send failure"))
+
+	found, err := s.Remove("hourly")
+	g.Expect(found).To(BeTrue())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(saved).To(BeEmpty())
+
+	found, _ = s.Remove("hourly")
+	g.Expect(found).To(BeFalse())
+}
+
+func TestScheduler_PersistFailure(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	send := func(a Action) error { return nil }
+	broken := false
+	persist := func(sl ScheduleList) error {
+		if broken {
+			return fmt.Errorf("disk full")
+		}
+		return nil
+	}
+	s, err := New(ScheduleList{
+		{Name: "morning", Cron: "0 7 * * *", Actions: []Action{{Remote: "tv", Command: "power"}}},
+		{Name: "evening", Cron: "0 19 * * *", Actions: []Action{{Remote: "tv", Command: "power"}}},
+	}, send, persist)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Schedules are kept in memory as they are on disk
+	broken = true
+	found, err := s.Remove("morning")
+	g.Expect(found).To(BeTrue())
+	g.Expect(err).To(HaveOccurred())
+	at := time.Now().Add(time.Hour)
+	g.Expect(s.Add(&Schedule{Name: "once", At: &at, Actions: []Action{{Remote: "tv", Command: "power"}}})).ToNot(Succeed())
+	names := []string{}
+	for _, st := range s.Schedules() {
+		names = append(names, st.Name)
+	}
+	g.Expect(names).To(Equal([]string{"morning", "evening"}))
+
+	broken = false
+	found, err = s.Remove("morning")
+	g.Expect(found).To(BeTrue())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(s.Schedules()).To(HaveLen(1))
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+const (
+	dirRemotes   = "remotes"
+	dirDevices   = "devices.json"
+	dirLock      = "ir-remotes"
+	dirRemoteExt = ".json"
+)
+
+// DirStore keeps every remote in its own JSON file, named after the remote, so that changes are easy to review with git:
+//
+//	<dir>/devices.json
+//	<dir>/remotes/<remote>.json
+//
+// Remote files hold the remote fields, alongside the schema version.
+// Remotes are loaded in name order. Files are not backed up, since history is expected to be kept by version control.
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates a store in dir, created when saving.
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+func (s *DirStore) remoteFile(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("remote name %q cannot be used as file name", name)
+	}
+	return filepath.Join(s.dir, dirRemotes, name+dirRemoteExt), nil
+}
+
+// loadRemotes returns the remotes as stored, and the oldest version of their files.
+func (s *DirStore) loadRemotes() ([]remoteDocument, int, error) {
+	docs := []remoteDocument{}
+	oldest := SchemaVersion
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, dirRemotes))
+	if os.IsNotExist(err) {
+		return docs, oldest, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	// Files are sorted by name
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || filepath.Ext(f.Name()) != dirRemoteExt {
+			continue
+		}
+		doc := remoteDocument{Remote: &remotes.Remote{}}
+		filename := filepath.Join(s.dir, dirRemotes, f.Name())
+		if err := utils.LoadFromFile(&doc, filename); err != nil {
+			return nil, 0, decodeProblems(filename, err)
+		}
+		doc.file = filename
+		if expected := strings.TrimSuffix(f.Name(), dirRemoteExt); doc.Name != expected {
+			return nil, 0, ValidationError{{File: filename, Path: "name", Remote: doc.Name, Message: fmt.Sprintf("remote name does not match the file name, expected %q", expected)}}
+		}
+		doc.Version = storedVersion(doc.Version)
+		if doc.Version < oldest {
+			oldest = doc.Version
+		}
+		docs = append(docs, doc)
+	}
+	return docs, oldest, nil
+}
+
+func (s *DirStore) LoadRemotes() (remotes.RemoteList, error) {
+	docs, _, err := s.loadRemotes()
+	if err != nil {
+		return nil, err
+	}
+	rl := remotes.RemoteList{}
+	for _, doc := range docs {
+		if err := upgradeRemotes(doc.Version, remotes.RemoteList{doc.Remote}); err != nil {
+			return nil, fmt.Errorf("remote %q: %s", doc.Name, err)
+		}
+		rl = append(rl, doc.Remote)
+	}
+	locate := func(index int) (string, string) {
+		return docs[index].file, ""
+	}
+	if err := ValidateRemotes(rl, locate).orNil(); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+// SaveRemotes saves every remote, then removes files of remotes that are not listed anymore.
+func (s *DirStore) SaveRemotes(rl remotes.RemoteList) error {
+	listed := make(map[string]bool)
+	for _, r := range rl {
+		filename, err := s.remoteFile(r.Name)
+		if err != nil {
+			return err
+		}
+		listed[filename] = true
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, dirRemotes), 0755); err != nil {
+		return err
+	}
+	for _, r := range rl {
+		filename, _ := s.remoteFile(r.Name)
+		if err := utils.SaveToFileAtomic(&remoteDocument{Version: SchemaVersion, Remote: r}, filename); err != nil {
+			return err
+		}
+	}
+
+	existing, err := filepath.Glob(filepath.Join(s.dir, dirRemotes, "*"+dirRemoteExt))
+	if err != nil {
+		return err
+	}
+	for _, filename := range existing {
+		if !listed[filename] {
+			if err := os.Remove(filename); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *DirStore) loadDevices() (*devicesDocument, error) {
+	doc := &devicesDocument{Version: SchemaVersion, Devices: devices.DeviceInfoList{}}
+	filename := filepath.Join(s.dir, dirDevices)
+	err := utils.LoadFromFile(doc, filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, decodeProblems(filename, err)
+	}
+	doc.Version = storedVersion(doc.Version)
+	return doc, nil
+}
+
+func (s *DirStore) LoadDevices() (devices.DeviceInfoList, error) {
+	doc, err := s.loadDevices()
+	if err != nil {
+		return nil, err
+	}
+	if err := upgradeDevices(doc.Version, doc.Devices); err != nil {
+		return nil, err
+	}
+	locate := listLocator(filepath.Join(s.dir, dirDevices), documentKey(doc.Version, "devices"))
+	if err := ValidateDevices(doc.Devices, locate).orNil(); err != nil {
+		return nil, err
+	}
+	return doc.Devices, nil
+}
+
+func (s *DirStore) SaveDevices(dl devices.DeviceInfoList) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	return utils.SaveToFileAtomic(&devicesDocument{Version: SchemaVersion, Devices: dl}, filepath.Join(s.dir, dirDevices))
+}
+
+// SchemaVersion returns the oldest version of the remote and devices files.
+func (s *DirStore) SchemaVersion() (int, error) {
+	_, oldest, err := s.loadRemotes()
+	if err != nil {
+		return 0, err
+	}
+	doc, err := s.loadDevices()
+	if err != nil {
+		return 0, err
+	}
+	if doc.Version < oldest {
+		oldest = doc.Version
+	}
+	return oldest, nil
+}
+
+func (s *DirStore) Lock(timeout time.Duration) (Unlocker, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	return utils.LockFile(filepath.Join(s.dir, dirLock), timeout)
+}
+
+// ModTime returns the latest modification time of the files, and of the remotes directory, modified when files are added or removed.
+func (s *DirStore) ModTime() (time.Time, error) {
+	files := []string{filepath.Join(s.dir, dirRemotes), filepath.Join(s.dir, dirDevices)}
+	infos, err := ioutil.ReadDir(filepath.Join(s.dir, dirRemotes))
+	if err != nil && !os.IsNotExist(err) {
+		return time.Time{}, err
+	}
+	for _, info := range infos {
+		files = append(files, filepath.Join(s.dir, dirRemotes, info.Name()))
+	}
+	return latestModTime(files...)
+}
+
+func (s *DirStore) Close() error {
+	return nil
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+// JSONStore keeps remotes and devices in two JSON files.
+type JSONStore struct {
+	RemotesFile string
+	DevicesFile string
+	// Defaults, when set, holds the files loaded when missing on disk, like the ones embedded in the binary.
+	// They are found by base name, and files are always saved on disk.
+	Defaults http.FileSystem
+}
+
+// NewJSONStore creates a store using the given files.
+func NewJSONStore(remotesFile string, devicesFile string) *JSONStore {
+	return &JSONStore{
+		RemotesFile: remotesFile,
+		DevicesFile: devicesFile,
+	}
+}
+
+// load loads obj from the file saved, or from the defaults when the file was never saved.
+func (s *JSONStore) load(obj interface{}, filename string) error {
+	err := utils.LoadFromFile(obj, filename)
+	if os.IsNotExist(err) && s.Defaults != nil {
+		err = utils.LoadFromFilesystem(obj, s.Defaults, filepath.Base(filename))
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *JSONStore) loadRemotes() (*remotesDocument, error) {
+	doc := &remotesDocument{Version: SchemaVersion, Remotes: remotes.RemoteList{}}
+	if err := s.load(doc, s.RemotesFile); err != nil {
+		return nil, decodeProblems(s.RemotesFile, err)
+	}
+	doc.Version = storedVersion(doc.Version)
+	return doc, nil
+}
+
+func (s *JSONStore) LoadRemotes() (remotes.RemoteList, error) {
+	doc, err := s.loadRemotes()
+	if err != nil {
+		return nil, err
+	}
+	if err := upgradeRemotes(doc.Version, doc.Remotes); err != nil {
+		return nil, err
+	}
+	if err := ValidateRemotes(doc.Remotes, listLocator(s.RemotesFile, documentKey(doc.Version, "remotes"))).orNil(); err != nil {
+		return nil, err
+	}
+	return doc.Remotes, nil
+}
+
+func (s *JSONStore) SaveRemotes(rl remotes.RemoteList) error {
+	return utils.SaveToFile(&remotesDocument{Version: SchemaVersion, Remotes: rl}, s.RemotesFile)
+}
+
+func (s *JSONStore) loadDevices() (*devicesDocument, error) {
+	doc := &devicesDocument{Version: SchemaVersion, Devices: devices.DeviceInfoList{}}
+	if err := s.load(doc, s.DevicesFile); err != nil {
+		return nil, decodeProblems(s.DevicesFile, err)
+	}
+	doc.Version = storedVersion(doc.Version)
+	return doc, nil
+}
+
+func (s *JSONStore) LoadDevices() (devices.DeviceInfoList, error) {
+	doc, err := s.loadDevices()
+	if err != nil {
+		return nil, err
+	}
+	if err := upgradeDevices(doc.Version, doc.Devices); err != nil {
+		return nil, err
+	}
+	if err := ValidateDevices(doc.Devices, listLocator(s.DevicesFile, documentKey(doc.Version, "devices"))).orNil(); err != nil {
+		return nil, err
+	}
+	return doc.Devices, nil
+}
+
+func (s *JSONStore) SaveDevices(dl devices.DeviceInfoList) error {
+	return utils.SaveToFile(&devicesDocument{Version: SchemaVersion, Devices: dl}, s.DevicesFile)
+}
+
+// SchemaVersion returns the oldest version of both files.
+func (s *JSONStore) SchemaVersion() (int, error) {
+	remotesDoc, err := s.loadRemotes()
+	if err != nil {
+		return 0, err
+	}
+	devicesDoc, err := s.loadDevices()
+	if err != nil {
+		return 0, err
+	}
+	if remotesDoc.Version < devicesDoc.Version {
+		return remotesDoc.Version, nil
+	}
+	return devicesDoc.Version, nil
+}
+
+// Lock takes the lock of both files, always in the same order.
+func (s *JSONStore) Lock(timeout time.Duration) (Unlocker, error) {
+	deadline := time.Now().Add(timeout)
+	remotesLock, err := utils.LockFile(s.RemotesFile, timeout)
+	if err != nil {
+		return nil, err
+	}
+	devicesLock, err := utils.LockFile(s.DevicesFile, time.Until(deadline))
+	if err != nil {
+		remotesLock.Unlock()
+		return nil, err
+	}
+	return locks{devicesLock, remotesLock}, nil
+}
+
+// ModTime returns the latest modification time of the files, zero when only the defaults exist.
+func (s *JSONStore) ModTime() (time.Time, error) {
+	return latestModTime(s.RemotesFile, s.DevicesFile)
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// locks releases several locks, in order.
+type locks []Unlocker
+
+func (ls locks) Unlock() error {
+	var firstErr error
+	for _, l := range ls {
+		if err := l.Unlock(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
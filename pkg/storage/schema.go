@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// SchemaVersion is the version of stored remotes and devices written by this version of ir-remotes.
+// Content written with older versions is upgraded in memory when loaded, then in storage when saved.
+const SchemaVersion = 2
+
+// legacyVersion is the version of content stored without version, like bare JSON lists.
+const legacyVersion = 1
+
+// Migration upgrades remotes and devices from Version to Version+1, once loaded.
+type Migration struct {
+	Version     int
+	Description string
+	// Remotes and Devices upgrade the loaded lists in place, when set.
+	Remotes func(rl remotes.RemoteList) error
+	Devices func(dl devices.DeviceInfoList) error
+}
+
+// Migrations is the chain of migrations up to SchemaVersion, in order.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Store remotes and devices in documents holding the schema version, instead of bare lists",
+	},
+}
+
+// PendingMigrations returns the migrations needed to upgrade content from version to SchemaVersion.
+func PendingMigrations(version int) ([]Migration, error) {
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("schema version %d was written by a newer version of ir-remotes, which supports up to version %d", version, SchemaVersion)
+	}
+	pending := []Migration{}
+	for _, m := range Migrations {
+		if m.Version >= version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func upgradeRemotes(version int, rl remotes.RemoteList) error {
+	pending, err := PendingMigrations(version)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		if m.Remotes == nil {
+			continue
+		}
+		if err := m.Remotes(rl); err != nil {
+			return fmt.Errorf("failed to upgrade remotes from schema version %d, %s", m.Version, err)
+		}
+	}
+	return nil
+}
+
+func upgradeDevices(version int, dl devices.DeviceInfoList) error {
+	pending, err := PendingMigrations(version)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		if m.Devices == nil {
+			continue
+		}
+		if err := m.Devices(dl); err != nil {
+			return fmt.Errorf("failed to upgrade devices from schema version %d, %s", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// storedVersion returns the version of stored content, legacy when missing.
+func storedVersion(version int) int {
+	if version == 0 {
+		return legacyVersion
+	}
+	return version
+}
+
+// documentKey returns the key of the list in a document of the given version, empty for legacy bare lists.
+func documentKey(version int, key string) string {
+	if version == legacyVersion {
+		return ""
+	}
+	return key
+}
+
+// isJSONList tells whether b is a JSON list, as stored before versioning.
+func isJSONList(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && b[0] == '['
+}
+
+// isYAMLList tells whether the YAML node is a list, as stored before versioning.
+func isYAMLList(unmarshal func(interface{}) error) bool {
+	var node interface{}
+	if err := unmarshal(&node); err != nil {
+		return false
+	}
+	_, ok := node.([]interface{})
+	return ok
+}
+
+// remotesDocument holds the remotes, in JSON, YAML and TOML files.
+// Bare lists are loaded as legacy version.
+type remotesDocument struct {
+	Version int                `json:"version" yaml:"version"`
+	Remotes remotes.RemoteList `json:"remotes" yaml:"remotes"`
+}
+
+// plainRemotesDocument is decoded without the legacy format detection
+type plainRemotesDocument remotesDocument
+
+func (d *remotesDocument) UnmarshalJSON(b []byte) error {
+	if isJSONList(b) {
+		d.Version = legacyVersion
+		return json.Unmarshal(b, &d.Remotes)
+	}
+	return json.Unmarshal(b, (*plainRemotesDocument)(d))
+}
+
+func (d *remotesDocument) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if isYAMLList(unmarshal) {
+		d.Version = legacyVersion
+		return unmarshal(&d.Remotes)
+	}
+	return unmarshal((*plainRemotesDocument)(d))
+}
+
+// devicesDocument holds the devices, in JSON, YAML and TOML files.
+// Bare lists are loaded as legacy version.
+type devicesDocument struct {
+	Version int                    `json:"version" yaml:"version"`
+	Devices devices.DeviceInfoList `json:"devices" yaml:"devices"`
+}
+
+// plainDevicesDocument is decoded without the legacy format detection
+type plainDevicesDocument devicesDocument
+
+func (d *devicesDocument) UnmarshalJSON(b []byte) error {
+	if isJSONList(b) {
+		d.Version = legacyVersion
+		return json.Unmarshal(b, &d.Devices)
+	}
+	return json.Unmarshal(b, (*plainDevicesDocument)(d))
+}
+
+func (d *devicesDocument) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if isYAMLList(unmarshal) {
+		d.Version = legacyVersion
+		return unmarshal(&d.Devices)
+	}
+	return unmarshal((*plainDevicesDocument)(d))
+}
+
+// remoteDocument holds a single remote, with its fields alongside the version.
+type remoteDocument struct {
+	Version         int `json:"version" yaml:"version"`
+	*remotes.Remote `yaml:"-"`
+	// file is where the remote was loaded from, when stored in its own file
+	file string
+}
+
+// documentVersion decodes the version of a document holding the fields of an object alongside.
+type documentVersion struct {
+	Version int `json:"version" yaml:"version"`
+}
+
+// MarshalJSON encodes the version, then the fields of the remote which has its own encoding.
+func (d remoteDocument) MarshalJSON() ([]byte, error) {
+	raw, err := json.Marshal(d.Remote)
+	if err != nil {
+		return nil, err
+	}
+	out := []byte(fmt.Sprintf(`{"version":%d`, d.Version))
+	if len(raw) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, raw[1:]...), nil
+}
+
+func (d *remoteDocument) UnmarshalJSON(b []byte) error {
+	v := documentVersion{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if d.Remote == nil {
+		d.Remote = &remotes.Remote{}
+	}
+	d.Version = v.Version
+	return json.Unmarshal(b, d.Remote)
+}
+
+// MarshalYAML encodes the version, then the fields of the remote which has its own encoding.
+func (d remoteDocument) MarshalYAML() (interface{}, error) {
+	raw, err := yaml.Marshal(d.Remote)
+	if err != nil {
+		return nil, err
+	}
+	fields := yaml.MapSlice{}
+	if err := yaml.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return append(yaml.MapSlice{{Key: "version", Value: d.Version}}, fields...), nil
+}
+
+func (d *remoteDocument) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	v := documentVersion{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	if d.Remote == nil {
+		d.Remote = &remotes.Remote{}
+	}
+	d.Version = v.Version
+	return unmarshal(d.Remote)
+}
+
+// deviceDocument holds a single device, with its fields alongside the version, in JSON only, like SQLite rows.
+// YAML cannot inline pointers, and DeviceInfo holds locks, which must not be copied in a value field.
+type deviceDocument struct {
+	Version             int `json:"version"`
+	*devices.DeviceInfo `yaml:"-"`
+}
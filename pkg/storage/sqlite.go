@@ -0,0 +1,220 @@
+// +build sqlite
+
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	// Registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+// Every row holds a remote or device as JSON, with the schema version. Position keeps the list order
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS remotes (name TEXT PRIMARY KEY, position INTEGER NOT NULL, data TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS devices (name TEXT PRIMARY KEY, position INTEGER NOT NULL, data TEXT NOT NULL);
+`
+
+// SQLiteStore keeps remotes and devices in a single SQLite database.
+type SQLiteStore struct {
+	path string
+	db   *sql.DB
+}
+
+// OpenSQLite opens the database at path, created when missing.
+func OpenSQLite(path string) (Store, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create SQLite schema, %s", err)
+	}
+	return &SQLiteStore{path: path, db: db}, nil
+}
+
+// load decodes every row of table, in list order.
+// Rows which cannot be decoded are reported as problems, located by their position.
+func (s *SQLiteStore) load(table string, decode func(data []byte) error) error {
+	rows, err := s.db.Query("SELECT name, data FROM " + table + " ORDER BY position")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	problems := ValidationError{}
+	for idx := 0; rows.Next(); idx++ {
+		var name string
+		var data []byte
+		if err := rows.Scan(&name, &data); err != nil {
+			return err
+		}
+		if err := decode(data); err != nil {
+			problems = append(problems, Problem{File: s.path, Path: fmt.Sprintf("%s[%d]", table, idx), Message: fmt.Sprintf("row %q, %s", name, err)})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return problems.orNil()
+}
+
+// save replaces the content of table, in a single transaction.
+func (s *SQLiteStore) save(table string, names []string, objs []interface{}) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for idx, obj := range objs {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO "+table+" (name, position, data) VALUES (?, ?, ?)", names[idx], idx, string(data)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to save %q, %s", names[idx], err)
+		}
+	}
+	return tx.Commit()
+}
+
+// loadRemotes returns the remotes as stored, and the oldest version of the rows.
+func (s *SQLiteStore) loadRemotes() ([]remoteDocument, int, error) {
+	docs := []remoteDocument{}
+	oldest := SchemaVersion
+	err := s.load("remotes", func(data []byte) error {
+		doc := remoteDocument{Remote: &remotes.Remote{}}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		doc.Version = storedVersion(doc.Version)
+		if doc.Version < oldest {
+			oldest = doc.Version
+		}
+		docs = append(docs, doc)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return docs, oldest, nil
+}
+
+func (s *SQLiteStore) LoadRemotes() (remotes.RemoteList, error) {
+	docs, _, err := s.loadRemotes()
+	if err != nil {
+		return nil, err
+	}
+	rl := remotes.RemoteList{}
+	for _, doc := range docs {
+		if err := upgradeRemotes(doc.Version, remotes.RemoteList{doc.Remote}); err != nil {
+			return nil, fmt.Errorf("remote %q: %s", doc.Name, err)
+		}
+		rl = append(rl, doc.Remote)
+	}
+	if err := ValidateRemotes(rl, listLocator(s.path, "remotes")).orNil(); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+func (s *SQLiteStore) SaveRemotes(rl remotes.RemoteList) error {
+	names := make([]string, len(rl))
+	objs := make([]interface{}, len(rl))
+	for idx, r := range rl {
+		names[idx] = r.Name
+		objs[idx] = remoteDocument{Version: SchemaVersion, Remote: r}
+	}
+	return s.save("remotes", names, objs)
+}
+
+// loadDevices returns the devices as stored, and the oldest version of the rows.
+func (s *SQLiteStore) loadDevices() ([]deviceDocument, int, error) {
+	docs := []deviceDocument{}
+	oldest := SchemaVersion
+	err := s.load("devices", func(data []byte) error {
+		doc := deviceDocument{DeviceInfo: &devices.DeviceInfo{}}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		doc.Version = storedVersion(doc.Version)
+		if doc.Version < oldest {
+			oldest = doc.Version
+		}
+		docs = append(docs, doc)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return docs, oldest, nil
+}
+
+func (s *SQLiteStore) LoadDevices() (devices.DeviceInfoList, error) {
+	docs, _, err := s.loadDevices()
+	if err != nil {
+		return nil, err
+	}
+	dl := devices.DeviceInfoList{}
+	for _, doc := range docs {
+		if err := upgradeDevices(doc.Version, devices.DeviceInfoList{doc.DeviceInfo}); err != nil {
+			return nil, fmt.Errorf("device %q: %s", doc.Name, err)
+		}
+		dl = append(dl, doc.DeviceInfo)
+	}
+	if err := ValidateDevices(dl, listLocator(s.path, "devices")).orNil(); err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+func (s *SQLiteStore) SaveDevices(dl devices.DeviceInfoList) error {
+	names := make([]string, len(dl))
+	objs := make([]interface{}, len(dl))
+	for idx, d := range dl {
+		names[idx] = d.Name
+		objs[idx] = deviceDocument{Version: SchemaVersion, DeviceInfo: d}
+	}
+	return s.save("devices", names, objs)
+}
+
+// SchemaVersion returns the oldest version of the rows, which hold the version alongside the remote or device fields.
+func (s *SQLiteStore) SchemaVersion() (int, error) {
+	_, remotesVersion, err := s.loadRemotes()
+	if err != nil {
+		return 0, err
+	}
+	_, devicesVersion, err := s.loadDevices()
+	if err != nil {
+		return 0, err
+	}
+	if remotesVersion < devicesVersion {
+		return remotesVersion, nil
+	}
+	return devicesVersion, nil
+}
+
+func (s *SQLiteStore) Lock(timeout time.Duration) (Unlocker, error) {
+	return utils.LockFile(s.path, timeout)
+}
+
+// ModTime returns the latest modification time of the database, along with its write-ahead log.
+func (s *SQLiteStore) ModTime() (time.Time, error) {
+	return latestModTime(s.path, s.path+"-wal")
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
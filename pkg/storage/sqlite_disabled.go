@@ -0,0 +1,10 @@
+// +build !sqlite
+
+package storage
+
+import "fmt"
+
+// OpenSQLite fails, since the binary was built without SQLite support.
+func OpenSQLite(path string) (Store, error) {
+	return nil, fmt.Errorf("SQLite storage is not supported, build with GO_BUILD_TAGS=sqlite")
+}
@@ -0,0 +1,29 @@
+// +build sqlite
+
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	s, err := OpenSQLite(filepath.Join(dir, "ir-remotes.db"))
+	g.Expect(err).ToNot(HaveOccurred())
+	testStore(g, s)
+
+	s, err = OpenSQLite(filepath.Join(dir, "ir-remotes.db"))
+	g.Expect(err).ToNot(HaveOccurred())
+	defer s.Close()
+	modTime, known, err := ModTime(s)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(known).To(BeTrue())
+	g.Expect(modTime.IsZero()).To(BeFalse())
+}
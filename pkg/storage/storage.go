@@ -0,0 +1,126 @@
+// Package storage loads and saves remotes and devices, in various storage backends.
+package storage
+
+import (
+	"os"
+	"time"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+// Store loads and saves remotes and devices.
+// Loading from an empty store returns empty lists.
+type Store interface {
+	LoadRemotes() (remotes.RemoteList, error)
+	SaveRemotes(rl remotes.RemoteList) error
+	LoadDevices() (devices.DeviceInfoList, error)
+	SaveDevices(dl devices.DeviceInfoList) error
+	// SchemaVersion returns the oldest schema version of the stored content, SchemaVersion when empty.
+	SchemaVersion() (int, error)
+	// Lock takes the exclusive lock of the store, shared by every process using it, waiting at most timeout.
+	// Reads and writes do not take the lock: it is only needed to update content based on what was loaded.
+	Lock(timeout time.Duration) (Unlocker, error)
+	// Close releases the resources used by the store.
+	Close() error
+}
+
+// Watched stores tell when their content was modified, so that watchers only load it again once modified.
+type Watched interface {
+	// ModTime returns the latest modification time of the stored content, zero when empty.
+	ModTime() (time.Time, error)
+}
+
+// ModTime returns the latest modification time of the content of the store, false when the store does not tell.
+func ModTime(s Store) (time.Time, bool, error) {
+	if t, ok := s.(*TemplateStore); ok {
+		s = t.Store
+	}
+	w, ok := s.(Watched)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	modTime, err := w.ModTime()
+	return modTime, true, err
+}
+
+// latestModTime returns the latest modification time of the files, skipping missing ones.
+func latestModTime(files ...string) (time.Time, error) {
+	latest := time.Time{}
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Unlocker releases a lock.
+type Unlocker interface {
+	Unlock() error
+}
+
+// UpdateRemotes loads the remotes, then saves the list returned by update, holding the store lock.
+func UpdateRemotes(s Store, timeout time.Duration, update func(rl remotes.RemoteList) (remotes.RemoteList, error)) error {
+	l, err := s.Lock(timeout)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+
+	rl, err := s.LoadRemotes()
+	if err != nil {
+		return err
+	}
+	if rl, err = update(rl); err != nil {
+		return err
+	}
+	return s.SaveRemotes(rl)
+}
+
+// UpdateDevices loads the devices, then saves the list returned by update, holding the store lock.
+func UpdateDevices(s Store, timeout time.Duration, update func(dl devices.DeviceInfoList) (devices.DeviceInfoList, error)) error {
+	l, err := s.Lock(timeout)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+
+	dl, err := s.LoadDevices()
+	if err != nil {
+		return err
+	}
+	if dl, err = update(dl); err != nil {
+		return err
+	}
+	return s.SaveDevices(dl)
+}
+
+// Migrate copies the remotes and devices of from into to, replacing its content.
+func Migrate(from Store, to Store, timeout time.Duration) error {
+	rl, err := from.LoadRemotes()
+	if err != nil {
+		return err
+	}
+	dl, err := from.LoadDevices()
+	if err != nil {
+		return err
+	}
+
+	l, err := to.Lock(timeout)
+	if err != nil {
+		return err
+	}
+	defer l.Unlock()
+	if err := to.SaveRemotes(rl); err != nil {
+		return err
+	}
+	return to.SaveDevices(dl)
+}
@@ -0,0 +1,456 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v2"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+)
+
+func tempDir(g *GomegaWithT) string {
+	dir, err := ioutil.TempDir("", "storage")
+	g.Expect(err).ToNot(HaveOccurred())
+	return dir
+}
+
+// testStore checks that remotes and devices saved in s are loaded back.
+func testStore(g *GomegaWithT, s Store) {
+	rl, err := s.LoadRemotes()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rl).To(BeEmpty())
+	dl, err := s.LoadDevices()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(dl).To(BeEmpty())
+
+	tv := remotes.NewRemote("tv")
+	tv.Commands["power"] = remotes.IRCommand{0x26, 0x00, 0x01}
+	ac := &remotes.Remote{Name: "ac", Kind: remotes.KindClimate, Protocol: "daikin", Commands: map[string]remotes.IRCommand{}}
+	g.Expect(s.SaveRemotes(remotes.RemoteList{tv, ac})).To(Succeed())
+	office := &devices.DeviceInfo{Name: "office", UDPAddress: "192.168.1.10:80", MACAddress: "34:ea:34:00:00:01", Type: 0x2712}
+	g.Expect(s.SaveDevices(devices.DeviceInfoList{office})).To(Succeed())
+
+	rl, err = s.LoadRemotes()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rl.Names()).To(ConsistOf("tv", "ac"))
+	g.Expect(rl.Find("tv")).To(Equal(tv))
+	g.Expect(rl.Find("ac")).To(Equal(ac))
+	dl, err = s.LoadDevices()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(dl).To(HaveLen(1))
+	g.Expect(dl[0].Name).To(Equal("office"))
+	g.Expect(dl[0].Type).To(Equal(uint16(0x2712)))
+
+	// Removed remotes are removed from the store
+	err = UpdateRemotes(s, time.Second, func(rl remotes.RemoteList) (remotes.RemoteList, error) {
+		return remotes.RemoteList{rl.Find("ac")}, nil
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	rl, err = s.LoadRemotes()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rl.Names()).To(ConsistOf("ac"))
+
+	// The lock is exclusive
+	l, err := s.Lock(time.Second)
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = s.Lock(100 * time.Millisecond)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(l.Unlock()).To(Succeed())
+
+	g.Expect(s.Close()).To(Succeed())
+}
+
+func TestJSONStore(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	testStore(g, NewJSONStore(filepath.Join(dir, "remotes.json"), filepath.Join(dir, "devices.json")))
+}
+
+func TestJSONStoreDefaults(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+	defaults := filepath.Join(dir, "defaults")
+	g.Expect(os.Mkdir(defaults, 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(defaults, "remotes.json"), []byte(`[{"name": "tv", "commands": {}}]`), 0644)).To(Succeed())
+
+	s := NewJSONStore(filepath.Join(dir, "remotes.json"), filepath.Join(dir, "devices.json"))
+	s.Defaults = http.Dir(defaults)
+
+	// Defaults are loaded until the files are saved
+	rl, err := s.LoadRemotes()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rl.Names()).To(ConsistOf("tv"))
+	dl, err := s.LoadDevices()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(dl).To(BeEmpty())
+
+	g.Expect(s.SaveRemotes(remotes.RemoteList{remotes.NewRemote("tv"), remotes.NewRemote("ac")})).To(Succeed())
+	rl, err = s.LoadRemotes()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rl.Names()).To(ConsistOf("tv", "ac"))
+}
+
+func TestJSONStoreFormats(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	testStore(g, NewJSONStore(filepath.Join(dir, "remotes.yaml"), filepath.Join(dir, "devices.yml")))
+	testStore(g, NewJSONStore(filepath.Join(dir, "remotes.toml"), filepath.Join(dir, "devices.toml")))
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "remotes.toml"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(content)).To(ContainSubstring("[[remotes]]"))
+
+	// Comments are allowed
+	remotesFile := filepath.Join(dir, "commented.yaml")
+	g.Expect(ioutil.WriteFile(remotesFile, []byte("# Silver remote\n- name: tv\n  commands:\n    power: 2600ab # top left button\n"), 0644)).To(Succeed())
+	rl, err := NewJSONStore(remotesFile, "").LoadRemotes()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rl.Find("tv").Commands["power"]).To(Equal(remotes.IRCommand{0x26, 0x00, 0xab}))
+}
+
+func TestDirStore(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	s := NewDirStore(filepath.Join(dir, "config"))
+	testStore(g, s)
+	g.Expect(filepath.Join(dir, "config", "remotes", "ac.json")).To(BeAnExistingFile())
+	g.Expect(filepath.Join(dir, "config", "remotes", "tv.json")).ToNot(BeAnExistingFile())
+
+	// Remote names must be usable as file names
+	g.Expect(s.SaveRemotes(remotes.RemoteList{remotes.NewRemote("../tv")})).ToNot(Succeed())
+}
+
+func TestStoreOverrides(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	// Fields set explicitly to an empty value are stored, along with the schema version
+	child := &remotes.Remote{Name: "child", Extends: "base", Commands: map[string]remotes.IRCommand{}}
+	child.Override("broadcast")
+	for _, s := range []Store{
+		NewJSONStore(filepath.Join(dir, "remotes.json"), filepath.Join(dir, "devices.json")),
+		NewJSONStore(filepath.Join(dir, "remotes.yaml"), filepath.Join(dir, "devices.yaml")),
+		NewDirStore(filepath.Join(dir, "config")),
+	} {
+		g.Expect(s.SaveRemotes(remotes.RemoteList{child})).To(Succeed())
+		g.Expect(s.SaveDevices(nil)).To(Succeed())
+		version, err := s.SchemaVersion()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(version).To(Equal(SchemaVersion))
+		rl, err := s.LoadRemotes()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(rl.Find("child").Overrides("broadcast")).To(BeTrue())
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "config", "remotes", "child.json"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(content)).To(ContainSubstring(`"version"`))
+	g.Expect(string(content)).To(ContainSubstring(`"broadcast"`))
+}
+
+func TestModTime(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	for _, s := range []Store{
+		NewJSONStore(filepath.Join(dir, "remotes.json"), filepath.Join(dir, "devices.json")),
+		WithTemplates(NewDirStore(filepath.Join(dir, "config")), nil),
+	} {
+		modTime, known, err := ModTime(s)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(known).To(BeTrue())
+		g.Expect(modTime.IsZero()).To(BeTrue())
+
+		g.Expect(s.SaveRemotes(remotes.RemoteList{remotes.NewRemote("tv")})).To(Succeed())
+		saved, _, err := ModTime(s)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(saved.IsZero()).To(BeFalse())
+		unchanged, _, err := ModTime(s)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(unchanged).To(Equal(saved))
+
+		// Saving again, even the same content, is a modification
+		past := saved.Add(-time.Hour)
+		err = filepath.Walk(dir, func(path string, _ os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(path, past, past)
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		modTime, _, err = ModTime(s)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(modTime.Equal(past)).To(BeTrue())
+		g.Expect(s.SaveRemotes(remotes.RemoteList{})).To(Succeed())
+		modTime, _, err = ModTime(s)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(modTime.After(past)).To(BeTrue())
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	from := NewJSONStore(filepath.Join(dir, "remotes.json"), filepath.Join(dir, "devices.json"))
+	g.Expect(from.SaveRemotes(remotes.RemoteList{remotes.NewRemote("tv")})).To(Succeed())
+	g.Expect(from.SaveDevices(devices.DeviceInfoList{{Name: "office", UDPAddress: "192.168.1.10:80", MACAddress: "34:ea:34:00:00:01", Type: 0x2737}})).To(Succeed())
+
+	to := NewDirStore(filepath.Join(dir, "config"))
+	g.Expect(Migrate(from, to, time.Second)).To(Succeed())
+	rl, err := to.LoadRemotes()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rl.Names()).To(ConsistOf("tv"))
+	dl, err := to.LoadDevices()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(dl).To(HaveLen(1))
+}
+
+func TestSchemaVersion(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, content string) string {
+		filename := filepath.Join(dir, name)
+		g.Expect(os.MkdirAll(filepath.Dir(filename), 0755)).To(Succeed())
+		g.Expect(ioutil.WriteFile(filename, []byte(content), 0644)).To(Succeed())
+		return filename
+	}
+
+	// Legacy bare lists
+	for _, ext := range []string{".json", ".yaml"} {
+		var content string
+		if ext == ".json" {
+			content = `[{"name": "tv", "commands": {"power": "2600"}}]`
+		} else {
+			content = "- name: tv\n  commands:\n    power: \"2600\"\n"
+		}
+		s := NewJSONStore(write("remotes"+ext, content), write("devices"+ext, "[]"))
+		version, err := s.SchemaVersion()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(version).To(Equal(legacyVersion))
+
+		rl, err := s.LoadRemotes()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(rl.Names()).To(ConsistOf("tv"))
+		g.Expect(s.SaveRemotes(rl)).To(Succeed())
+		g.Expect(s.SaveDevices(nil)).To(Succeed())
+		version, err = s.SchemaVersion()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(version).To(Equal(SchemaVersion))
+	}
+
+	write("config/remotes/tv.json", `{"name": "tv", "commands": {}}`)
+	version, err := NewDirStore(filepath.Join(dir, "config")).SchemaVersion()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(version).To(Equal(legacyVersion))
+
+	// Content written by newer versions is not loaded
+	s := NewJSONStore(write("future.json", `{"version": 99, "remotes": []}`), "")
+	_, err = s.LoadRemotes()
+	g.Expect(err).To(MatchError(ContainSubstring("newer version")))
+
+	// Single device documents are only stored in JSON, but must not be rejected by YAML
+	_, err = yaml.Marshal(deviceDocument{Version: SchemaVersion, DeviceInfo: &devices.DeviceInfo{Name: "office"}})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	pending, err := PendingMigrations(legacyVersion)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pending).To(HaveLen(SchemaVersion - legacyVersion))
+	pending, err = PendingMigrations(SchemaVersion)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(pending).To(BeEmpty())
+}
+
+func TestUpgrade(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, content string) string {
+		filename := filepath.Join(dir, name)
+		g.Expect(os.MkdirAll(filepath.Dir(filename), 0755)).To(Succeed())
+		g.Expect(ioutil.WriteFile(filename, []byte(content), 0644)).To(Succeed())
+		return filename
+	}
+
+	// Legacy content is upgraded by the migrations, renaming a category and moving devices to lower case rooms
+	defer func(migrations []Migration) {
+		Migrations = migrations
+	}(Migrations)
+	applied := 0
+	Migrations = []Migration{{
+		Version:     legacyVersion,
+		Description: "Rename the television category",
+		Remotes: func(rl remotes.RemoteList) error {
+			applied++
+			for _, r := range rl {
+				if r.Category == "television" {
+					r.Category = remotes.CategoryTV
+				}
+			}
+			return nil
+		},
+		Devices: func(dl devices.DeviceInfoList) error {
+			for _, d := range dl {
+				d.Room = strings.ToLower(d.Room)
+			}
+			return nil
+		},
+	}}
+
+	legacyRemotes := map[string]string{
+		".json": `[{"name": "tv", "category": "television", "commands": {}}]`,
+		".yaml": "- name: tv\n  category: television\n  commands: {}\n",
+	}
+	legacyDevices := map[string]string{
+		".json": `[{"name": "office", "udpAddress": "192.168.1.10:80", "macAddress": "34:ea:34:00:00:01", "type": 10002, "room": "Office"}]`,
+		".yaml": "- name: office\n  udpAddress: 192.168.1.10:80\n  macAddress: 34:ea:34:00:00:01\n  type: 10002\n  room: Office\n",
+	}
+	stores := []Store{NewDirStore(filepath.Join(dir, "config"))}
+	write("config/remotes/tv.json", legacyRemotes[".json"][1:len(legacyRemotes[".json"])-1])
+	write("config/devices.json", legacyDevices[".json"])
+	for _, ext := range []string{".json", ".yaml"} {
+		stores = append(stores, NewJSONStore(write("remotes"+ext, legacyRemotes[ext]), write("devices"+ext, legacyDevices[ext])))
+	}
+	for _, s := range stores {
+		applied = 0
+		rl, err := s.LoadRemotes()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(rl.Find("tv").Category).To(Equal(remotes.CategoryTV))
+		dl, err := s.LoadDevices()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(dl[0].Room).To(Equal("office"))
+
+		// Upgraded content is saved with the current version, and not upgraded again
+		g.Expect(s.SaveRemotes(rl)).To(Succeed())
+		g.Expect(s.SaveDevices(dl)).To(Succeed())
+		version, err := s.SchemaVersion()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(version).To(Equal(SchemaVersion))
+		g.Expect(applied).To(Equal(1))
+		rl, err = s.LoadRemotes()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(rl.Find("tv").Category).To(Equal(remotes.CategoryTV))
+		g.Expect(applied).To(Equal(1))
+	}
+}
+
+func TestValidation(t *testing.T) {
+	g := NewGomegaWithT(t)
+	dir := tempDir(g)
+	defer os.RemoveAll(dir)
+
+	remotesFile := filepath.Join(dir, "remotes.json")
+	devicesFile := filepath.Join(dir, "devices.json")
+	s := NewJSONStore(remotesFile, devicesFile)
+
+	// Invalid hex codes are located
+	g.Expect(ioutil.WriteFile(remotesFile, []byte(`{"version": 2, "remotes": [{"name": "tv", "commands": {"power": "0001", "mute": "zz"}}]}`), 0644)).To(Succeed())
+	_, err := s.LoadRemotes()
+	g.Expect(err).To(BeAssignableToTypeOf(ValidationError{}))
+	g.Expect(err.(ValidationError)).To(ConsistOf(Problem{File: remotesFile, Path: "remotes[0].commands.mute", Remote: "tv", Command: "mute", Message: "invalid hex IR code zz"}))
+
+	g.Expect(ioutil.WriteFile(remotesFile, []byte(`{"version": 2, "remotes": [{"name": "tv", "commands": {"power on": "0001"}}, {"name": "tv", "kind": "climate", "protocol": "nope"}]}`), 0644)).To(Succeed())
+	_, err = s.LoadRemotes()
+	g.Expect(err).To(BeAssignableToTypeOf(ValidationError{}))
+	problems := err.(ValidationError)
+	g.Expect(problems).To(HaveLen(2))
+	g.Expect(problems[0].Path).To(Equal("remotes[1].name"))
+	g.Expect(problems[0].Message).To(ContainSubstring("duplicate remote name, also at remotes[0]"))
+	g.Expect(problems[1].Path).To(Equal("remotes[1].protocol"))
+
+	g.Expect(ioutil.WriteFile(remotesFile, []byte(`{"version": 2, "remotes": [{"name": "tv", "commands": {"power on": "0001"}}]}`), 0644)).To(Succeed())
+	rl, err := s.LoadRemotes()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(rl.Names()).To(ConsistOf("tv"))
+
+	g.Expect(ioutil.WriteFile(devicesFile, []byte(`[
+		{"name": "office", "udpAddress": "192.168.1.10:80", "macAddress": "34:ea:34:00:00:01", "type": 10002},
+		{"name": "office", "udpAddress": "192.168.1.11", "macAddress": "34:EA:34:00:00:01", "type": 1}
+	]`), 0644)).To(Succeed())
+	_, err = s.LoadDevices()
+	g.Expect(err).To(BeAssignableToTypeOf(ValidationError{}))
+	paths := []string{}
+	for _, p := range err.(ValidationError) {
+		g.Expect(p.File).To(Equal(devicesFile))
+		g.Expect(p.Device).To(Equal("office"))
+		paths = append(paths, p.Path)
+	}
+	g.Expect(paths).To(Equal([]string{"[1].name", "[1].macAddress", "[1].udpAddress", "[1].type"}))
+
+	// Remotes of the directory storage are located by file
+	d := NewDirStore(dir)
+	g.Expect(os.MkdirAll(filepath.Join(dir, "remotes"), 0755)).To(Succeed())
+	tvFile := filepath.Join(dir, "remotes", "tv.json")
+	g.Expect(ioutil.WriteFile(tvFile, []byte(`{"version": 2, "name": "tv", "commands": {"power": ""}}`), 0644)).To(Succeed())
+	_, err = d.LoadRemotes()
+	g.Expect(err).To(BeAssignableToTypeOf(ValidationError{}))
+	g.Expect(err.(ValidationError)).To(ConsistOf(Problem{File: tvFile, Path: "commands.power", Remote: "tv", Command: "power", Message: "empty IR code"}))
+}
+
+func TestLayoutValidation(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tv := remotes.NewRemote("tv")
+	tv.Commands["power"] = remotes.IRCommand{1}
+	tv.Commands["mute"] = remotes.IRCommand{2}
+	tv.Layout = &remotes.Layout{
+		Columns: 2,
+		Groups:  []remotes.Group{{Name: "volume"}},
+		Buttons: []remotes.Button{
+			{Command: "power", Width: 2},
+			{Command: "mute", Group: "volume", Row: 1},
+		},
+	}
+	tv.Aliases = map[string]string{"on": "power"}
+	g.Expect(ValidateRemotes(remotes.RemoteList{tv}, listLocator("remotes.json", "remotes"))).To(BeEmpty())
+
+	tv.Aliases = map[string]string{"on": "power", "mute": "power", "input": "source"}
+	aliases := []string{}
+	for _, p := range ValidateRemotes(remotes.RemoteList{tv}, listLocator("remotes.json", "remotes")) {
+		aliases = append(aliases, p.Path+": "+p.Message)
+	}
+	g.Expect(aliases).To(Equal([]string{
+		"remotes[0].aliases.input: alias of a missing command",
+		"remotes[0].aliases.mute: alias is already a command name",
+	}))
+	tv.Aliases = nil
+
+	tv.Layout.Buttons = append(tv.Layout.Buttons,
+		remotes.Button{Command: "input", Row: 2},
+		remotes.Button{Command: "mute", Group: "sound", Row: 1, Column: 1},
+		remotes.Button{Command: "mute", Column: 1},
+		remotes.Button{Command: "mute", Row: 3, Column: 1, Width: 2},
+	)
+	paths := []string{}
+	for _, p := range ValidateRemotes(remotes.RemoteList{tv}, listLocator("remotes.json", "remotes")) {
+		g.Expect(p.File).To(Equal("remotes.json"))
+		g.Expect(p.Remote).To(Equal("tv"))
+		paths = append(paths, p.Path+": "+p.Message)
+	}
+	g.Expect(paths).To(Equal([]string{
+		"remotes[0].layout.buttons[2].command: no such command",
+		"remotes[0].layout.buttons[3].group: no such group \"sound\"",
+		"remotes[0].layout.buttons[4]: button overlaps remotes[0].layout.buttons[0], at row 0, column 1",
+		"remotes[0].layout.buttons[5]: button at row 3, column 1, width 2 is out of the 2 columns grid",
+	}))
+}
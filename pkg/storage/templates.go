@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"net/http"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+// LoadRemoteFile loads a remote stored in its own file, like the files of the directory storage or of a library.
+// The file is loaded from fs when not nil, from disk otherwise. It may be written in JSON or YAML, and is upgraded to the current schema version.
+func LoadRemoteFile(fs http.FileSystem, filename string) (*remotes.Remote, error) {
+	doc := remoteDocument{Remote: &remotes.Remote{}}
+	var err error
+	if fs != nil {
+		err = utils.LoadFromFilesystem(&doc, fs, filename)
+	} else {
+		err = utils.LoadFromFile(&doc, filename)
+	}
+	if err != nil {
+		return nil, decodeProblems(filename, err)
+	}
+	if err := upgradeRemotes(storedVersion(doc.Version), remotes.RemoteList{doc.Remote}); err != nil {
+		return nil, err
+	}
+	if doc.Commands == nil {
+		doc.Commands = make(map[string]remotes.IRCommand)
+	}
+	return doc.Remote, nil
+}
+
+// TemplateStore resolves remotes extending other remotes, or templates, when loading.
+// Remotes are saved as they were before resolution, without what they inherit.
+type TemplateStore struct {
+	Store
+	find remotes.TemplateFinder
+}
+
+// WithTemplates returns a store resolving the remotes of s, using find to look templates up.
+func WithTemplates(s Store, find remotes.TemplateFinder) *TemplateStore {
+	return &TemplateStore{Store: s, find: find}
+}
+
+func (s *TemplateStore) LoadRemotes() (remotes.RemoteList, error) {
+	rl, err := s.Store.LoadRemotes()
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := s.Resolve(rl)
+	if err != nil {
+		return nil, err
+	}
+	// Commands referenced by layouts and aliases may be inherited, they are checked once resolved
+	locate := func(index int) (string, string) {
+		return "", ""
+	}
+	if err := ValidateRemotes(resolved, locate).orNil(); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+func (s *TemplateStore) SaveRemotes(rl remotes.RemoteList) error {
+	return s.Store.SaveRemotes(rl.Stored())
+}
+
+// Resolve resolves the remotes again, after they were edited. Remotes may be resolved already, or not.
+func (s *TemplateStore) Resolve(rl remotes.RemoteList) (remotes.RemoteList, error) {
+	return rl.Stored().Resolve(s.find)
+}
@@ -0,0 +1,409 @@
+package storage
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/j-vizcaino/ir-remotes/pkg/climate"
+	"github.com/j-vizcaino/ir-remotes/pkg/devices"
+	"github.com/j-vizcaino/ir-remotes/pkg/remotes"
+	"github.com/j-vizcaino/ir-remotes/pkg/utils"
+)
+
+// Problem is an invalid value of stored remotes or devices.
+type Problem struct {
+	// File is where the value is stored, like remotes.json.
+	File string `json:"file"`
+	// Path locates the value in the file, like remotes[2].commands.power.
+	Path    string `json:"path,omitempty"`
+	Remote  string `json:"remote,omitempty"`
+	Command string `json:"command,omitempty"`
+	Device  string `json:"device,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	where := []string{}
+	for _, part := range []string{p.File, p.Path} {
+		if part != "" {
+			where = append(where, part)
+		}
+	}
+	context := []string{}
+	if p.Remote != "" {
+		context = append(context, fmt.Sprintf("remote %q", p.Remote))
+	}
+	if p.Command != "" {
+		context = append(context, fmt.Sprintf("command %q", p.Command))
+	}
+	if p.Device != "" {
+		context = append(context, fmt.Sprintf("device %q", p.Device))
+	}
+	location := strings.Join(where, ": ")
+	if len(context) > 0 {
+		location = strings.TrimSpace(location + " (" + strings.Join(context, ", ") + ")")
+	}
+	if location == "" {
+		return p.Message
+	}
+	return location + ": " + p.Message
+}
+
+// ValidationError lists every problem found when loading remotes or devices.
+type ValidationError []Problem
+
+func (e ValidationError) Error() string {
+	if len(e) == 1 {
+		return e[0].String()
+	}
+	problems := make([]string, len(e))
+	for idx, p := range e {
+		problems[idx] = p.String()
+	}
+	return fmt.Sprintf("%d problems: %s", len(e), strings.Join(problems, "; "))
+}
+
+// orNil returns nil when there is no problem, so that it can be returned as error.
+func (e ValidationError) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// locator returns where the item at index is stored: file and path of the item.
+type locator func(index int) (string, string)
+
+// listLocator locates items of a list stored in file, under key.
+func listLocator(file string, key string) locator {
+	return func(index int) (string, string) {
+		return file, fmt.Sprintf("%s[%d]", key, index)
+	}
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// joinPath appends the field to the path, like remotes[2].commands.power.
+func joinPath(path string, field string) string {
+	if !identifier.MatchString(field) {
+		field = strconv.Quote(field)
+		return path + "[" + field + "]"
+	}
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// ValidateRemotes returns the problems of the remotes, located with locate.
+func ValidateRemotes(rl remotes.RemoteList, locate locator) ValidationError {
+	problems := ValidationError{}
+	names := make(map[string]string)
+	for idx, r := range rl {
+		file, path := locate(idx)
+		// at is the path of the invalid value
+		problem := func(at string, command string, format string, args ...interface{}) {
+			problems = append(problems, Problem{
+				File:    file,
+				Path:    at,
+				Remote:  r.Name,
+				Command: command,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		if r.Name == "" {
+			problem(joinPath(path, "name"), "", "remote name is empty")
+		} else if other, found := names[r.Name]; found {
+			problem(joinPath(path, "name"), "", "duplicate remote name, also at %s", other)
+		} else {
+			names[r.Name] = path
+		}
+
+		switch r.Kind {
+		case "", remotes.KindIR:
+		case remotes.KindClimate:
+			if _, found := climate.Find(r.Protocol); !found {
+				problem(joinPath(path, "protocol"), "", "unsupported climate protocol %q (expected one of %v)", r.Protocol, climate.ProtocolNames())
+			}
+		default:
+			problem(joinPath(path, "kind"), "", "unsupported remote kind %q (expected %s or %s)", r.Kind, remotes.KindIR, remotes.KindClimate)
+		}
+
+		for _, cmdName := range r.CommandNames() {
+			if cmdName == "" {
+				problem(joinPath(path, "commands"), cmdName, "command name is empty")
+			}
+			if len(r.Commands[cmdName]) == 0 {
+				problem(joinPath(joinPath(path, "commands"), cmdName), cmdName, "IR code is empty")
+			}
+		}
+
+		aliases := make([]string, 0, len(r.Aliases))
+		for alias := range r.Aliases {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			cmdName := r.Aliases[alias]
+			at := joinPath(joinPath(path, "aliases"), alias)
+			switch _, found := r.Commands[alias]; {
+			case alias == "":
+				problem(joinPath(path, "aliases"), cmdName, "alias name is empty")
+			case found:
+				problem(at, cmdName, "alias is already a command name")
+			}
+			if _, found := r.Commands[cmdName]; !found && ownsCommands(r) {
+				problem(at, cmdName, "alias of a missing command")
+			}
+		}
+
+		if r.Layout != nil {
+			for _, p := range layoutProblems(r, joinPath(path, "layout")) {
+				p.File = file
+				problems = append(problems, p)
+			}
+		}
+	}
+	return problems
+}
+
+// ownsCommands tells whether every command of the remote is listed: commands of climate remotes are generated,
+// and commands of remotes extending others are inherited, until resolved.
+func ownsCommands(r *remotes.Remote) bool {
+	return !r.IsClimate() && (r.Extends == "" || r.Parent() != nil)
+}
+
+// layoutProblems returns the problems of the remote layout, located at path.
+func layoutProblems(r *remotes.Remote, path string) ValidationError {
+	problems := ValidationError{}
+	problem := func(at string, command string, format string, args ...interface{}) {
+		problems = append(problems, Problem{Path: at, Remote: r.Name, Command: command, Message: fmt.Sprintf(format, args...)})
+	}
+	l := r.Layout
+	if l.Columns < 0 {
+		problem(joinPath(path, "columns"), "", "invalid number of columns %d", l.Columns)
+	}
+
+	groups := make(map[string]bool)
+	for idx, g := range l.Groups {
+		at := fmt.Sprintf("%s[%d].name", joinPath(path, "groups"), idx)
+		if g.Name == "" {
+			problem(at, "", "group name is empty")
+		} else if groups[g.Name] {
+			problem(at, "", "duplicate group %q", g.Name)
+		}
+		groups[g.Name] = true
+	}
+
+	// cells maps grid cells to the path of the button using it
+	cells := make(map[[2]int]string)
+	for idx, b := range l.Buttons {
+		at := fmt.Sprintf("%s[%d]", joinPath(path, "buttons"), idx)
+		if _, found := r.Commands[b.Command]; !found && ownsCommands(r) {
+			problem(joinPath(at, "command"), b.Command, "no such command")
+		}
+		if b.Group != "" && !groups[b.Group] {
+			problem(joinPath(at, "group"), b.Command, "no such group %q", b.Group)
+		}
+		if b.Row < 0 || b.Column < 0 || b.Column+b.Span() > l.GridColumns() {
+			problem(at, b.Command, "button at row %d, column %d, width %d is out of the %d columns grid", b.Row, b.Column, b.Span(), l.GridColumns())
+			continue
+		}
+		for column := b.Column; column < b.Column+b.Span(); column++ {
+			cell := [2]int{b.Row, column}
+			if other, found := cells[cell]; found {
+				problem(at, b.Command, "button overlaps %s, at row %d, column %d", other, b.Row, column)
+				break
+			}
+			cells[cell] = at
+		}
+	}
+	return problems
+}
+
+// ValidateDevices returns the problems of the devices, located with locate.
+func ValidateDevices(dl devices.DeviceInfoList, locate locator) ValidationError {
+	problems := ValidationError{}
+	names := make(map[string]string)
+	macs := make(map[string]string)
+	for idx, d := range dl {
+		file, path := locate(idx)
+		problem := func(field string, format string, args ...interface{}) {
+			problems = append(problems, Problem{
+				File:    file,
+				Path:    joinPath(path, field),
+				Device:  d.Name,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		if d.Name == "" {
+			problem("name", "device name is empty")
+		} else if other, found := names[d.Name]; found {
+			problem("name", "duplicate device name, also at %s", other)
+		} else {
+			names[d.Name] = path
+		}
+
+		if mac, err := net.ParseMAC(d.MACAddress); err != nil {
+			problem("macAddress", "invalid MAC address %q", d.MACAddress)
+		} else if other, found := macs[mac.String()]; found {
+			problem("macAddress", "duplicate MAC address, also at %s", other)
+		} else {
+			macs[mac.String()] = path
+		}
+
+		if err := checkUDPAddress(d.UDPAddress); err != nil {
+			problem("udpAddress", "invalid UDP address %q, %s", d.UDPAddress, err)
+		}
+
+		if !devices.SupportsIR(d.Type) {
+			problem("type", "unsupported device type 0x%04x, not an IR blaster", d.Type)
+		}
+	}
+	return problems
+}
+
+// checkUDPAddress checks the host:port address, without resolving the host.
+func checkUDPAddress(address string) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// decodeProblems locates the values of a file which cannot be decoded, like invalid hex IR codes.
+// The file content is loaded without types, then every remote or device is checked.
+// Returns err as a single problem of the file when no value is found.
+func decodeProblems(file string, err error) ValidationError {
+	var content interface{}
+	if loadErr := utils.LoadFromFile(&content, file); loadErr != nil {
+		return ValidationError{{File: file, Message: err.Error()}}
+	}
+	content = normalize(content)
+
+	problems := ValidationError{}
+	checkList := func(key string, list interface{}) {
+		items, ok := list.([]interface{})
+		if !ok {
+			problems = append(problems, Problem{File: file, Path: key, Message: "expected a list"})
+			return
+		}
+		for idx, item := range items {
+			problems = append(problems, itemProblems(file, fmt.Sprintf("%s[%d]", key, idx), item)...)
+		}
+	}
+	switch doc := content.(type) {
+	case []interface{}:
+		// Bare list, stored before versioning
+		checkList("", doc)
+	case map[string]interface{}:
+		_, hasRemotes := doc["remotes"]
+		_, hasDevices := doc["devices"]
+		switch {
+		case hasRemotes:
+			checkList("remotes", doc["remotes"])
+		case hasDevices:
+			checkList("devices", doc["devices"])
+		default:
+			// A single remote, like the files of the directory storage
+			problems = append(problems, itemProblems(file, "", doc)...)
+		}
+	}
+	if len(problems) == 0 {
+		return ValidationError{{File: file, Message: err.Error()}}
+	}
+	return problems
+}
+
+// itemProblems checks the fields of a remote or device, loaded without types.
+func itemProblems(file string, path string, item interface{}) ValidationError {
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		return ValidationError{{File: file, Path: path, Message: "expected an object"}}
+	}
+	problems := ValidationError{}
+	name, _ := fields["name"].(string)
+	for _, field := range []string{"name", "kind", "protocol", "udpAddress", "macAddress", "typeName"} {
+		if value, found := fields[field]; found {
+			if _, ok := value.(string); !ok {
+				problems = append(problems, Problem{File: file, Path: joinPath(path, field), Message: fmt.Sprintf("expected a string, got %v", value)})
+			}
+		}
+	}
+	if value, found := fields["type"]; found {
+		if _, ok := value.(string); ok {
+			problems = append(problems, Problem{File: file, Path: joinPath(path, "type"), Device: name, Message: fmt.Sprintf("expected a number, got %q", value)})
+		}
+	}
+	commands, found := fields["commands"]
+	if !found || commands == nil {
+		return problems
+	}
+	cmdMap, ok := commands.(map[string]interface{})
+	if !ok {
+		return append(problems, Problem{File: file, Path: joinPath(path, "commands"), Remote: name, Message: "expected an object"})
+	}
+	names := make([]string, 0, len(cmdMap))
+	for cmdName := range cmdMap {
+		names = append(names, cmdName)
+	}
+	sort.Strings(names)
+	for _, cmdName := range names {
+		code := cmdMap[cmdName]
+		hex, ok := code.(string)
+		var cmd remotes.IRCommand
+		message := ""
+		switch {
+		case ok && hex == "":
+			message = "empty IR code"
+		case !ok || cmd.UnmarshalText([]byte(hex)) != nil:
+			message = fmt.Sprintf("invalid hex IR code %v", code)
+		default:
+			continue
+		}
+		problems = append(problems, Problem{
+			File:    file,
+			Path:    joinPath(joinPath(path, "commands"), cmdName),
+			Remote:  name,
+			Command: cmdName,
+			Message: message,
+		})
+	}
+	return problems
+}
+
+// normalize converts maps decoded from YAML, which have interface{} keys, so that they look like JSON maps.
+func normalize(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			out[fmt.Sprint(k)] = normalize(item)
+		}
+		return out
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = normalize(item)
+		}
+		return value
+	case []interface{}:
+		for idx, item := range value {
+			value[idx] = normalize(item)
+		}
+		return value
+	}
+	return v
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v2"
+)
+
+// format encodes and decodes files.
+type format struct {
+	encode func(obj interface{}, out io.Writer) error
+	decode func(obj interface{}, in io.Reader) error
+}
+
+// formatOf returns the format of filename, from its extension: YAML (.yaml or .yml), TOML (.toml) or JSON otherwise.
+func formatOf(filename string) format {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch ext {
+	case ".yaml", ".yml":
+		return format{encode: saveYAML, decode: loadYAML}
+	case ".toml":
+		return format{encode: saveTOML, decode: loadTOML}
+	}
+	return format{encode: Save, decode: Load}
+}
+
+func saveYAML(obj interface{}, out io.Writer) error {
+	enc := yaml.NewEncoder(out)
+	if err := enc.Encode(obj); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func loadYAML(obj interface{}, in io.Reader) error {
+	return yaml.NewDecoder(in).Decode(obj)
+}
+
+// tomlTagName makes TOML use the JSON field names
+const tomlTagName = "json"
+
+// saveTOML encodes obj, which must be a struct or a map since TOML documents are tables.
+func saveTOML(obj interface{}, out io.Writer) error {
+	return toml.NewEncoder(out).SetTagName(tomlTagName).Order(toml.OrderPreserve).Encode(obj)
+}
+
+func loadTOML(obj interface{}, in io.Reader) error {
+	return toml.NewDecoder(in).SetTagName(tomlTagName).Decode(obj)
+}
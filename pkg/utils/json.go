@@ -2,9 +2,12 @@ package utils
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 )
 
 func Save(obj interface{}, out io.Writer) error {
@@ -13,15 +16,122 @@ func Save(obj interface{}, out io.Writer) error {
 	return enc.Encode(obj)
 }
 
+// Backups is the number of previous versions kept by SaveToFile, as filename.1 (most recent) to filename.N.
+var Backups = 3
+
+// SaveToFile saves obj to a temporary file, then renames it over filename.
+// The format matches the filename extension: YAML (.yaml or .yml), TOML (.toml) or JSON otherwise.
+// Readers never see a partially written file, even if the process crashes or the disk is full.
+// The previous file content is kept as a backup.
+// The file keeps its permissions, new files being readable by everyone.
 func SaveToFile(obj interface{}, filename string) error {
+	return saveToFile(obj, filename, Backups, 0)
+}
+
+// SaveToFileAtomic is SaveToFile, without backups.
+func SaveToFileAtomic(obj interface{}, filename string) error {
+	return saveToFile(obj, filename, 0, 0)
+}
+
+// SaveToFilePrivate is SaveToFile for secrets, like private keys: the file is only readable by its owner,
+// and no backup is kept.
+func SaveToFilePrivate(obj interface{}, filename string) error {
+	return saveToFile(obj, filename, 0, 0600)
+}
 
-	fd, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+// saveToFile saves obj, keeping the given number of backups. The file gets the perm permissions,
+// or keeps its current permissions when perm is 0.
+func saveToFile(obj interface{}, filename string, backups int, perm os.FileMode) error {
+	if perm == 0 {
+		perm = 0644
+		if info, err := os.Stat(filename); err == nil {
+			perm = info.Mode().Perm()
+		}
+	}
+	fd, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
 	if err != nil {
 		return err
 	}
-	defer fd.Close()
+	tmpName := fd.Name()
+	defer os.Remove(tmpName)
+
+	if err := formatOf(filename).encode(obj, fd); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err := rotateBackups(filename, backups); err != nil {
+		return fmt.Errorf("failed to back up %s, %s", filename, err)
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(filename))
+	return nil
+}
+
+// rotateBackups shifts the existing backups of filename, then backs up its current content as filename.1.
+func rotateBackups(filename string, count int) error {
+	if count <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+	backup := func(n int) string {
+		return fmt.Sprintf("%s.%d", filename, n)
+	}
+	for n := count - 1; n > 0; n-- {
+		if err := os.Rename(backup(n), backup(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// The file is renamed over, so its content stays available through the link
+	os.Remove(backup(1))
+	if err := os.Link(filename, backup(1)); err == nil {
+		return nil
+	}
+	return copyFile(filename, backup(1))
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
 
-	return Save(obj, fd)
+// syncDir persists renames in dir. Errors are ignored, since some platforms cannot sync directories.
+func syncDir(dir string) {
+	fd, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	_ = fd.Sync()
 }
 
 func Load(obj interface{}, in io.Reader) error {
@@ -29,13 +139,14 @@ func Load(obj interface{}, in io.Reader) error {
 	return dec.Decode(obj)
 }
 
+// LoadFromFile loads obj from filename, using the format matching its extension: JSON, YAML or TOML.
 func LoadFromFile(obj interface{}, filename string) error {
 	fd, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
 	defer fd.Close()
-	return Load(obj, fd)
+	return formatOf(filename).decode(obj, fd)
 }
 
 func LoadFromFilesystem(obj interface{}, fs http.FileSystem, filename string) error {
@@ -44,5 +155,5 @@ func LoadFromFilesystem(obj interface{}, fs http.FileSystem, filename string) er
 		return err
 	}
 	defer file.Close()
-	return Load(obj, file)
+	return formatOf(filename).decode(obj, file)
 }
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSaveToFile(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "utils")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "remotes.json")
+
+	defer func(backups int) { Backups = backups }(Backups)
+	Backups = 2
+
+	for i := 1; i <= 4; i++ {
+		g.Expect(SaveToFile([]int{i}, filename)).To(Succeed())
+	}
+
+	var content []int
+	g.Expect(LoadFromFile(&content, filename)).To(Succeed())
+	g.Expect(content).To(Equal([]int{4}))
+	g.Expect(LoadFromFile(&content, filename+".1")).To(Succeed())
+	g.Expect(content).To(Equal([]int{3}))
+	g.Expect(LoadFromFile(&content, filename+".2")).To(Succeed())
+	g.Expect(content).To(Equal([]int{2}))
+	g.Expect(filename + ".3").ToNot(BeAnExistingFile())
+
+	// Temporary files are cleaned up, even on failure
+	g.Expect(SaveToFile(func() {}, filename)).ToNot(Succeed())
+	g.Expect(LoadFromFile(&content, filename)).To(Succeed())
+	g.Expect(content).To(Equal([]int{4}))
+	files, err := filepath.Glob(filepath.Join(dir, ".remotes.json.tmp*"))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(files).To(BeEmpty())
+}
+
+func TestLockFile(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "utils")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "remotes.json")
+
+	l, err := LockFile(filename, time.Second)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(filename + ".lock").To(BeAnExistingFile())
+
+	// Other holders wait for the lock
+	_, err = LockFile(filename, 100*time.Millisecond)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(l.Unlock()).To(Succeed())
+	l, err = LockFile(filename, 100*time.Millisecond)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(l.Unlock()).To(Succeed())
+}
+
+func TestSaveToFile_Permissions(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "utils")
+	g.Expect(err).ToNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "remotes.json")
+
+	// New files are readable by everyone
+	g.Expect(SaveToFile([]int{1}, filename)).To(Succeed())
+	info, err := os.Stat(filename)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+
+	// Existing files keep their permissions, and so do their backups
+	g.Expect(os.Chmod(filename, 0600)).To(Succeed())
+	g.Expect(SaveToFile([]int{2}, filename)).To(Succeed())
+	g.Expect(SaveToFileAtomic([]int{3}, filename)).To(Succeed())
+	for _, name := range []string{filename, filename + ".1"} {
+		info, err := os.Stat(name)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)), name)
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// lockRetryDelay is the interval between two attempts to take a lock held by another process
+const lockRetryDelay = 50 * time.Millisecond
+
+// FileLock is an advisory lock on a file, shared by every process using it.
+// The lock is taken on filename.lock, since saving replaces the file itself.
+type FileLock struct {
+	flock *flock.Flock
+}
+
+// LockFile takes the exclusive lock of filename, waiting at most timeout for other processes to release it.
+func LockFile(filename string, timeout time.Duration) (*FileLock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	l := &FileLock{flock: flock.New(filename + ".lock")}
+	locked, err := l.flock.TryLockContext(ctx, lockRetryDelay)
+	if err != nil && err != context.DeadlineExceeded {
+		return nil, fmt.Errorf("failed to lock %s, %s", filename, err)
+	}
+	if !locked {
+		return nil, fmt.Errorf("failed to lock %s, still locked by another process after %s", filename, timeout)
+	}
+	return l, nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	return l.flock.Unlock()
+}